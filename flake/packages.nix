@@ -34,6 +34,10 @@
         postInstall = ''
           install -Dm644 data/io.github.alyraffauf.Switchyard.desktop \
             $out/share/applications/io.github.alyraffauf.Switchyard.desktop
+          install -Dm644 data/io.github.alyraffauf.Switchyard.service \
+            $out/share/dbus-1/services/io.github.alyraffauf.Switchyard.service
+          substituteInPlace $out/share/dbus-1/services/io.github.alyraffauf.Switchyard.service \
+            --replace-fail @bindir@ $out/bin
 
           install -Dm644 data/icons/hicolor/scalable/apps/io.github.alyraffauf.Switchyard.svg \
             $out/share/icons/hicolor/scalable/apps/io.github.alyraffauf.Switchyard.svg
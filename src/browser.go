@@ -11,18 +11,27 @@ import (
 )
 
 type Browser struct {
-	ID      string // desktop file ID (e.g., "firefox.desktop")
+	ID      string // desktop file ID (e.g., "firefox.desktop"), followed by "#profile" for profiles
 	Name    string
 	Icon    string
-	AppInfo *gio.AppInfo // Store the GIO AppInfo for launching
+	AppInfo *gio.AppInfo  // Store the GIO AppInfo for launching
+	Entry   *desktopEntry // parsed desktop file, nil if it couldn't be read
+	Profile string        // profile name, for targets from detectProfiles
+	Command string        // command template, for custom targets from the config
 }
 
 func detectBrowsers() []*Browser {
+	return detectHandlers("http")
+}
+
+// detectHandlers returns the apps that open links with a URI scheme, e.g. mail
+// clients for mailto. Browsers are the handlers of http.
+func detectHandlers(scheme string) []*Browser {
 	var browsers []*Browser
 
-	// Use GIO to get all applications that handle HTTP URLs
+	// Use GIO to get all applications that handle the scheme
 	// This automatically handles system apps, Flatpaks, Snaps, etc.
-	appInfos := gio.AppInfoGetRecommendedForType("x-scheme-handler/http")
+	appInfos := gio.AppInfoGetRecommendedForType(schemeMimeType(scheme))
 
 	for _, appInfo := range appInfos {
 		id := appInfo.ID()
@@ -35,12 +44,24 @@ func detectBrowsers() []*Browser {
 			continue
 		}
 
-		// Skip apps that shouldn't be shown
+		// Skip apps that shouldn't be shown. GIO only knows the desktop
+		// files it indexed, so check the one we parse too.
 		if !appInfo.ShouldShow() {
 			continue
 		}
+		entry, err := loadDesktopEntry(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if !entry.shouldShow() {
+			continue
+		}
 
 		name := appInfo.Name()
+		if entry != nil {
+			if n := entry.name(messagesLocale()); n != "" {
+				name = n
+			}
+		}
 		icon := ""
 		if gicon := appInfo.Icon(); gicon != nil {
 			icon = gicon.String()
@@ -51,6 +72,7 @@ func detectBrowsers() []*Browser {
 			Name:    name,
 			Icon:    icon,
 			AppInfo: appInfo,
+			Entry:   entry,
 		})
 	}
 
@@ -62,24 +84,164 @@ func detectBrowsers() []*Browser {
 	return browsers
 }
 
-func launchBrowser(b *Browser, url string) {
-	cmdline := b.AppInfo.Commandline()
-	if cmdline == "" {
-		fmt.Fprintf(os.Stderr, "Error: No command line for browser %s\n", b.Name)
-		return
+// detectProfiles returns a target for each profile of the browsers that keep
+// several, like Firefox with separate Work and Personal profiles. Their IDs are
+// the browser's ID and the profile, see profileTargetID.
+func detectProfiles(browsers []*Browser) []*Browser {
+	var targets []*Browser
+	for _, b := range browsers {
+		profiles := discoverProfiles(b.ID)
+		if len(profiles) < 2 {
+			continue
+		}
+		for _, p := range profiles {
+			targets = append(targets, &Browser{
+				ID:      profileTargetID(b.ID, p.ID),
+				Name:    fmt.Sprintf("%s (%s)", b.Name, p.Name),
+				Icon:    b.Icon,
+				AppInfo: b.AppInfo,
+				Entry:   b.Entry,
+				Profile: p.Name,
+			})
+		}
+	}
+	return targets
+}
+
+// detectTargets returns every app rules can open links in: the browsers and
+// their profiles, and the handlers of each of the schemes, sorted by name.
+func detectTargets(schemes []string) []*Browser {
+	targets := detectBrowsers()
+	targets = append(targets, detectProfiles(targets)...)
+	seen := make(map[string]bool)
+	for _, b := range targets {
+		seen[b.ID] = true
 	}
-	if err := launchCommand(cmdline, url, b.AppInfo); err != nil {
-		fmt.Fprintf(os.Stderr, "Error launching browser: %v\n", err)
+	for _, scheme := range schemes {
+		for _, b := range detectHandlers(scheme) {
+			if !seen[b.ID] {
+				seen[b.ID] = true
+				targets = append(targets, b)
+			}
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+	return targets
+}
+
+// commandline returns the command line the browser is launched with, the
+// Exec key of its desktop file.
+func (b *Browser) commandline() string {
+	if b.Entry != nil {
+		return b.Entry.exec()
 	}
+	return b.AppInfo.Commandline()
 }
 
-// launchBrowserAction launches a browser with a specific desktop file action (e.g., "new-private-window")
-func launchBrowserAction(b *Browser, action DesktopAction, url string) {
-	if action.Exec == "" {
-		fmt.Fprintf(os.Stderr, "Error: No exec line for action %s\n", action.ID)
-		return
+// execEntry returns exec, the browser's command line or one of its actions',
+// with the icon, name and desktop file the %i, %c and %k field codes expand to.
+func (b *Browser) execEntry(exec string) execEntry {
+	entry := execEntry{Exec: exec, Icon: b.Icon, Name: b.Name}
+	if b.Entry != nil {
+		entry.Name = b.Entry.name(messagesLocale())
+		entry.Path = b.Entry.Path
 	}
-	if err := launchCommand(action.Exec, url, b.AppInfo); err != nil {
-		fmt.Fprintf(os.Stderr, "Error launching browser action: %v\n", err)
+	return entry
+}
+
+// dbusName returns the bus name the browser is launched with over D-Bus, if
+// its desktop file asks for it.
+func (b *Browser) dbusName() string {
+	if b.Entry == nil {
+		return ""
+	}
+	return b.Entry.dbusName()
+}
+
+func launchBrowser(b *Browser, url string) error {
+	return launchBrowserURLs(b, []string{url})
+}
+
+// launchBrowserURLs opens several URLs in a browser, in one launch if its
+// command line takes a list of URLs.
+func launchBrowserURLs(b *Browser, urls []string) error {
+	return launchBrowserWith(b, urls, launchOptions{})
+}
+
+// launchBrowserWith opens URLs in a browser the way a rule says: with one of
+// its desktop actions, extra arguments and environment variables, see
+// launchEntry. Custom targets run their own command. It fails if the browser
+// can't be started or exits with an error right away.
+func launchBrowserWith(b *Browser, urls []string, opts launchOptions) error {
+	if b.Command != "" {
+		return launchCustomTarget(b, urls, opts)
+	}
+	entry, warning := b.launchEntry(opts.Action)
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if entry.Exec == "" {
+		return fmt.Errorf("No command line for browser %s", b.Name)
+	}
+	return launchCommand(entry, urls, opts.extraArgs(b.ID), opts.environ(), b.AppInfo)
+}
+
+// launchEntry returns what launching the browser with a desktop action runs,
+// or with its main command line if action is empty. A missing action falls
+// back to the main command line, and so does an action without an Exec line:
+// actions of D-Bus activatable apps may only be activated over D-Bus, which
+// can't pass URLs along. warning says why the action isn't used. Only the main
+// command line is launched over D-Bus.
+func (b *Browser) launchEntry(action string) (entry execEntry, warning string) {
+	if action != "" {
+		desktopAction, ok := b.desktopAction(action)
+		switch {
+		case !ok:
+			warning = fmt.Sprintf("%s has no action %s, opening it normally", b.Name, action)
+		case desktopAction.Exec == "":
+			warning = fmt.Sprintf("Action %s has no exec line, opening %s normally", action, b.Name)
+		default:
+			return b.execEntry(desktopAction.Exec), ""
+		}
+	}
+	entry = b.execEntry(b.commandline())
+	entry.DBus = b.dbusName()
+	return entry, warning
+}
+
+// launchCustomTarget runs a custom target's command once for each URL, with
+// the extra arguments and environment of opts. Desktop actions don't apply.
+// It fails if the command can't be built or started for any of them.
+func launchCustomTarget(b *Browser, urls []string, opts launchOptions) error {
+	invocations := make([][]string, 0, len(urls))
+	for _, url := range urls {
+		parts, err := customCommand(b.Command, url, opts.Args)
+		if err != nil {
+			return err
+		}
+		invocations = append(invocations, parts)
+	}
+	return startCommands(invocations, opts.environ(), nil)
+}
+
+// desktopActions returns the browser's desktop file actions, in the order its
+// desktop file lists them and named in the user's language.
+func (b *Browser) desktopActions() []DesktopAction {
+	if b.Entry == nil {
+		return nil
+	}
+	return b.Entry.actions(messagesLocale())
+}
+
+// desktopAction returns one of the browser's desktop file actions by ID.
+func (b *Browser) desktopAction(id string) (DesktopAction, bool) {
+	for _, action := range b.desktopActions() {
+		if action.ID == id {
+			return action, true
+		}
 	}
+	return DesktopAction{}, false
 }
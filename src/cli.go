@@ -0,0 +1,622 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const cliUsage = `Usage:
+  switchyard [URL...]                    Open URLs, or the settings without any
+  switchyard explain [options] URL       Show how a URL would be routed, without opening it
+  switchyard rules list                  List rules in the order they're matched
+  switchyard rules add [options]         Add a rule, see "switchyard rules add -h"
+  switchyard rules remove RULE           Remove a rule
+  switchyard rules move RULE POSITION    Move a rule to a new position
+  switchyard rules enable RULE           Enable a disabled rule
+  switchyard rules disable RULE          Disable a rule without removing it
+  switchyard config validate [FILE]      Check a config file for problems
+  switchyard config export [FILE]        Write the config to FILE, or stdout
+  switchyard config import FILE          Replace the config with FILE
+  switchyard browsers list [--scheme S]  List installed browsers and profiles, or apps for S links
+  switchyard sticky list                 List browsers chosen for always ask rules that haven't expired
+  switchyard sticky clear [DOMAIN...]    Forget the browsers chosen for DOMAINs, or all of them
+
+RULE is a rule's position, starting at 1, or its name.
+`
+
+// errUsage is returned by commands called with the wrong arguments. The
+// message has already been printed along with the usage.
+var errUsage = errors.New("usage")
+
+// cliCommands are the first arguments handled by runCLI instead of the GUI.
+var cliCommands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"explain":  runExplainCommand,
+	"rules":    runRulesCommand,
+	"config":   runConfigCommand,
+	"browsers": runBrowsersCommand,
+	"sticky":   runStickyCommand,
+	"help": func(_ []string, stdout, _ io.Writer) error {
+		fmt.Fprint(stdout, cliUsage)
+		return nil
+	},
+}
+
+// isCLICommand reports whether the command line should be handled by runCLI.
+func isCLICommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := cliCommands[args[0]]
+	return ok
+}
+
+// runCLI runs a command without starting the GUI and returns its exit code:
+// 0 on success, 1 on failure and 2 for invalid arguments.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	err := cmd(args[1:], stdout, stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "switchyard: %v\n", err)
+		return 1
+	}
+}
+
+// usageError prints a problem with the arguments followed by the usage.
+func usageError(stderr io.Writer, format string, args ...any) error {
+	fmt.Fprintf(stderr, "switchyard: "+format+"\n\n", args...)
+	fmt.Fprint(stderr, cliUsage)
+	return errUsage
+}
+
+// subcommand returns the subcommand in args and its arguments.
+func subcommand(args []string, stderr io.Writer, group string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, usageError(stderr, "missing %s command", group)
+	}
+	return args[0], args[1:], nil
+}
+
+// expectArgs checks that a subcommand was given exactly n arguments.
+func expectArgs(args []string, n int, stderr io.Writer, command string) error {
+	if len(args) != n {
+		return usageError(stderr, "%s takes %d argument(s), got %d", command, n, len(args))
+	}
+	return nil
+}
+
+func runRulesCommand(args []string, stdout, stderr io.Writer) error {
+	sub, args, err := subcommand(args, stderr, "rules")
+	if err != nil {
+		return err
+	}
+
+	if sub == "add" {
+		return runRulesAdd(args, stdout, stderr)
+	}
+
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath(), err)
+	}
+
+	switch sub {
+	case "list":
+		if err := expectArgs(args, 0, stderr, "rules list"); err != nil {
+			return err
+		}
+		printRules(stdout, cfg.Rules)
+		return nil
+
+	case "remove":
+		if err := expectArgs(args, 1, stderr, "rules remove"); err != nil {
+			return err
+		}
+		i, err := findRuleIndex(cfg.Rules, args[0])
+		if err != nil {
+			return err
+		}
+		removed := cfg.Rules[i]
+		cfg.Rules = append(cfg.Rules[:i], cfg.Rules[i+1:]...)
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Removed rule %d%s\n", i+1, quotedName(removed.Name))
+		return nil
+
+	case "move":
+		if err := expectArgs(args, 2, stderr, "rules move"); err != nil {
+			return err
+		}
+		i, err := findRuleIndex(cfg.Rules, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := strconv.Atoi(args[1])
+		if err != nil || to < 1 || to > len(cfg.Rules) {
+			return fmt.Errorf("position must be between 1 and %d", len(cfg.Rules))
+		}
+		rule := cfg.Rules[i]
+		cfg.Rules = append(cfg.Rules[:i], cfg.Rules[i+1:]...)
+		cfg.Rules = append(cfg.Rules[:to-1], append([]Rule{rule}, cfg.Rules[to-1:]...)...)
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Moved rule%s to position %d\n", quotedName(rule.Name), to)
+		return nil
+
+	case "enable", "disable":
+		if err := expectArgs(args, 1, stderr, "rules "+sub); err != nil {
+			return err
+		}
+		i, err := findRuleIndex(cfg.Rules, args[0])
+		if err != nil {
+			return err
+		}
+		cfg.Rules[i].Disabled = sub == "disable"
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		verb := "Enabled"
+		if cfg.Rules[i].Disabled {
+			verb = "Disabled"
+		}
+		fmt.Fprintf(stdout, "%s rule %d%s\n", verb, i+1, quotedName(cfg.Rules[i].Name))
+		return nil
+	}
+
+	return usageError(stderr, "unknown rules command %q", sub)
+}
+
+// conditionFlag collects repeated --condition TYPE:PATTERN flags.
+type conditionFlag []Condition
+
+func (f *conditionFlag) String() string { return "" }
+
+func (f *conditionFlag) Set(value string) error {
+	c, err := parseConditionArg(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, c)
+	return nil
+}
+
+// parseConditionArg parses a condition given as TYPE:PATTERN, or !TYPE:PATTERN
+// to negate it. The pattern may contain colons.
+func parseConditionArg(arg string) (Condition, error) {
+	condType, pattern, ok := strings.Cut(arg, ":")
+	if !ok {
+		return Condition{}, fmt.Errorf("condition must be TYPE:PATTERN, like domain:github.com")
+	}
+	c := Condition{Type: condType, Pattern: pattern}
+	if strings.HasPrefix(c.Type, "!") {
+		c.Type = strings.TrimPrefix(c.Type, "!")
+		c.Negate = true
+	}
+	if err := validateCondition(c); err != nil {
+		return Condition{}, err
+	}
+	return c, nil
+}
+
+// listFlag collects a repeated flag's values.
+type listFlag []string
+
+func (f *listFlag) String() string { return "" }
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func runRulesAdd(args []string, stdout, stderr io.Writer) error {
+	var rule Rule
+	var conditions conditionFlag
+	var launchArgs, env, fallbacks listFlag
+
+	fs := flag.NewFlagSet("switchyard rules add", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&rule.Name, "name", "", "friendly `name` for the rule")
+	fs.StringVar(&rule.Browser, "browser", "", "desktop file `ID` of the browser, see \"switchyard browsers list\"")
+	fs.Var(&conditions, "condition", "`TYPE:PATTERN` the URL must match, or !TYPE:PATTERN to negate it (repeatable)")
+	fs.StringVar(&rule.Logic, "logic", "all", "`all` conditions must match, or any")
+	fs.StringVar(&rule.Action, "action", "", "desktop action `ID` to launch the browser with, e.g. new-private-window")
+	fs.Var(&launchArgs, "arg", "extra `argument` for the browser, added before the URL (repeatable)")
+	fs.Var(&env, "env", "`NAME=VALUE` environment variable for the browser (repeatable)")
+	fs.Var(&fallbacks, "fallback", "browser `ID` to use if the browser is missing or fails to start, in order (repeatable)")
+	fs.BoolVar(&rule.AlwaysAsk, "always-ask", false, "show the picker instead of opening the browser")
+	fs.BoolVar(&rule.Disabled, "disabled", false, "add the rule disabled")
+	fs.BoolVar(&rule.Quiet, "quiet", false, "don't show a notification when the rule opens links")
+	position := fs.Int("position", 0, "`position` to insert the rule at, the end by default")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage // the flag package already printed the problem
+	}
+	if fs.NArg() > 0 {
+		return usageError(stderr, "unexpected argument %q, conditions are given with --condition", fs.Arg(0))
+	}
+
+	rule.Conditions = conditions
+	rule.Args = launchArgs
+	rule.Fallbacks = fallbacks
+	for _, e := range env {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok {
+			return usageError(stderr, "environment variable %q must be NAME=VALUE", e)
+		}
+		if rule.Env == nil {
+			rule.Env = make(map[string]string)
+		}
+		rule.Env[name] = value
+	}
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath(), err)
+	}
+
+	for _, id := range append([]string{rule.Browser}, rule.Fallbacks...) {
+		if id != "" && !isInstalledBrowser(id, cfg) {
+			fmt.Fprintf(stderr, "Warning: %s is not an installed browser\n", id)
+		}
+	}
+
+	at := len(cfg.Rules)
+	if *position != 0 {
+		if *position < 1 || *position > len(cfg.Rules)+1 {
+			return fmt.Errorf("position must be between 1 and %d", len(cfg.Rules)+1)
+		}
+		at = *position - 1
+	}
+	cfg.Rules = append(cfg.Rules[:at], append([]Rule{rule}, cfg.Rules[at:]...)...)
+
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Added rule %d%s\n", at+1, quotedName(rule.Name))
+	return nil
+}
+
+// findRuleIndex finds a rule by its 1-based position or its name.
+func findRuleIndex(rules []Rule, ref string) (int, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(rules) {
+			return 0, fmt.Errorf("no rule at position %d, there are %d rules", n, len(rules))
+		}
+		return n - 1, nil
+	}
+
+	found := -1
+	for i, rule := range rules {
+		if rule.Name == ref {
+			if found != -1 {
+				return 0, fmt.Errorf("more than one rule is named %q, use its position instead", ref)
+			}
+			found = i
+		}
+	}
+	if found == -1 {
+		return 0, fmt.Errorf("no rule named %q", ref)
+	}
+	return found, nil
+}
+
+// printRules prints rules as a table in match order.
+func printRules(w io.Writer, rules []Rule) {
+	if len(rules) == 0 {
+		fmt.Fprintln(w, "No rules")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tNAME\tBROWSER\tCONDITIONS")
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = "-"
+		}
+		if rule.Disabled {
+			name += " (disabled)"
+		}
+		browser := rule.Browser
+		if rule.AlwaysAsk {
+			browser = "Always ask"
+		} else if rule.Action != "" {
+			browser += " (" + rule.Action + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, name, browser, formatRuleConditions(&rule))
+	}
+	tw.Flush()
+}
+
+// formatRuleConditions summarizes a rule's conditions on one line.
+func formatRuleConditions(rule *Rule) string {
+	if len(rule.Groups) > 0 {
+		return fmt.Sprintf("%d conditions in groups", countConditions(rule.rootGroup()))
+	}
+	parts := make([]string, len(rule.Conditions))
+	for i, c := range rule.Conditions {
+		parts[i] = formatCondition(c)
+	}
+	sep := " and "
+	if rule.Logic == "any" {
+		sep = " or "
+	}
+	return strings.Join(parts, sep)
+}
+
+func runConfigCommand(args []string, stdout, stderr io.Writer) error {
+	sub, args, err := subcommand(args, stderr, "config")
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "validate":
+		if len(args) > 1 {
+			return usageError(stderr, "config validate takes at most one file")
+		}
+		path := configPath()
+		if len(args) == 1 {
+			path = args[0]
+		}
+		problems, err := checkConfigFile(path)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%s has %d problem(s)", path, len(problems))
+		}
+		fmt.Fprintf(stdout, "%s is valid\n", path)
+		return nil
+
+	case "export":
+		if len(args) > 1 {
+			return usageError(stderr, "config export takes at most one file")
+		}
+		cfg, err := readConfig(configPath())
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", configPath(), err)
+		}
+		if len(args) == 0 || args[0] == "-" {
+			data, err := toml.Marshal(cfg)
+			if err != nil {
+				return err
+			}
+			_, err = stdout.Write(data)
+			return err
+		}
+		return exportConfig(cfg, args[0])
+
+	case "import":
+		if err := expectArgs(args, 1, stderr, "config import"); err != nil {
+			return err
+		}
+		problems, err := checkConfigFile(args[0])
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			for _, p := range problems {
+				fmt.Fprintln(stderr, p)
+			}
+			return fmt.Errorf("not importing %s, it has %d problem(s)", args[0], len(problems))
+		}
+		if err := importConfig(&Config{}, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Imported %s\n", args[0])
+		return nil
+	}
+
+	return usageError(stderr, "unknown config command %q", sub)
+}
+
+// checkConfigFile reads a config file strictly, reporting unknown settings as
+// well as invalid rules and rewrites. The error is only set if the file can't
+// be read or parsed at all.
+func checkConfigFile(path string) ([]error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	cfg := defaultConfig()
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var strict *toml.StrictMissingError
+		var decodeErr *toml.DecodeError
+		switch {
+		case errors.As(err, &strict):
+			// Everything else was still decoded
+			for _, e := range strict.Errors {
+				problems = append(problems, fmt.Errorf("unknown setting %q", strings.Join(e.Key(), ".")))
+			}
+		case errors.As(err, &decodeErr):
+			row, col := decodeErr.Position()
+			return nil, fmt.Errorf("%s:%d:%d: %v", path, row, col, decodeErr)
+		default:
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return append(problems, validateConfig(cfg)...), nil
+}
+
+func runExplainCommand(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("switchyard explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "print the trace as JSON")
+	from := fs.String("from", "", "explain the URL as if opened from `APP`, a desktop file ID, Flatpak ID, executable or \"terminal\"")
+	offline := fs.Bool("offline", false, "don't expand short links, which asks their sites where they lead")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		return usageError(stderr, "explain takes one URL")
+	}
+
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath(), err)
+	}
+	cfg.sticky = loadStickyChoices()
+	if *offline {
+		cfg.ExpandShortLinks = false
+	}
+
+	var source *sourceApp
+	if *from == "terminal" {
+		source = &sourceApp{Terminal: true}
+	} else if *from != "" {
+		source = &sourceApp{Exe: *from, DesktopID: *from, FlatpakID: *from}
+	}
+
+	browsers := cfg.withCustomTargets(detectTargets(append(cfg.schemeNames(), handlerScheme(fs.Arg(0)))))
+	trace := cfg.explainURL(fs.Arg(0), source, func(id, action string) (execEntry, bool) {
+		for _, b := range browsers {
+			if b.ID != id {
+				continue
+			}
+			if b.Command != "" {
+				return execEntry{Exec: b.Command}, true
+			}
+			// The same command line routing would launch, with its warning
+			entry, warning := b.launchEntry(action)
+			if warning != "" {
+				fmt.Fprintf(stderr, "Warning: %s\n", warning)
+			}
+			return entry, true
+		}
+		return execEntry{}, false
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(trace)
+	}
+	writeTrace(stdout, trace)
+	return nil
+}
+
+func runBrowsersCommand(args []string, stdout, stderr io.Writer) error {
+	sub, args, err := subcommand(args, stderr, "browsers")
+	if err != nil {
+		return err
+	}
+	if sub != "list" {
+		return usageError(stderr, "unknown browsers command %q", sub)
+	}
+
+	fs := flag.NewFlagSet("switchyard browsers list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	scheme := fs.String("scheme", "", "list the apps that open `SCHEME` links instead, e.g. mailto")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if err := expectArgs(fs.Args(), 0, stderr, "browsers list"); err != nil {
+		return err
+	}
+
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath(), err)
+	}
+
+	apps := cfg.withCustomTargets(detectTargets(nil))
+	if *scheme != "" {
+		apps = detectHandlers(strings.ToLower(strings.TrimSuffix(*scheme, ":")))
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME")
+	for _, b := range apps {
+		fmt.Fprintf(tw, "%s\t%s\n", b.ID, b.Name)
+	}
+	return tw.Flush()
+}
+
+func runStickyCommand(args []string, stdout, stderr io.Writer) error {
+	sub, args, err := subcommand(args, stderr, "sticky")
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "list":
+		if err := expectArgs(args, 0, stderr, "sticky list"); err != nil {
+			return err
+		}
+		choices := loadStickyChoices()
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "DOMAIN\tBROWSER\tLASTS")
+		for _, domain := range sortedStickyDomains(choices) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", domain, choices[domain].Browser, choices[domain].describe())
+		}
+		return tw.Flush()
+
+	case "clear":
+		removed, err := clearStickyChoices(args...)
+		if err != nil {
+			return err
+		}
+		if removed == 0 && len(args) > 0 {
+			return fmt.Errorf("no browser was chosen for %s", strings.Join(args, ", "))
+		}
+		fmt.Fprintf(stdout, "Cleared %d sticky choice(s)\n", removed)
+		return nil
+	}
+
+	return usageError(stderr, "unknown sticky command %q", sub)
+}
+
+// isInstalledBrowser reports whether id is the desktop file ID of a detected
+// browser or of an app that handles one of the config's schemes, or the ID of
+// one of its custom targets.
+func isInstalledBrowser(id string, cfg *Config) bool {
+	for _, b := range cfg.withCustomTargets(detectTargets(cfg.schemeNames())) {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
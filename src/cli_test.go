@@ -0,0 +1,451 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setConfigHome points the config at an empty temporary directory
+func setConfigHome(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+// runCLITest runs a command line and returns its exit code and output
+func runCLITest(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runCLI(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// mustRunCLI runs a command line that is expected to succeed
+func mustRunCLI(t *testing.T, args ...string) string {
+	t.Helper()
+	code, stdout, stderr := runCLITest(t, args...)
+	if code != 0 {
+		t.Fatalf("%v exited with %d: %s", args, code, stderr)
+	}
+	return stdout
+}
+
+// savedRules reads the rules back from the config file
+func savedRules(t *testing.T) []Rule {
+	t.Helper()
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		t.Fatalf("readConfig() error = %v", err)
+	}
+	return cfg.Rules
+}
+
+func ruleNames(rules []Rule) string {
+	names := make([]string, len(rules))
+	for i, r := range rules {
+		names[i] = r.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// TestIsCLICommand tests which command lines bypass the GUI
+func TestIsCLICommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: nil, want: false},
+		{args: []string{"https://example.com"}, want: false},
+		{args: []string{"--gapplication-service"}, want: false},
+		{args: []string{"rules", "list"}, want: true},
+		{args: []string{"config"}, want: true},
+		{args: []string{"browsers", "list"}, want: true},
+		{args: []string{"help"}, want: true},
+		{args: []string{"explain", "https://example.com"}, want: true},
+		{args: []string{"sticky", "list"}, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := isCLICommand(tt.args); got != tt.want {
+			t.Errorf("isCLICommand(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCLI_Rules tests managing rules from the command line
+func TestCLI_Rules(t *testing.T) {
+	setConfigHome(t)
+
+	if out := mustRunCLI(t, "rules", "list"); !strings.Contains(out, "No rules") {
+		t.Errorf("rules list with no config = %q", out)
+	}
+
+	mustRunCLI(t, "rules", "add", "--name", "GitHub", "--browser", "firefox.desktop", "--condition", "domain:github.com",
+		"--action", "new-private-window", "--arg", "--kiosk", "--env", "MOZ_ENABLE_WAYLAND=1", "--quiet")
+	mustRunCLI(t, "rules", "add", "--name", "Work", "--browser", "chromium.desktop", "--logic", "any",
+		"--condition", "domain_suffix:corp.example", "--condition", "!query:personal=1",
+		"--fallback", "firefox.desktop", "--fallback", "epiphany.desktop")
+	mustRunCLI(t, "rules", "add", "--name", "First", "--always-ask", "--position", "1", "--condition", "regex:^https://x\\.com/.*")
+
+	rules := savedRules(t)
+	if got := ruleNames(rules); got != "First,GitHub,Work" {
+		t.Fatalf("rules = %s, want First,GitHub,Work", got)
+	}
+	work := rules[2]
+	if work.Logic != "any" || len(work.Conditions) != 2 || !work.Conditions[1].Negate || work.Conditions[1].Pattern != "personal=1" ||
+		strings.Join(work.Fallbacks, ",") != "firefox.desktop,epiphany.desktop" {
+		t.Errorf("Work rule = %+v", work)
+	}
+	if !rules[0].AlwaysAsk || rules[0].Conditions[0].Pattern != `^https://x\.com/.*` {
+		t.Errorf("First rule = %+v", rules[0])
+	}
+	github := rules[1]
+	if github.Action != "new-private-window" || len(github.Args) != 1 || github.Args[0] != "--kiosk" || github.Env["MOZ_ENABLE_WAYLAND"] != "1" ||
+		!github.Quiet || work.Quiet {
+		t.Errorf("GitHub rule = %+v", github)
+	}
+
+	out := mustRunCLI(t, "rules", "list")
+	for _, want := range []string{"GitHub", "firefox.desktop (new-private-window)", "Exact Domain: github.com", "Always ask", "Not Query Parameter: personal=1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rules list output missing %q:\n%s", want, out)
+		}
+	}
+
+	mustRunCLI(t, "rules", "move", "First", "3")
+	if got := ruleNames(savedRules(t)); got != "GitHub,Work,First" {
+		t.Errorf("after move: %s, want GitHub,Work,First", got)
+	}
+
+	mustRunCLI(t, "rules", "disable", "Work")
+	if !savedRules(t)[1].Disabled {
+		t.Error("rule not disabled")
+	}
+	if out := mustRunCLI(t, "rules", "list"); !strings.Contains(out, "Work (disabled)") {
+		t.Errorf("rules list doesn't show the disabled rule:\n%s", out)
+	}
+	mustRunCLI(t, "rules", "enable", "2")
+	if savedRules(t)[1].Disabled {
+		t.Error("rule not enabled")
+	}
+
+	mustRunCLI(t, "rules", "remove", "1")
+	if got := ruleNames(savedRules(t)); got != "Work,First" {
+		t.Errorf("after remove: %s, want Work,First", got)
+	}
+}
+
+// TestCLI_RulesErrors tests that bad arguments are rejected without saving
+func TestCLI_RulesErrors(t *testing.T) {
+	setConfigHome(t)
+	mustRunCLI(t, "rules", "add", "--name", "A", "--browser", "a.desktop", "--condition", "domain:a.com")
+	mustRunCLI(t, "rules", "add", "--name", "A", "--browser", "b.desktop", "--condition", "domain:b.com")
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "no subcommand", args: []string{"rules"}, wantCode: 2},
+		{name: "unknown subcommand", args: []string{"rules", "rename"}, wantCode: 2},
+		{name: "add without conditions", args: []string{"rules", "add", "--browser", "a.desktop"}, wantCode: 1},
+		{name: "add without browser", args: []string{"rules", "add", "--condition", "domain:a.com"}, wantCode: 1},
+		{name: "add unknown type", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "color:red"}, wantCode: 2},
+		{name: "add invalid pattern", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "regex:["}, wantCode: 2},
+		{name: "add without type", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "a.com"}, wantCode: 2},
+		{name: "add env without value", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com", "--env", "DEBUG"}, wantCode: 2},
+		{name: "add invalid env name", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com", "--env", "MY-VAR=1"}, wantCode: 1},
+		{name: "add repeated fallback", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com", "--fallback", "b.desktop", "--fallback", "b.desktop"}, wantCode: 1},
+		{name: "add bad logic", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com", "--logic", "some"}, wantCode: 1},
+		{name: "add bad position", args: []string{"rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com", "--position", "9"}, wantCode: 1},
+		{name: "add positional argument", args: []string{"rules", "add", "--browser", "a.desktop", "domain:a.com"}, wantCode: 2},
+		{name: "remove out of range", args: []string{"rules", "remove", "3"}, wantCode: 1},
+		{name: "remove ambiguous name", args: []string{"rules", "remove", "A"}, wantCode: 1},
+		{name: "remove unknown name", args: []string{"rules", "remove", "B"}, wantCode: 1},
+		{name: "remove without rule", args: []string{"rules", "remove"}, wantCode: 2},
+		{name: "move bad position", args: []string{"rules", "move", "1", "0"}, wantCode: 1},
+		{name: "enable extra argument", args: []string{"rules", "enable", "1", "2"}, wantCode: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLITest(t, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if stderr == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+
+	if got := len(savedRules(t)); got != 2 {
+		t.Errorf("got %d rules after failed commands, want 2", got)
+	}
+}
+
+// TestCLI_RulesRefusesBrokenConfig tests that a config that can't be parsed isn't overwritten
+func TestCLI_RulesRefusesBrokenConfig(t *testing.T) {
+	setConfigHome(t)
+	os.MkdirAll(configDir(), 0755)
+	broken := []byte("rules = [\n")
+	if err := os.WriteFile(configPath(), broken, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, _ := runCLITest(t, "rules", "add", "--browser", "a.desktop", "--condition", "domain:a.com"); code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if data, _ := os.ReadFile(configPath()); !bytes.Equal(data, broken) {
+		t.Errorf("config was overwritten with %q", data)
+	}
+}
+
+// TestCLI_ConfigValidate tests reporting problems in config files
+func TestCLI_ConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+		wantOut  string
+	}{
+		{
+			name:     "valid",
+			content:  "prompt_on_click = true\n[[rules]]\nname = \"GitHub\"\nbrowser = \"firefox.desktop\"\n[[rules.conditions]]\ntype = \"domain\"\npattern = \"github.com\"\n",
+			wantCode: 0,
+			wantOut:  "is valid",
+		},
+		{
+			name:     "unknown setting",
+			content:  "promt_on_click = true\n",
+			wantCode: 1,
+			wantOut:  `unknown setting "promt_on_click"`,
+		},
+		{
+			name:     "invalid rule",
+			content:  "[[rules]]\nname = \"Bad\"\nbrowser = \"firefox.desktop\"\n[[rules.conditions]]\ntype = \"regex\"\npattern = \"[\"\n",
+			wantCode: 1,
+			wantOut:  `rule 1 ("Bad"): Regex: Invalid regex`,
+		},
+		{
+			name:     "invalid rewrite",
+			content:  "[[rewrites]]\nname = \"Empty\"\n",
+			wantCode: 1,
+			wantOut:  `rewrite 1 ("Empty")`,
+		},
+		{
+			name:     "invalid scheme",
+			content:  "[[schemes]]\nscheme = \"MailTo\"\n[[schemes]]\nscheme = \"https\"\n",
+			wantCode: 1,
+			wantOut:  `scheme "MailTo": write it as "mailto"`,
+		},
+		{
+			name:     "invalid target",
+			content:  "[[targets]]\nid = \"mpv\"\ncommand = \"mpv {title}\"\n",
+			wantCode: 1,
+			wantOut:  `target "mpv": Unknown placeholder {title}`,
+		},
+		{
+			name:     "syntax error",
+			content:  "rules = [\n",
+			wantCode: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := write(strings.ReplaceAll(tt.name, " ", "-")+".toml", tt.content)
+			code, stdout, stderr := runCLITest(t, "config", "validate", path)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if !strings.Contains(stdout, tt.wantOut) {
+				t.Errorf("output = %q, want it to contain %q", stdout, tt.wantOut)
+			}
+		})
+	}
+
+	if code, _, _ := runCLITest(t, "config", "validate", filepath.Join(dir, "missing.toml")); code != 1 {
+		t.Errorf("missing file: exit code = %d, want 1", code)
+	}
+}
+
+// TestCLI_ConfigExportImport tests exporting and importing configs
+func TestCLI_ConfigExportImport(t *testing.T) {
+	setConfigHome(t)
+	mustRunCLI(t, "rules", "add", "--name", "GitHub", "--browser", "firefox.desktop", "--condition", "domain:github.com")
+
+	exported := mustRunCLI(t, "config", "export")
+	if !strings.Contains(exported, `pattern = 'github.com'`) && !strings.Contains(exported, `pattern = "github.com"`) {
+		t.Errorf("export is missing the rule:\n%s", exported)
+	}
+
+	path := filepath.Join(t.TempDir(), "exported.toml")
+	mustRunCLI(t, "config", "export", path)
+
+	// Importing an invalid config leaves the current one alone
+	invalid := filepath.Join(t.TempDir(), "invalid.toml")
+	os.WriteFile(invalid, []byte("[[rules]]\nbrowser = \"x.desktop\"\n"), 0644)
+	if code, _, _ := runCLITest(t, "config", "import", invalid); code != 1 {
+		t.Errorf("import of invalid config: exit code = %d, want 1", code)
+	}
+	if got := ruleNames(savedRules(t)); got != "GitHub" {
+		t.Errorf("rules after refused import = %s", got)
+	}
+
+	mustRunCLI(t, "rules", "remove", "GitHub")
+	mustRunCLI(t, "config", "import", path)
+	if got := ruleNames(savedRules(t)); got != "GitHub" {
+		t.Errorf("rules after import = %s, want GitHub", got)
+	}
+
+	// Settings a file leaves out get their defaults
+	partial := filepath.Join(t.TempDir(), "partial.toml")
+	os.WriteFile(partial, []byte(`favorite_browser = "firefox.desktop"`), 0644)
+	mustRunCLI(t, "config", "import", partial)
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := defaultConfig()
+	if cfg.FavoriteBrowser != "firefox.desktop" || !cfg.PromptOnClick || !cfg.NotifyOnRoute ||
+		cfg.HistoryDays != def.HistoryDays || cfg.StickyMinutes != def.StickyMinutes ||
+		len(cfg.ShortLinkDomains) != len(def.ShortLinkDomains) || len(cfg.Rules) != 0 {
+		t.Errorf("config after importing a partial file = %+v", cfg)
+	}
+}
+
+// TestParseConditionArg tests parsing --condition values
+func TestParseConditionArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Condition
+		wantErr bool
+	}{
+		{arg: "domain:github.com", want: Condition{Type: "domain", Pattern: "github.com"}},
+		{arg: "!domain:github.com", want: Condition{Type: "domain", Pattern: "github.com", Negate: true}},
+		{arg: "path_glob:/a/*:b", want: Condition{Type: "path_glob", Pattern: "/a/*:b"}},
+		{arg: "schedule:mon-fri 09:00-17:00", want: Condition{Type: "schedule", Pattern: "mon-fri 09:00-17:00"}},
+		{arg: "github.com", wantErr: true},
+		{arg: "domain:", wantErr: true},
+		{arg: "unknown:x", wantErr: true},
+		{arg: "port:http", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseConditionArg(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConditionArg(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseConditionArg(%q) = %+v, want %+v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCLI_Explain tests explaining a URL as text and JSON
+func TestCLI_Explain(t *testing.T) {
+	setConfigHome(t)
+	mustRunCLI(t, "rules", "add", "--name", "Mail", "--browser", "firefox.desktop", "--condition", "source_app:thunderbird")
+
+	out := mustRunCLI(t, "explain", "--from", "thunderbird", "https://example.com")
+	for _, want := range []string{"URL: https://example.com", "Opened from: thunderbird", "✓ 1. Mail → firefox.desktop", "Decision:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("explain output is missing %q:\n%s", want, out)
+		}
+	}
+
+	var trace urlTrace
+	if err := json.Unmarshal([]byte(mustRunCLI(t, "explain", "--json", "https://example.com")), &trace); err != nil {
+		t.Fatalf("explain --json output is not JSON: %v", err)
+	}
+	if trace.URL != "https://example.com" || len(trace.Rules) != 1 || trace.Rules[0].Matched {
+		t.Errorf("explain --json = %+v", trace)
+	}
+
+	if code, _, _ := runCLITest(t, "explain"); code != 2 {
+		t.Errorf("explain without a URL: exit code = %d, want 2", code)
+	}
+}
+
+// TestCLI_ExplainOffline tests that --offline explains without expanding short links
+func TestCLI_ExplainOffline(t *testing.T) {
+	setConfigHome(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		redirect(w, "https://example.com/expanded")
+	})
+	cfg := defaultConfig()
+	cfg.ExpandShortLinks = true
+	cfg.ShortLinkDomains = []string{"127.0.0.1"}
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustRunCLI(t, "explain", "--offline", srv.URL+"/abc")
+	if strings.Contains(out, "expand short link") {
+		t.Errorf("explain --offline expanded the short link:\n%s", out)
+	}
+	if n := srv.requestCount(); n != 0 {
+		t.Errorf("server received %d requests with --offline", n)
+	}
+
+	out = mustRunCLI(t, "explain", srv.URL+"/abc")
+	if !strings.Contains(out, "  expand short link: https://example.com/expanded\n") {
+		t.Errorf("explain output doesn't expand the short link:\n%s", out)
+	}
+}
+
+// TestCLI_Sticky tests listing and clearing sticky choices
+func TestCLI_Sticky(t *testing.T) {
+	setConfigHome(t)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	setClock(t, time.Date(2026, 10, 17, 14, 3, 0, 0, time.Local))
+	setLoginSession(t, "boot/2")
+
+	if err := addStickyChoices([]string{"b.example"}, newStickyChoice("firefox.desktop", 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := addStickyChoices([]string{"a.example"}, newStickyChoice("chromium.desktop", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	out := mustRunCLI(t, "sticky", "list")
+	want := "DOMAIN     BROWSER           LASTS\n" +
+		"a.example  chromium.desktop  for this session\n" +
+		"b.example  firefox.desktop   until 14:33\n"
+	if out != want {
+		t.Errorf("sticky list =\n%s\nwant\n%s", out, want)
+	}
+
+	if out := mustRunCLI(t, "sticky", "clear", "a.example"); out != "Cleared 1 sticky choice(s)\n" {
+		t.Errorf("sticky clear a.example = %q", out)
+	}
+	if code, _, stderr := runCLITest(t, "sticky", "clear", "a.example"); code != 1 || !strings.Contains(stderr, "no browser was chosen for a.example") {
+		t.Errorf("clearing a missing choice: exit code = %d, stderr = %q", code, stderr)
+	}
+	if out := mustRunCLI(t, "sticky", "clear"); out != "Cleared 1 sticky choice(s)\n" {
+		t.Errorf("sticky clear = %q", out)
+	}
+	if code, _, _ := runCLITest(t, "sticky", "forget"); code != 2 {
+		t.Errorf("unknown sticky command: exit code = %d, want 2", code)
+	}
+}
@@ -7,33 +7,116 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/pelletier/go-toml/v2"
 )
 
 type Config struct {
-	PromptOnClick       bool     `toml:"prompt_on_click"`
-	FavoriteBrowser     string   `toml:"favorite_browser"`
-	HiddenBrowsers      []string `toml:"hidden_browsers"`
-	CheckDefaultBrowser bool     `toml:"check_default_browser"`
-	ShowAppNames        bool     `toml:"show_app_names"`
-	ForceDarkMode       bool     `toml:"force_dark_mode"`
-	Rules               []Rule   `toml:"rules"`
+	PromptOnClick       bool            `toml:"prompt_on_click"`
+	FavoriteBrowser     string          `toml:"favorite_browser"`
+	HiddenBrowsers      []string        `toml:"hidden_browsers"`
+	CheckDefaultBrowser bool            `toml:"check_default_browser"`
+	ShowAppNames        bool            `toml:"show_app_names"`
+	ForceDarkMode       bool            `toml:"force_dark_mode"`
+	Rules               []Rule          `toml:"rules"`
+	Rewrites            []Rewrite       `toml:"rewrites,omitempty"`            // applied in order before matching rules
+	DisabledUnwrappers  []string        `toml:"disabled_unwrappers,omitempty"` // IDs from unwrappers
+	ExpandShortLinks    bool            `toml:"expand_short_links"`            // follow redirects of ShortLinkDomains, see shortLinkResolver
+	ShortLinkDomains    []string        `toml:"short_link_domains"`
+	Schemes             []SchemeHandler `toml:"schemes,omitempty"`           // routed besides http and https
+	Targets             []CustomTarget  `toml:"targets,omitempty"`           // commands rules and the picker can open links with
+	FallbackBrowsers    []string        `toml:"fallback_browsers,omitempty"` // tried in order when a browser is missing or fails to start
+	NotifyOnRoute       bool            `toml:"notify_on_route"`             // show a notification when a rule opens links, see noticeFor
+	History             bool            `toml:"history"`                     // record routed links, see recordHistory
+	HistoryHostOnly     bool            `toml:"history_host_only"`           // record only the scheme and host of links
+	HistoryDays         int             `toml:"history_days"`
+	HistoryMaxEntries   int             `toml:"history_max_entries"`
+	RememberPosition    string          `toml:"remember_position,omitempty"` // "top" or "bottom" of the rules, see addRememberedRule
+	StickyMinutes       int             `toml:"sticky_minutes"`              // how long a browser chosen for an always ask rule is kept
+
+	matcher *ruleMatcher            // compiled Rules, see findRule
+	sticky  map[string]stickyChoice // by domain, see loadStickyChoices
 }
 
 type Condition struct {
-	Type    string `toml:"type"` // "domain", "keyword", "glob", "regex"
+	Type    string `toml:"type"` // see conditionTypes for the full list
 	Pattern string `toml:"pattern"`
+	Negate  bool   `toml:"negate,omitempty"` // match when the pattern does NOT match
+}
+
+// ConditionGroup nests conditions under their own logic, so rules can express
+// things like "github.com AND NOT (path /personal OR query org=me)".
+type ConditionGroup struct {
+	Logic      string           `toml:"logic,omitempty"` // "all" or "any"
+	Negate     bool             `toml:"negate,omitempty"`
+	Conditions []Condition      `toml:"conditions,omitempty"`
+	Groups     []ConditionGroup `toml:"groups,omitempty"`
 }
 
 type Rule struct {
-	Name       string      `toml:"name"`
-	Conditions []Condition `toml:"conditions"`
-	Logic      string      `toml:"logic,omitempty"` // "all" or "any"
-	Browser    string      `toml:"browser"`
-	AlwaysAsk  bool        `toml:"always_ask"`
+	Name       string            `toml:"name"`
+	Conditions []Condition       `toml:"conditions"`
+	Groups     []ConditionGroup  `toml:"groups,omitempty"` // nested groups, combined with Conditions using Logic
+	Logic      string            `toml:"logic,omitempty"`  // "all" or "any"
+	Browser    string            `toml:"browser"`
+	Action     string            `toml:"action,omitempty"`    // desktop action to launch the browser with, e.g. "new-private-window"
+	Args       []string          `toml:"args,omitempty"`      // extra arguments, added before the URLs
+	Env        map[string]string `toml:"env,omitempty"`       // extra environment variables
+	Fallbacks  []string          `toml:"fallbacks,omitempty"` // tried in order when Browser is missing or fails to start, before FallbackBrowsers
+	AlwaysAsk  bool              `toml:"always_ask"`
+	Disabled   bool              `toml:"disabled,omitempty"` // kept in the config, but never matched
+	Quiet      bool              `toml:"quiet,omitempty"`    // no notification when it opens links
+}
+
+// Rewrite transforms URLs before they are matched against rules and opened,
+// e.g. to strip tracking parameters or redirect to another host.
+type Rewrite struct {
+	Name        string           `toml:"name"`
+	Conditions  []Condition      `toml:"conditions,omitempty"` // no conditions matches every URL
+	Groups      []ConditionGroup `toml:"groups,omitempty"`
+	Logic       string           `toml:"logic,omitempty"`        // "all" or "any"
+	StripParams []string         `toml:"strip_params,omitempty"` // query parameter names, may contain wildcards
+	Template    string           `toml:"template,omitempty"`     // replacement URL, see rewritePlaceholders
+}
+
+// rootGroup returns the rule's top-level conditions and groups as a single group
+func (r *Rule) rootGroup() ConditionGroup {
+	return ConditionGroup{Logic: r.Logic, Conditions: r.Conditions, Groups: r.Groups}
+}
+
+// setRootGroup replaces the rule's conditions, groups and logic with those of root
+func (r *Rule) setRootGroup(root ConditionGroup) {
+	r.Conditions = root.Conditions
+	r.Groups = root.Groups
+	r.Logic = root.Logic
+	if r.Logic == "" {
+		r.Logic = "all"
+	}
+}
+
+// clone returns a deep copy of the group so it can be edited independently
+func (g ConditionGroup) clone() ConditionGroup {
+	c := g
+	c.Conditions = append([]Condition(nil), g.Conditions...)
+	c.Groups = make([]ConditionGroup, len(g.Groups))
+	for i, sub := range g.Groups {
+		c.Groups[i] = sub.clone()
+	}
+	return c
+}
+
+// isEmpty reports whether the group has no conditions at any depth
+func (g *ConditionGroup) isEmpty() bool {
+	if len(g.Conditions) > 0 {
+		return false
+	}
+	for i := range g.Groups {
+		if !g.Groups[i].isEmpty() {
+			return false
+		}
+	}
+	return true
 }
 
 func configDir() string {
@@ -44,37 +127,80 @@ func configDir() string {
 	return filepath.Join(home, ".config", "switchyard")
 }
 
+// cacheDir is where data that can safely be deleted, like resolved short links, is kept.
+func cacheDir() string {
+	if xdg := os.Getenv("XDG_CACHE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "switchyard")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "switchyard")
+}
+
+// stateDir is where data that should persist but isn't configuration, like
+// the history of routed links, is kept.
+func stateDir() string {
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "switchyard")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "state", "switchyard")
+}
+
 func configPath() string {
 	return filepath.Join(configDir(), "config.toml")
 }
 
 func loadConfig() *Config {
-	cfg := &Config{
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load config file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Using default configuration\n")
+		return defaultConfig()
+	}
+	return cfg
+}
+
+// defaultConfig returns the configuration used when there is no config file
+func defaultConfig() *Config {
+	return &Config{
 		PromptOnClick:       true,
 		CheckDefaultBrowser: true,
 		ShowAppNames:        false, // Default: hide app names, show tooltips
 		ForceDarkMode:       true,  // Default: force dark mode
+		NotifyOnRoute:       true,
+		HistoryDays:         defaultHistoryDays,
+		HistoryMaxEntries:   defaultHistoryMaxEntries,
+		StickyMinutes:       defaultStickyMinutes,
 		Rules:               []Rule{},
+		ShortLinkDomains:    append([]string(nil), defaultShortLinkDomains...),
 	}
+}
+
+// readConfig reads the config file at path on top of the defaults. A missing
+// file gives the defaults, but unlike loadConfig, a broken file is an error, so
+// callers that save the config don't overwrite it.
+func readConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
 
-	data, err := os.ReadFile(configPath())
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
 	if err != nil {
-		return cfg
+		return nil, err
 	}
 
 	if err := toml.Unmarshal(data, cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Failed to parse config file: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Using default configuration\n")
-		return &Config{
-			PromptOnClick:       true,
-			CheckDefaultBrowser: true,
-			Rules:               []Rule{},
-		}
+		return nil, err
 	}
-	return cfg
+	cfg.matcher = compileRules(cfg.Rules)
+	return cfg, nil
 }
 
 func saveConfig(cfg *Config) error {
+	// Rules may have been edited in place, so recompile them on next match
+	cfg.resetMatcher()
+
 	dir := configDir()
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
@@ -89,85 +215,60 @@ func saveConfig(cfg *Config) error {
 }
 
 func (cfg *Config) matchRule(url string) (browserID string, alwaysAsk bool, matched bool) {
-	for _, rule := range cfg.Rules {
-		if rule.matchesConditions(url) {
-			return rule.Browser, rule.AlwaysAsk, true
-		}
+	return cfg.matchRuleFrom(url, nil)
+}
+
+// matchRuleFrom matches a URL opened by source, which is nil when unknown.
+func (cfg *Config) matchRuleFrom(url string, source *sourceApp) (browserID string, alwaysAsk bool, matched bool) {
+	in := newMatchInput(url)
+	in.source = source
+	if rule := cfg.findRuleFor(in); rule != nil {
+		return rule.Browser, rule.AlwaysAsk, true
 	}
 	return "", false, false
 }
 
-func (r *Rule) matchesConditions(url string) bool {
-	if len(r.Conditions) == 0 {
-		return false
-	}
+// findRule returns the first rule matching the URL, or nil if none match.
+func (cfg *Config) findRule(url string) *Rule {
+	return cfg.findRuleFor(newMatchInput(url))
+}
 
-	logic := r.Logic
-	if logic == "" {
-		logic = "all" // Default to AND logic
+// findRuleFor returns the first rule matching the input, or nil if none match.
+// Rules are compiled on first use and recompiled after the config is saved.
+func (cfg *Config) findRuleFor(in *matchInput) *Rule {
+	if cfg.matcher == nil {
+		cfg.matcher = compileRules(cfg.Rules)
 	}
+	return cfg.matcher.match(in)
+}
 
-	if logic == "all" {
-		// AND: All conditions must match
-		for _, cond := range r.Conditions {
-			if !matchesPattern(url, cond.Pattern, cond.Type) {
-				return false
-			}
-		}
-		return true
-	} else {
-		// OR: Any condition must match
-		for _, cond := range r.Conditions {
-			if matchesPattern(url, cond.Pattern, cond.Type) {
-				return true
-			}
-		}
-		return false
-	}
+// resetMatcher discards the compiled rules so they are rebuilt from cfg.Rules on next use
+func (cfg *Config) resetMatcher() {
+	cfg.matcher = nil
+}
+
+func (r *Rule) matchesConditions(url string) bool {
+	return r.compile().match(newMatchInput(url))
 }
 
 func matchesPattern(url, pattern, patternType string) bool {
-	domain := extractDomain(url)
-
-	switch patternType {
-	case "domain":
-		// Exact domain match
-		return strings.EqualFold(domain, pattern)
-	case "keyword":
-		// URL contains text
-		return strings.Contains(strings.ToLower(url), strings.ToLower(pattern))
-	case "regex":
-		re, err := regexp.Compile(pattern)
-		if err != nil {
-			return false
-		}
-		return re.MatchString(url)
-	case "glob":
-		return matchGlob(url, pattern)
-	default:
-		return false
-	}
+	return compileCondition(Condition{Type: patternType, Pattern: pattern}).match(newMatchInput(url))
 }
 
 func matchGlob(url, pattern string) bool {
-	// Extract domain from URL for matching
-	domain := extractDomain(url)
-
-	// Simple glob matching: * matches any characters
-	pattern = strings.ReplaceAll(pattern, ".", "\\.")
-	pattern = strings.ReplaceAll(pattern, "*", ".*")
-	pattern = "^" + pattern + "$"
-
-	re, err := regexp.Compile(pattern)
+	re, err := compileGlob(pattern)
 	if err != nil {
 		return false
 	}
-
-	// Match against domain or full URL
-	return re.MatchString(domain) || re.MatchString(url)
+	return globMatcher{re: re}.match(newMatchInput(url))
 }
 
 func extractDomain(url string) string {
+	// mailto:, tel: and the like have no domain
+	if hasOpaqueScheme(url) {
+		return ""
+	}
+
 	// Remove protocol
 	u := url
 	if idx := strings.Index(u, "://"); idx != -1 {
@@ -240,7 +341,7 @@ func sanitizeURL(url string) string {
 	}
 
 	// If it already has a scheme, return as-is
-	if strings.Contains(url, "://") {
+	if strings.Contains(url, "://") || hasOpaqueScheme(url) {
 		return url
 	}
 
@@ -288,14 +389,15 @@ func exportConfig(cfg *Config, path string) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// load cfg from the specified path and replace current config
+// load cfg from the specified path and replace current config. Settings the
+// file leaves out get their defaults, as when the config is read.
 func importConfig(cfg *Config, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
-	newCfg := &Config{}
+	newCfg := defaultConfig()
 	if err := toml.Unmarshal(data, newCfg); err != nil {
 		return err
 	}
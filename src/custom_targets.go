@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CustomTarget is a command links can be opened with, like a video player or a
+// script, set up in the config because it isn't a detected browser.
+type CustomTarget struct {
+	ID      string `toml:"id"`             // rules refer to it as "custom:ID"
+	Name    string `toml:"name"`           // shown in the picker and settings
+	Icon    string `toml:"icon,omitempty"` // icon name or path
+	Command string `toml:"command"`        // program and arguments, quoted like in a shell, with placeholders
+}
+
+// customTargetPrefix starts the browser ID of a custom target in rules.
+const customTargetPrefix = "custom:"
+
+// customTargetIDPattern matches the IDs of custom targets.
+var customTargetIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// targetID returns the ID rules use to open links with the target.
+func (t *CustomTarget) targetID() string {
+	return customTargetPrefix + t.ID
+}
+
+// customTargets returns the custom targets as browsers, so they can be used
+// wherever detected browsers are.
+func (cfg *Config) customTargets() []*Browser {
+	targets := make([]*Browser, 0, len(cfg.Targets))
+	for i := range cfg.Targets {
+		t := &cfg.Targets[i]
+		name, icon := t.Name, t.Icon
+		if name == "" {
+			name = t.ID
+		}
+		if icon == "" {
+			icon = "application-x-executable"
+		}
+		targets = append(targets, &Browser{ID: t.targetID(), Name: name, Icon: icon, Command: t.Command})
+	}
+	return targets
+}
+
+// withCustomTargets returns the detected targets followed by the custom ones.
+func (cfg *Config) withCustomTargets(detected []*Browser) []*Browser {
+	return append(append([]*Browser(nil), detected...), cfg.customTargets()...)
+}
+
+// customCommand expands a custom target's command for a URL. The command is
+// split into arguments first, like a shell would, and placeholders are then
+// replaced within each argument, so a URL can never add arguments or run
+// other commands. extraArgs are added right after the program, and a program
+// starting with ~/ is looked up in the home directory.
+func customCommand(command, rawURL string, extraArgs []string) ([]string, error) {
+	templates, err := splitArgs(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("Command is empty")
+	}
+	if strings.Contains(templates[0], "{") {
+		return nil, fmt.Errorf("Program %q can't contain placeholders", templates[0])
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+
+	program := templates[0]
+	if rest, ok := strings.CutPrefix(program, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			program = filepath.Join(home, rest)
+		}
+	}
+
+	args := append([]string{program}, extraArgs...)
+	for _, template := range templates[1:] {
+		arg, err := expandCommandTemplate(template, u)
+		if err != nil {
+			return nil, err
+		}
+		// A link must not be able to turn an argument into an option
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(template, "-") {
+			return nil, fmt.Errorf("argument %q from the link would be read as an option", arg)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// expandCommandTemplate replaces the placeholders in one argument of a custom
+// target's command. Unlike in rewrite templates, query parameters are decoded.
+func expandCommandTemplate(template string, u *url.URL) (string, error) {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(template, '{')
+		if open == -1 {
+			b.WriteString(template)
+			return b.String(), nil
+		}
+		closing := strings.IndexByte(template[open:], '}')
+		if closing == -1 {
+			return "", fmt.Errorf("Unclosed { in command")
+		}
+		closing += open
+
+		name := template[open+1 : closing]
+		var value string
+		if param, ok := strings.CutPrefix(name, "query:"); ok && param != "" {
+			value = u.Query().Get(param)
+		} else {
+			var err error
+			if value, err = templateValue(name, u); err != nil {
+				return "", err
+			}
+		}
+		b.WriteString(template[:open])
+		b.WriteString(value)
+		template = template[closing+1:]
+	}
+}
+
+// validateCustomTarget checks if a custom target has a valid ID and a command
+// with known placeholders.
+func validateCustomTarget(t CustomTarget) error {
+	if !customTargetIDPattern.MatchString(t.ID) {
+		return fmt.Errorf("Target ID %q must start with a letter or digit and only contain letters, digits, '.', '_' and '-'", t.ID)
+	}
+	if _, err := customCommand(t.Command, "https://example.com/path?q=1", nil); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCustomCommand tests expanding custom target commands without a shell
+func TestCustomCommand(t *testing.T) {
+	t.Setenv("HOME", "/home/alice")
+
+	tests := []struct {
+		name      string
+		command   string
+		url       string
+		extraArgs []string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:    "url",
+			command: "mpv --force-window {url}",
+			url:     "https://www.youtube.com/watch?v=abc",
+			want:    []string{"mpv", "--force-window", "https://www.youtube.com/watch?v=abc"},
+		},
+		{
+			name:    "host, path and decoded query parameter",
+			command: `~/bin/checkout-pr "{host}" {path} --branch={query:branch}`,
+			url:     "https://github.com/owner/repo/pull/12?branch=fix%2Fa+b",
+			want:    []string{"/home/alice/bin/checkout-pr", "github.com", "/owner/repo/pull/12", "--branch=fix/a b"},
+		},
+		{
+			name:      "extra args after the program",
+			command:   "yt-dlp -o '%(title)s.%(ext)s' {url}",
+			url:       "https://example.com/v",
+			extraArgs: []string{"--quiet"},
+			want:      []string{"yt-dlp", "--quiet", "-o", "%(title)s.%(ext)s", "https://example.com/v"},
+		},
+		{
+			name:    "shell syntax in the link stays in one argument",
+			command: "echo {url} {query:q}",
+			url:     "https://example.com/a;rm%20-rf%20~?q=$(reboot)%20`id`",
+			want:    []string{"echo", "https://example.com/a;rm%20-rf%20~?q=$(reboot)%20`id`", "$(reboot) `id`"},
+		},
+		{
+			name:    "missing query parameter",
+			command: "open-ticket {query:id}",
+			url:     "https://example.com/",
+			want:    []string{"open-ticket", ""},
+		},
+		{name: "option from the link", command: "git checkout {query:branch}", url: "https://example.com/?branch=--orphan", wantErr: true},
+		{name: "unknown placeholder", command: "mpv {title}", url: "https://example.com/", wantErr: true},
+		{name: "unclosed placeholder", command: "mpv {url", url: "https://example.com/", wantErr: true},
+		{name: "placeholder in program", command: "{host} {url}", url: "https://example.com/", wantErr: true},
+		{name: "empty", command: "  ", url: "https://example.com/", wantErr: true},
+		{name: "unterminated quote", command: `mpv "{url}`, url: "https://example.com/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := customCommand(tt.command, tt.url, tt.extraArgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("customCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("customCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateCustomTarget tests checking custom targets in the config
+func TestValidateCustomTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  CustomTarget
+		wantErr bool
+	}{
+		{name: "valid", target: CustomTarget{ID: "mpv", Name: "mpv", Command: "mpv {url}"}},
+		{name: "dotted ID", target: CustomTarget{ID: "io.mpv.Mpv", Command: "flatpak run io.mpv.Mpv {url}"}},
+		{name: "no ID", target: CustomTarget{Command: "mpv {url}"}, wantErr: true},
+		{name: "ID with colon", target: CustomTarget{ID: "a:b", Command: "mpv {url}"}, wantErr: true},
+		{name: "no command", target: CustomTarget{ID: "mpv"}, wantErr: true},
+		{name: "unknown placeholder", target: CustomTarget{ID: "mpv", Command: "mpv {link}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCustomTarget(tt.target); (err != nil) != tt.wantErr {
+				t.Errorf("validateCustomTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfigWithCustomTargets tests that custom targets are listed after detected browsers
+func TestConfigWithCustomTargets(t *testing.T) {
+	cfg := &Config{Targets: []CustomTarget{
+		{ID: "mpv", Name: "Video Player", Icon: "mpv", Command: "mpv {url}"},
+		{ID: "script", Command: "/usr/local/bin/script {url}"},
+	}}
+	detected := []*Browser{{ID: "firefox.desktop", Name: "Firefox"}}
+
+	targets := cfg.withCustomTargets(detected)
+
+	want := []*Browser{
+		{ID: "firefox.desktop", Name: "Firefox"},
+		{ID: "custom:mpv", Name: "Video Player", Icon: "mpv", Command: "mpv {url}"},
+		{ID: "custom:script", Name: "script", Icon: "application-x-executable", Command: "/usr/local/bin/script {url}"},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("withCustomTargets() = %+v, want %+v", targets, want)
+	}
+	if len(detected) != 1 {
+		t.Error("withCustomTargets() changed the detected browsers")
+	}
+}
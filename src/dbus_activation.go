@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dbusApplicationInterface is the interface D-Bus activatable apps implement,
+// see the "D-Bus Activation" section of the Desktop Entry spec.
+const dbusApplicationInterface = "org.freedesktop.Application"
+
+// dbusNamePattern matches well-known bus names: at least two elements of
+// letters, digits, '_' and '-', none starting with a digit.
+var dbusNamePattern = regexp.MustCompile(`^[A-Za-z_-][A-Za-z0-9_-]*(\.[A-Za-z_-][A-Za-z0-9_-]*)+$`)
+
+// dbusName returns the bus name the app is launched with when its desktop file
+// sets DBusActivatable, its desktop file ID without .desktop. It's empty if the
+// app isn't D-Bus activatable, or its ID isn't a bus name.
+func (e *desktopEntry) dbusName() string {
+	if !e.boolValue(desktopEntryGroup, "DBusActivatable") {
+		return ""
+	}
+	name, ok := strings.CutSuffix(e.ID, ".desktop")
+	if !ok || len(name) > 255 || !dbusNamePattern.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// dbusObjectPath returns the object path an app implements
+// org.freedesktop.Application at: its bus name with '.' replaced by '/' and
+// '-' by '_'.
+func dbusObjectPath(busName string) string {
+	return "/" + strings.NewReplacer(".", "/", "-", "_").Replace(busName)
+}
+
+// dbusPlatformData returns the platform_data of an Open call, which passes the
+// activation token along so the app can raise its window, under both the
+// Wayland and the X11 startup notification keys.
+func dbusPlatformData(activationToken string) map[string]string {
+	if activationToken == "" {
+		return map[string]string{}
+	}
+	return map[string]string{
+		"activation-token":   activationToken,
+		"desktop-startup-id": activationToken,
+	}
+}
+
+// usesDBus reports whether a launch goes through D-Bus activation. Extra
+// arguments and environment variables can only be passed on the command line,
+// so launches that need them run the Exec line instead.
+func (entry execEntry) usesDBus(extraArgs, env []string) bool {
+	return entry.DBus != "" && len(extraArgs) == 0 && len(env) == 0
+}
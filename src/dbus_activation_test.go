@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDesktopEntryDBusName tests which desktop files are launched over D-Bus
+func TestDesktopEntryDBusName(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		keys string
+		want string
+	}{
+		{name: "activatable", id: "org.gnome.Epiphany.desktop", keys: "DBusActivatable=true\n", want: "org.gnome.Epiphany"},
+		{name: "dashes", id: "org.example.my-browser.desktop", keys: "DBusActivatable=true\n", want: "org.example.my-browser"},
+		{name: "not activatable", id: "org.gnome.Epiphany.desktop", keys: "DBusActivatable=false\n", want: ""},
+		{name: "no key", id: "org.gnome.Epiphany.desktop", keys: "", want: ""},
+		{name: "single element", id: "firefox.desktop", keys: "DBusActivatable=true\n", want: ""},
+		{name: "element starting with a digit", id: "org.7zip.App.desktop", keys: "DBusActivatable=true\n", want: ""},
+		{name: "no .desktop suffix", id: "org.gnome.Epiphany", keys: "DBusActivatable=true\n", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseDesktopEntry([]byte("[Desktop Entry]\nName=App\nExec=app %U\n" + tt.keys))
+			if err != nil {
+				t.Fatalf("parseDesktopEntry() error = %v", err)
+			}
+			e.ID = tt.id
+			if got := e.dbusName(); got != tt.want {
+				t.Errorf("dbusName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDBusObjectPath tests the object path of org.freedesktop.Application
+func TestDBusObjectPath(t *testing.T) {
+	tests := []struct {
+		busName string
+		want    string
+	}{
+		{busName: "org.gnome.Epiphany", want: "/org/gnome/Epiphany"},
+		{busName: "org.example.my-browser", want: "/org/example/my_browser"},
+	}
+	for _, tt := range tests {
+		if got := dbusObjectPath(tt.busName); got != tt.want {
+			t.Errorf("dbusObjectPath(%q) = %q, want %q", tt.busName, got, tt.want)
+		}
+	}
+}
+
+// TestDBusPlatformData tests passing the activation token in platform_data
+func TestDBusPlatformData(t *testing.T) {
+	want := map[string]string{"activation-token": "token", "desktop-startup-id": "token"}
+	if got := dbusPlatformData("token"); !reflect.DeepEqual(got, want) {
+		t.Errorf("dbusPlatformData() = %v, want %v", got, want)
+	}
+	if got := dbusPlatformData(""); len(got) != 0 {
+		t.Errorf("dbusPlatformData(\"\") = %v, want empty", got)
+	}
+}
+
+// TestExecEntryUsesDBus tests when launches go through D-Bus activation
+func TestExecEntryUsesDBus(t *testing.T) {
+	entry := execEntry{Exec: "epiphany %U", DBus: "org.gnome.Epiphany"}
+	tests := []struct {
+		name      string
+		entry     execEntry
+		extraArgs []string
+		env       []string
+		want      bool
+	}{
+		{name: "activatable", entry: entry, want: true},
+		{name: "not activatable", entry: execEntry{Exec: "firefox %u"}, want: false},
+		{name: "extra arguments", entry: entry, extraArgs: []string{"--private-instance"}, want: false},
+		{name: "environment", entry: entry, env: []string{"LANG=C"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.usesDBus(tt.extraArgs, tt.env); got != tt.want {
+			t.Errorf("%s: usesDBus() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
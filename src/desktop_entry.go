@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// desktopEntryGroup is the main group of a desktop file.
+const desktopEntryGroup = "Desktop Entry"
+
+// Desktop file actions have IDs, names, and exec commands.
+type DesktopAction struct {
+	ID   string // action ID (e.g., "new-private-window")
+	Name string // display name in the user's language (e.g., "New Private Window")
+	Icon string // icon name or path, if the action has its own
+	Exec string // Exec command line for this action, see parseExec
+}
+
+// desktopEntry is a parsed desktop file, following the Desktop Entry spec's
+// key file format. AppInfo doesn't expose actions or the raw keys, so we parse
+// desktop files ourselves instead of binding g_desktop_app_info with Cgo.
+type desktopEntry struct {
+	ID     string                       // desktop file ID, e.g. "firefox.desktop"
+	Path   string                       // where the file was found
+	groups map[string]map[string]string // group name → key, with its locale, → raw value
+}
+
+// parseDesktopEntry parses the groups and keys of a desktop file. Comments and
+// blank lines are skipped, and lines ending in a backslash continue on the next
+// line. Keys before the first group and repeated groups are errors, as in GLib.
+func parseDesktopEntry(data []byte) (*desktopEntry, error) {
+	e := &desktopEntry{groups: make(map[string]map[string]string)}
+	var group map[string]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		for continuesLine(line) && scanner.Scan() {
+			lineNum++
+			line = line[:len(line)-1] + strings.TrimLeft(scanner.Text(), " \t")
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated group header", lineNum)
+			}
+			name := line[1 : len(line)-1]
+			if _, ok := e.groups[name]; ok {
+				return nil, fmt.Errorf("line %d: group [%s] is repeated", lineNum, name)
+			}
+			group = make(map[string]string)
+			e.groups[name] = group
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+			}
+			if group == nil {
+				return nil, fmt.Errorf("line %d: key outside of a group", lineNum)
+			}
+			// The first value of a repeated key wins, like in GLib
+			key = strings.TrimSpace(key)
+			if _, ok := group[key]; !ok {
+				group[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := e.groups[desktopEntryGroup]; !ok {
+		return nil, fmt.Errorf("no [%s] group", desktopEntryGroup)
+	}
+	return e, nil
+}
+
+// continuesLine reports whether a line ends in a backslash that isn't itself escaped.
+func continuesLine(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// loadDesktopEntry finds a desktop file by ID and parses it.
+func loadDesktopEntry(id string) (*desktopEntry, error) {
+	path := findDesktopFile(id)
+	if path == "" {
+		return nil, fmt.Errorf("desktop file %s not found", id)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e, err := parseDesktopEntry(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	e.ID, e.Path = id, path
+	return e, nil
+}
+
+// rawValue returns a key's value as written in the file, and whether it's set.
+func (e *desktopEntry) rawValue(group, key string) (string, bool) {
+	value, ok := e.groups[group][key]
+	return value, ok
+}
+
+// value returns a string key with its escapes processed.
+func (e *desktopEntry) value(group, key string) string {
+	value, _ := e.rawValue(group, key)
+	return unescapeDesktopString(value)
+}
+
+// localeValue returns a localestring key in the user's language, falling back
+// to less specific locales and then the untranslated value.
+func (e *desktopEntry) localeValue(group, key, locale string) string {
+	for _, l := range localeVariants(locale) {
+		if value, ok := e.rawValue(group, key+"["+l+"]"); ok {
+			return unescapeDesktopString(value)
+		}
+	}
+	return e.value(group, key)
+}
+
+// boolValue returns a boolean key, false if it isn't set.
+func (e *desktopEntry) boolValue(group, key string) bool {
+	value, _ := e.rawValue(group, key)
+	return value == "true"
+}
+
+// listValue returns a key holding a list of strings separated by semicolons,
+// in which \; is a literal semicolon.
+func (e *desktopEntry) listValue(group, key string) []string {
+	value, _ := e.rawValue(group, key)
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ';':
+			item.WriteByte(';')
+			i++
+		case value[i] == '\\' && i+1 < len(value):
+			item.WriteString(value[i : i+2]) // other escapes are processed below
+			i++
+		case value[i] == ';':
+			items = append(items, unescapeDesktopString(item.String()))
+			item.Reset()
+		default:
+			item.WriteByte(value[i])
+		}
+	}
+	if item.Len() > 0 {
+		items = append(items, unescapeDesktopString(item.String()))
+	}
+	return items
+}
+
+// name returns the entry's name in the user's language.
+func (e *desktopEntry) name(locale string) string {
+	return e.localeValue(desktopEntryGroup, "Name", locale)
+}
+
+// exec returns the entry's Exec key, see parseExec.
+func (e *desktopEntry) exec() string {
+	return e.value(desktopEntryGroup, "Exec")
+}
+
+// shouldShow reports whether the entry is meant to be shown: it isn't Hidden
+// (deleted) or NoDisplay, and the program named by TryExec is installed.
+// TryExec isn't checked in Flatpak, where host programs aren't visible.
+func (e *desktopEntry) shouldShow() bool {
+	if e.boolValue(desktopEntryGroup, "Hidden") || e.boolValue(desktopEntryGroup, "NoDisplay") {
+		return false
+	}
+	tryExec := e.value(desktopEntryGroup, "TryExec")
+	if tryExec == "" || os.Getenv("FLATPAK_ID") != "" {
+		return true
+	}
+	_, err := exec.LookPath(tryExec)
+	return err == nil
+}
+
+// actions returns the entry's desktop actions in the order of its Actions key.
+// Actions without a group, a name or an Exec key are skipped, unless the app
+// is D-Bus activatable, where actions don't need an Exec key.
+//
+// Actions aren't required to take URLs (%u or %U): many Chromium-based browsers
+// don't declare it, and some Firefox-based browsers accept URLs anyway. It looks
+// less polished for the user, but works in more cases.
+func (e *desktopEntry) actions(locale string) []DesktopAction {
+	dbus := e.boolValue(desktopEntryGroup, "DBusActivatable")
+
+	var actions []DesktopAction
+	for _, id := range e.listValue(desktopEntryGroup, "Actions") {
+		group := "Desktop Action " + id
+		if _, ok := e.groups[group]; !ok {
+			continue
+		}
+		action := DesktopAction{
+			ID:   id,
+			Name: e.localeValue(group, "Name", locale),
+			Icon: e.localeValue(group, "Icon", locale),
+			Exec: e.value(group, "Exec"),
+		}
+		if action.Name == "" || (action.Exec == "" && !dbus) {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// messagesLocale returns the user's locale for messages, as POSIX looks it up.
+func messagesLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// localeVariants returns the locale keys to try for a locale of the form
+// lang_COUNTRY.ENCODING@MODIFIER, most specific first, as the spec says.
+// The encoding is ignored.
+func localeVariants(locale string) []string {
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	rest, modifier, hasModifier := strings.Cut(locale, "@")
+	rest, _, _ = strings.Cut(rest, ".")
+	lang, country, hasCountry := strings.Cut(rest, "_")
+
+	var variants []string
+	if hasCountry && hasModifier {
+		variants = append(variants, lang+"_"+country+"@"+modifier)
+	}
+	if hasCountry {
+		variants = append(variants, lang+"_"+country)
+	}
+	if hasModifier {
+		variants = append(variants, lang+"@"+modifier)
+	}
+	return append(variants, lang)
+}
+
+// desktopDataDirs returns the directories desktop files are looked up in,
+// most important first, following the XDG Base Directory spec, plus the
+// Flatpak export directories.
+func desktopDataDirs() []string {
+	var dataDirs []string
+
+	// XDG_DATA_HOME (default: ~/.local/share)
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = os.Getenv("HOME") + "/.local/share"
+	}
+	dataDirs = append(dataDirs, dataHome)
+
+	// XDG_DATA_DIRS (default: /usr/local/share:/usr/share)
+	dataDirsEnv := os.Getenv("XDG_DATA_DIRS")
+	if dataDirsEnv == "" {
+		dataDirsEnv = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range strings.Split(dataDirsEnv, ":") {
+		if dir != "" {
+			dataDirs = append(dataDirs, dir)
+		}
+	}
+
+	// Add Flatpak-specific locations
+	dataDirs = append(dataDirs, "/var/lib/flatpak/exports/share")
+	if home := os.Getenv("HOME"); home != "" {
+		dataDirs = append(dataDirs, home+"/.local/share/flatpak/exports/share")
+	}
+	return dataDirs
+}
+
+// findDesktopFile locates a desktop file by ID. Desktop file IDs are paths
+// relative to an applications directory with "/" replaced by "-", so
+// "kde-foo.desktop" may be applications/kde/foo.desktop. The first data
+// directory that has the ID wins.
+func findDesktopFile(appID string) string {
+	if appID == "" || strings.Contains(appID, "/") {
+		return ""
+	}
+	for _, dataDir := range desktopDataDirs() {
+		if path := findDesktopFileIn(filepath.Join(dataDir, "applications"), appID); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// findDesktopFileIn looks for a desktop file ID in dir, trying each "-" in
+// it as a subdirectory separator.
+func findDesktopFileIn(dir, id string) string {
+	path := filepath.Join(dir, id)
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return path
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] != '-' {
+			continue
+		}
+		sub := filepath.Join(dir, id[:i])
+		if info, err := os.Stat(sub); err == nil && info.IsDir() {
+			if path := findDesktopFileIn(sub, id[i+1:]); path != "" {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// unescapeDesktopString processes the escapes of a desktop file's string
+// values: \s, \n, \t, \r and \\. Other backslashes are kept as they are.
+func unescapeDesktopString(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testDesktopFile = `# Firefox's desktop file
+[Desktop Entry]
+Version=1.0
+Name=Firefox
+Name[de]=Firefox-Browser
+Name[sr@latin]=Firefox (latinica)
+Name[pt_BR]=Navegador Firefox
+Exec = firefox %u
+Icon=firefox
+Keywords=web;browser\;internet;
+Actions=new-private-window;new-window;missing;no-exec;
+
+[Desktop Action new-window]
+Name=New Window
+Name[de]=Neues Fenster
+Exec=firefox --new-window %u
+
+[Desktop Action new-private-window]
+Name=New Private\sWindow
+Icon=firefox-private
+Exec=firefox \
+  --private-window %u
+
+[Desktop Action no-exec]
+Name=No Exec
+
+[Desktop Action not-listed]
+Name=Not Listed
+Exec=firefox --not-listed
+`
+
+// TestParseDesktopEntry tests reading keys, localized keys and lists
+func TestParseDesktopEntry(t *testing.T) {
+	e, err := parseDesktopEntry([]byte(testDesktopFile))
+	if err != nil {
+		t.Fatalf("parseDesktopEntry() error = %v", err)
+	}
+
+	if got := e.exec(); got != "firefox %u" {
+		t.Errorf("exec() = %q, want %q", got, "firefox %u")
+	}
+	if got := e.value(desktopEntryGroup, "Missing"); got != "" {
+		t.Errorf("value(Missing) = %q, want empty", got)
+	}
+	if got, want := e.listValue(desktopEntryGroup, "Keywords"), []string{"web", "browser;internet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listValue(Keywords) = %q, want %q", got, want)
+	}
+	if got := e.value("Desktop Action new-private-window", "Exec"); got != "firefox --private-window %u" {
+		t.Errorf("continued Exec = %q, want %q", got, "firefox --private-window %u")
+	}
+
+	names := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "", want: "Firefox"},
+		{locale: "C", want: "Firefox"},
+		{locale: "de_DE.UTF-8", want: "Firefox-Browser"},
+		{locale: "de", want: "Firefox-Browser"},
+		{locale: "pt_BR.UTF-8", want: "Navegador Firefox"},
+		{locale: "pt_PT", want: "Firefox"},
+		{locale: "sr_RS.UTF-8@latin", want: "Firefox (latinica)"},
+		{locale: "sr_RS", want: "Firefox"},
+		{locale: "fr_FR", want: "Firefox"},
+	}
+	for _, tt := range names {
+		if got := e.name(tt.locale); got != tt.want {
+			t.Errorf("name(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+// TestDesktopEntryActions tests that actions follow the Actions key and skip incomplete ones
+func TestDesktopEntryActions(t *testing.T) {
+	e, err := parseDesktopEntry([]byte(testDesktopFile))
+	if err != nil {
+		t.Fatalf("parseDesktopEntry() error = %v", err)
+	}
+
+	want := []DesktopAction{
+		{ID: "new-private-window", Name: "New Private Window", Icon: "firefox-private", Exec: "firefox --private-window %u"},
+		{ID: "new-window", Name: "Neues Fenster", Exec: "firefox --new-window %u"},
+	}
+	if got := e.actions("de_AT"); !reflect.DeepEqual(got, want) {
+		t.Errorf("actions() = %+v, want %+v", got, want)
+	}
+
+	// D-Bus activatable apps can have actions without an Exec key
+	dbus, err := parseDesktopEntry([]byte("[Desktop Entry]\nName=App\nDBusActivatable=true\nActions=open;\n[Desktop Action open]\nName=Open\n"))
+	if err != nil {
+		t.Fatalf("parseDesktopEntry() error = %v", err)
+	}
+	if got := dbus.actions(""); len(got) != 1 || got[0].ID != "open" {
+		t.Errorf("D-Bus actions() = %+v, want the open action", got)
+	}
+}
+
+// TestParseDesktopEntryErrors tests files that aren't valid desktop entries
+func TestParseDesktopEntryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "key outside of a group", data: "Name=Firefox\n[Desktop Entry]\n"},
+		{name: "line without =", data: "[Desktop Entry]\nName\n"},
+		{name: "unterminated group", data: "[Desktop Entry\nName=Firefox\n"},
+		{name: "repeated group", data: "[Desktop Entry]\n[Desktop Entry]\n"},
+		{name: "no Desktop Entry group", data: "[Other]\nName=Firefox\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseDesktopEntry([]byte(tt.data)); err == nil {
+				t.Errorf("parseDesktopEntry(%q) succeeded, want an error", tt.data)
+			}
+		})
+	}
+}
+
+// TestDesktopEntryShouldShow tests Hidden, NoDisplay and TryExec
+func TestDesktopEntryShouldShow(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	tests := []struct {
+		name string
+		keys string
+		want bool
+	}{
+		{name: "plain", keys: "", want: true},
+		{name: "hidden", keys: "Hidden=true\n", want: false},
+		{name: "no display", keys: "NoDisplay=true\n", want: false},
+		{name: "not hidden", keys: "Hidden=false\n", want: true},
+		{name: "installed TryExec", keys: "TryExec=sh\n", want: true},
+		{name: "missing TryExec", keys: "TryExec=switchyard-no-such-program\n", want: false},
+		{name: "missing absolute TryExec", keys: "TryExec=/nonexistent/browser\n", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseDesktopEntry([]byte("[Desktop Entry]\nName=App\n" + tt.keys))
+			if err != nil {
+				t.Fatalf("parseDesktopEntry() error = %v", err)
+			}
+			if got := e.shouldShow(); got != tt.want {
+				t.Errorf("shouldShow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFindDesktopFile tests resolving desktop file IDs in subdirectories and data directory order
+func TestFindDesktopFile(t *testing.T) {
+	home, system := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", home)
+	t.Setenv("XDG_DATA_DIRS", system)
+
+	write := func(dir, rel string) string {
+		path := filepath.Join(dir, "applications", rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("[Desktop Entry]\nName="+rel+"\nExec=browser %u\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	flat := write(system, "firefox.desktop")
+	kde := write(system, "kde/foo.desktop")
+	nested := write(system, "org/example-app/browser.desktop")
+	override := write(home, "chromium.desktop")
+	write(system, "chromium.desktop")
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "firefox.desktop", want: flat},
+		{id: "kde-foo.desktop", want: kde},
+		{id: "org-example-app-browser.desktop", want: nested},
+		{id: "chromium.desktop", want: override},
+		{id: "kde-bar.desktop", want: ""},
+		{id: "kde/foo.desktop", want: ""},
+		{id: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := findDesktopFile(tt.id); got != tt.want {
+			t.Errorf("findDesktopFile(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	e, err := loadDesktopEntry("kde-foo.desktop")
+	if err != nil {
+		t.Fatalf("loadDesktopEntry() error = %v", err)
+	}
+	if e.ID != "kde-foo.desktop" || e.Path != kde || e.name("") != "kde/foo.desktop" {
+		t.Errorf("loadDesktopEntry() = %q at %q named %q", e.ID, e.Path, e.name(""))
+	}
+	if _, err := loadDesktopEntry("missing.desktop"); err == nil {
+		t.Error("loadDesktopEntry(missing.desktop) succeeded, want an error")
+	}
+}
+
+// TestUnescapeDesktopString tests the string escapes of desktop files
+func TestUnescapeDesktopString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "firefox %u", want: "firefox %u"},
+		{input: `a\sb\tc\nd\re`, want: "a b\tc\nd\re"},
+		{input: `"C:\\\\path"`, want: `"C:\\path"`},
+		{input: `\\s`, want: `\s`},
+		{input: `\x`, want: `\x`},
+		{input: `end\`, want: `end\`},
+	}
+	for _, tt := range tests {
+		if got := unescapeDesktopString(tt.input); got != tt.want {
+			t.Errorf("unescapeDesktopString(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -3,8 +3,6 @@
 package main
 
 import (
-	"regexp"
-
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
@@ -45,10 +43,7 @@ func showEditConditionDialog(parent *adw.Window, cond *Condition, onSave func())
 	group := adw.NewPreferencesGroup()
 
 	// Type row
-	typeRow := adw.NewComboRow()
-	typeRow.SetTitle("Match Type")
-	typeRow.SetModel(gtk.NewStringList([]string{"Exact Domain", "URL Contains", "Wildcard", "Regex"}))
-	typeRow.SetSelected(conditionTypeToIndex(cond.Type))
+	typeRow := conditionTypeComboRow("Match Type", cond.Type)
 	group.Add(typeRow)
 
 	// Pattern row
@@ -106,15 +101,13 @@ func showEditConditionDialog(parent *adw.Window, cond *Condition, onSave func())
 		}
 
 		// Final validation
-		selectedType := typeRow.Selected()
-		if selectedType == 3 { // Regex
-			if _, err := regexp.Compile(pattern); err != nil {
-				return
-			}
+		condType := indexToConditionType(typeRow.Selected())
+		if err := validateConditionPattern(condType, pattern); err != nil {
+			return
 		}
 
 		// Update condition
-		cond.Type = indexToConditionType(selectedType)
+		cond.Type = condType
 		cond.Pattern = pattern
 
 		onSave()
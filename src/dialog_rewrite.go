@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"strings"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// showRewriteDialog displays the add/edit rewrite dialog. rewrite is nil when
+// adding a new rewrite.
+func showRewriteDialog(parent *adw.Window, cfg *Config, rewrite *Rewrite, rebuildRewritesList func()) {
+	title, actionLabel := "Add Rewrite", "Add"
+	initial := Rewrite{StripParams: []string{"utm_*", "fbclid", "gclid"}}
+	if rewrite != nil {
+		title, actionLabel = "Edit Rewrite", "Save"
+		initial = *rewrite
+	}
+
+	var dialog *adw.Dialog
+	header, actionBtn := dialogHeader("Cancel", actionLabel, func() { dialog.Close() }, nil)
+	dialog, content, _ := dialogWithToolbar(title, 600, 650, header)
+
+	// Name section
+	nameGroup := adw.NewPreferencesGroup()
+	nameGroup.SetTitle("Rewrite Name")
+	nameGroup.SetDescription("Give this rewrite a descriptive name (optional)")
+
+	nameEntry := adw.NewEntryRow()
+	nameEntry.SetTitle("Name")
+	nameEntry.SetText(initial.Name)
+	nameGroup.Add(nameEntry)
+	content.Append(nameGroup)
+
+	// Rewrite section
+	rewriteGroup := adw.NewPreferencesGroup()
+	rewriteGroup.SetTitle("Rewrite")
+	rewriteGroup.SetDescription("Query parameters are removed first, then the template builds the new URL")
+
+	stripEntry := adw.NewEntryRow()
+	stripEntry.SetTitle("Remove Query Parameters")
+	stripEntry.SetText(strings.Join(initial.StripParams, ", "))
+	stripEntry.SetTooltipText("Comma-separated parameter names, * matches any characters")
+	rewriteGroup.Add(stripEntry)
+
+	templateEntry := adw.NewEntryRow()
+	templateEntry.SetTitle("New URL Template (optional)")
+	templateEntry.SetText(initial.Template)
+	rewriteGroup.Add(templateEntry)
+
+	placeholders := make([]string, len(rewritePlaceholders))
+	for i, p := range rewritePlaceholders {
+		placeholders[i] = p.Name + " " + p.Description
+	}
+	placeholderRow := adw.NewExpanderRow()
+	placeholderRow.SetTitle("Template Placeholders")
+	placeholderRow.SetSubtitle("e.g. https://old.reddit.com{path}{?query}")
+	placeholderLabel := gtk.NewLabel(strings.Join(placeholders, "\n"))
+	placeholderLabel.SetXAlign(0)
+	placeholderLabel.SetSelectable(true)
+	placeholderLabel.AddCSSClass("dim-label")
+	placeholderLabel.SetMarginStart(12)
+	placeholderLabel.SetMarginEnd(12)
+	placeholderLabel.SetMarginTop(8)
+	placeholderLabel.SetMarginBottom(8)
+	placeholderRow.AddRow(placeholderLabel)
+	rewriteGroup.Add(placeholderRow)
+
+	content.Append(rewriteGroup)
+
+	// Conditions section - rewrites without conditions apply to every URL
+	root := initial.conditionGroup().clone()
+	limited := !root.isEmpty()
+	if !limited {
+		root = ConditionGroup{Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: ""}}}
+	}
+
+	conditionsGroup := adw.NewPreferencesGroup()
+	conditionsGroup.SetTitle("Conditions")
+	conditionsGroup.SetDescription("Choose which URLs are rewritten")
+
+	limitRow := adw.NewSwitchRow()
+	limitRow.SetTitle("Only Rewrite Matching URLs")
+	limitRow.SetSubtitle("Otherwise every URL is rewritten")
+	limitRow.SetActive(limited)
+	conditionsGroup.Add(limitRow)
+	content.Append(conditionsGroup)
+
+	// Preview section
+	previewGroup := adw.NewPreferencesGroup()
+	previewGroup.SetTitle("Preview")
+
+	exampleEntry := adw.NewEntryRow()
+	exampleEntry.SetTitle("Example URL")
+	exampleEntry.SetText("https://www.example.com/page?utm_source=newsletter&id=42")
+	previewGroup.Add(exampleEntry)
+
+	resultRow := adw.NewActionRow()
+	resultRow.SetTitle("Result")
+	resultRow.SetSubtitleSelectable(true)
+	previewGroup.Add(resultRow)
+
+	// draft builds a rewrite from the current state of the dialog
+	draft := func() Rewrite {
+		rw := Rewrite{
+			Name:     nameEntry.Text(),
+			Template: strings.TrimSpace(templateEntry.Text()),
+		}
+		for _, param := range strings.Split(stripEntry.Text(), ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				rw.StripParams = append(rw.StripParams, param)
+			}
+		}
+		if limitRow.Active() {
+			rw.setConditionGroup(root)
+		}
+		return rw
+	}
+
+	updateValidation := func() {
+		rw := draft()
+		err := validateRewrite(rw)
+		actionBtn.SetSensitive(err == nil && (!limitRow.Active() || isConditionGroupValid(root)))
+
+		if rw.Template != "" && validateRewriteTemplate(rw.Template) != nil {
+			templateEntry.AddCSSClass("error")
+		} else {
+			templateEntry.RemoveCSSClass("error")
+		}
+
+		example := sanitizeURL(exampleEntry.Text())
+		group := rw.conditionGroup()
+		switch {
+		case err != nil:
+			resultRow.SetSubtitle(err.Error())
+		case example == "":
+			resultRow.SetSubtitle("")
+		case group.isEmpty() || compileGroup(group).match(newMatchInput(example)):
+			resultRow.SetSubtitle(applyRewrites([]Rewrite{rw}, example, nil))
+		default:
+			resultRow.SetSubtitle("Not rewritten, the conditions don't match")
+		}
+	}
+
+	conditionsEditor := createConditionTreeEditor(&root, updateValidation)
+	conditionsBox := gtk.NewBox(gtk.OrientationVertical, 0)
+	conditionsBox.SetMarginTop(12)
+	conditionsBox.Append(conditionsEditor)
+	conditionsBox.SetVisible(limited)
+	conditionsGroup.Add(conditionsBox)
+
+	content.Append(previewGroup)
+
+	limitRow.Connect("notify::active", func() {
+		conditionsBox.SetVisible(limitRow.Active())
+		updateValidation()
+	})
+	for _, entry := range []*adw.EntryRow{nameEntry, stripEntry, templateEntry, exampleEntry} {
+		entry.Connect("changed", updateValidation)
+	}
+	updateValidation()
+
+	actionBtn.ConnectClicked(func() {
+		rw := draft()
+		if validateRewrite(rw) != nil {
+			return
+		}
+		if rewrite != nil {
+			*rewrite = rw
+		} else {
+			cfg.Rewrites = append(cfg.Rewrites, rw)
+		}
+		saveConfigWithFlag(cfg)
+		rebuildRewritesList()
+		dialog.Close()
+	})
+
+	dialog.Present(parent)
+}
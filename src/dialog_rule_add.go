@@ -7,8 +7,9 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
-// showAddRuleDialog displays the add rule dialog.
-func showAddRuleDialog(parent *adw.Window, cfg *Config, browsers []*Browser, rebuildRulesList func()) {
+// showAddRuleDialog displays the add rule dialog. If template is not nil, the
+// dialog starts with its name and conditions.
+func showAddRuleDialog(parent *adw.Window, cfg *Config, browsers []*Browser, template *Rule, rebuildRulesList func()) {
 	dialog := adw.NewDialog()
 	dialog.SetTitle("Add Rule")
 	dialog.SetContentWidth(600)
@@ -38,7 +39,7 @@ func showAddRuleDialog(parent *adw.Window, cfg *Config, browsers []*Browser, reb
 	scrolledWindow.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
 	scrolledWindow.SetVExpand(true)
 
-	nameEntry, conditions, logicRow, alwaysAskRow, browserRow, content := buildRuleDialogContent(nil, browsers, addBtn)
+	nameEntry, root, alwaysAskRow, notifyRow, browserRow, readLaunch, readFallbacks, content := buildRuleDialogContent(template, browsers, addBtn)
 
 	scrolledWindow.SetChild(content)
 	toolbarView.SetContent(scrolledWindow)
@@ -47,18 +48,26 @@ func showAddRuleDialog(parent *adw.Window, cfg *Config, browsers []*Browser, reb
 	addBtn.ConnectClicked(func() {
 		browserIdx := browserRow.Selected()
 
-		if len(*conditions) > 0 && int(browserIdx) < len(browsers) {
-			if !validateConditions(*conditions) {
+		if int(browserIdx) < len(browsers) {
+			if !isConditionGroupValid(*root) {
+				return
+			}
+			launch, ok := readLaunch()
+			if !ok {
 				return
 			}
 
 			rule := Rule{
-				Name:       nameEntry.Text(),
-				Conditions: *conditions,
-				Logic:      getLogicFromComboRow(logicRow),
-				Browser:    browsers[browserIdx].ID,
-				AlwaysAsk:  alwaysAskRow.Active(),
+				Name:      nameEntry.Text(),
+				Browser:   browsers[browserIdx].ID,
+				Action:    launch.Action,
+				Args:      launch.Args,
+				Env:       launch.Env,
+				Fallbacks: readFallbacks(),
+				AlwaysAsk: alwaysAskRow.Active(),
+				Quiet:     !notifyRow.Active(),
 			}
+			rule.setRootGroup(*root)
 			cfg.Rules = append(cfg.Rules, rule)
 			saveConfigWithFlag(cfg)
 			rebuildRulesList()
@@ -3,7 +3,13 @@
 package main
 
 import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 )
 
@@ -14,10 +20,12 @@ func buildRuleDialogContent(
 	actionBtn *gtk.Button,
 ) (
 	nameEntry *adw.EntryRow,
-	conditions *[]Condition,
-	logicRow *adw.ComboRow,
+	root *ConditionGroup,
 	alwaysAskRow *adw.SwitchRow,
+	notifyRow *adw.SwitchRow,
 	browserRow *adw.ComboRow,
+	readLaunch func() (launchOptions, bool),
+	readFallbacks func() []string,
 	content *gtk.Box,
 ) {
 	content = gtk.NewBox(gtk.OrientationVertical, 18)
@@ -39,76 +47,22 @@ func buildRuleDialogContent(
 	nameGroup.Add(nameEntry)
 	content.Append(nameGroup)
 
-	// Initialize conditions
-	var conditionsSlice []Condition
-	if initialRule != nil && len(initialRule.Conditions) > 0 {
-		conditionsSlice = make([]Condition, len(initialRule.Conditions))
-		copy(conditionsSlice, initialRule.Conditions)
-	} else {
-		conditionsSlice = []Condition{{Type: "domain", Pattern: ""}}
+	// Initialize the condition tree, copied so edits can be cancelled
+	rootGroup := ConditionGroup{Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: ""}}}
+	if initialRule != nil {
+		if initial := initialRule.rootGroup(); !initial.isEmpty() {
+			rootGroup = initial.clone()
+		}
 	}
-	conditions = &conditionsSlice
+	root = &rootGroup
 
 	// Conditions section
 	conditionsGroup := adw.NewPreferencesGroup()
 	conditionsGroup.SetTitle("Conditions")
 	conditionsGroup.SetDescription("Define conditions to match URLs")
-
-	conditionsListBox := gtk.NewListBox()
-	conditionsListBox.SetSelectionMode(gtk.SelectionNone)
-	conditionsListBox.AddCSSClass("boxed-list")
-
-	// Logic selector row
-	logicRow = adw.NewComboRow()
-	logicRow.SetTitle("Match Logic")
-	logicRow.SetModel(gtk.NewStringList([]string{"All conditions", "Any condition"}))
-	if initialRule != nil && initialRule.Logic == "any" {
-		logicRow.SetSelected(1)
-	} else {
-		logicRow.SetSelected(0)
-	}
-	conditionsListBox.Append(logicRow)
-
-	var conditionRows []*gtk.ListBoxRow
-	var rebuildConditions func()
-
-	rebuildConditions = func() {
-		// Clear existing condition rows
-		for _, row := range conditionRows {
-			conditionsListBox.Remove(row)
-		}
-		conditionRows = nil
-
-		// Build condition rows
-		for i := range *conditions {
-			condIdx := i
-			row := createConditionRow(
-				conditions,
-				condIdx,
-				actionBtn,
-				rebuildConditions,
-			)
-			conditionsListBox.Append(row)
-			conditionRows = append(conditionRows, row)
-		}
-
-		// Add "Add Condition" row at the end of the list
-		addConditionRow := adw.NewActionRow()
-		addConditionRow.SetTitle("Add Condition")
-		addConditionRow.AddPrefix(gtk.NewImageFromIconName("list-add-symbolic"))
-		addConditionRow.SetActivatable(true)
-		addConditionRow.ConnectActivated(func() {
-			*conditions = append(*conditions, Condition{Type: "domain", Pattern: ""})
-			rebuildConditions()
-		})
-		conditionsListBox.Append(addConditionRow)
-
-		// Update action button state
-		actionBtn.SetSensitive(areAllConditionsValid(*conditions))
-	}
-
-	rebuildConditions()
-	conditionsGroup.Add(conditionsListBox)
+	conditionsGroup.Add(createConditionTreeEditor(root, func() {
+		actionBtn.SetSensitive(isConditionGroupValid(*root))
+	}))
 	content.Append(conditionsGroup)
 
 	// Action section
@@ -143,9 +97,43 @@ func buildRuleDialogContent(
 	}
 	actionGroup.Add(browserRow)
 
+	var initialLaunch launchOptions
+	if initialRule != nil {
+		initialLaunch = initialRule.launchOptions()
+	}
+	launchRow, readLaunch := createLaunchOptionsRow(initialLaunch, func() *Browser {
+		if idx := int(browserRow.Selected()); idx < len(browsers) {
+			return browsers[idx]
+		}
+		return nil
+	})
+	browserRow.Connect("notify::selected", launchRow.refresh)
+	launchRow.SetSensitive(browserRow.Sensitive())
+	actionGroup.Add(launchRow)
+
+	var fallbacks []string
+	if initialRule != nil {
+		fallbacks = initialRule.Fallbacks
+	}
+	fallbacksRow := createFallbacksRow("Fallback Browsers", "Tried in order if the browser is missing or fails to start",
+		fallbacks, browsers, func(ids []string) { fallbacks = ids })
+	fallbacksRow.SetSensitive(browserRow.Sensitive())
+	actionGroup.Add(fallbacksRow)
+	readFallbacks = func() []string { return fallbacks }
+
+	notifyRow = adw.NewSwitchRow()
+	notifyRow.SetTitle("Show notification")
+	notifyRow.SetSubtitle("Tell where matching URLs were opened, unless turned off in Behavior")
+	notifyRow.SetActive(initialRule == nil || !initialRule.Quiet)
+	notifyRow.SetSensitive(browserRow.Sensitive())
+	actionGroup.Add(notifyRow)
+
 	// Link always ask toggle to browser row sensitivity
 	alwaysAskRow.Connect("notify::active", func() {
 		browserRow.SetSensitive(!alwaysAskRow.Active())
+		launchRow.SetSensitive(!alwaysAskRow.Active())
+		fallbacksRow.SetSensitive(!alwaysAskRow.Active())
+		notifyRow.SetSensitive(!alwaysAskRow.Active())
 	})
 
 	content.Append(actionGroup)
@@ -153,12 +141,312 @@ func buildRuleDialogContent(
 	return
 }
 
+// launchOptionsRow is an expander row for how a rule launches its browser.
+// refresh lists the desktop actions of a newly selected browser, keeping the
+// selected one if it has it.
+type launchOptionsRow struct {
+	*adw.ExpanderRow
+	refresh func()
+}
+
+// createLaunchOptionsRow creates the rows for a rule's desktop action, extra
+// arguments and environment. browser returns the selected browser. readLaunch
+// returns the options, and false if the arguments or environment are invalid.
+func createLaunchOptionsRow(initial launchOptions, browser func() *Browser) (launchOptionsRow, func() (launchOptions, bool)) {
+	row := adw.NewExpanderRow()
+	row.SetTitle("Launch Options")
+	row.SetSubtitle("Open in a private or new window, or with extra arguments")
+	row.SetExpanded(!initial.isDefault())
+
+	modeRow := adw.NewComboRow()
+	modeRow.SetTitle("Launch Mode")
+	row.AddRow(modeRow)
+
+	argsRow := adw.NewEntryRow()
+	argsRow.SetTitle("Extra Arguments")
+	argsRow.SetText(shellJoin(initial.Args))
+	row.AddRow(argsRow)
+
+	envRow := adw.NewEntryRow()
+	envRow.SetTitle("Environment (NAME=VALUE)")
+	envRow.SetText(formatEnvArgs(initial.Env))
+	row.AddRow(envRow)
+
+	// actionIDs[i] is the desktop action of mode i, "" for the default
+	var actionIDs []string
+	selectedAction := initial.Action
+	refresh := func(keepMissing bool) {
+		actionIDs = []string{""}
+		names := []string{"Default"}
+		if b := browser(); b != nil {
+			for _, action := range b.desktopActions() {
+				actionIDs = append(actionIDs, action.ID)
+				names = append(names, action.Name)
+			}
+		}
+		selected := uint(0)
+		for i, id := range actionIDs {
+			if id == selectedAction && id != "" {
+				selected = uint(i)
+			}
+		}
+		// Keep an action the browser doesn't list, so saving doesn't drop it
+		if selected == 0 && selectedAction != "" && keepMissing {
+			actionIDs = append(actionIDs, selectedAction)
+			names = append(names, selectedAction+" (not available)")
+			selected = uint(len(actionIDs) - 1)
+		}
+		modeRow.SetModel(gtk.NewStringList(names))
+		modeRow.SetSelected(selected)
+		selectedAction = actionIDs[selected]
+	}
+	refresh(true)
+	modeRow.Connect("notify::selected", func() {
+		if idx := int(modeRow.Selected()); idx < len(actionIDs) {
+			selectedAction = actionIDs[idx]
+		}
+	})
+
+	parseArgs := func() ([]string, map[string]string, bool) {
+		args, argsErr := splitArgs(argsRow.Text())
+		setEntryRowError(argsRow, argsErr)
+		env, envErr := parseEnvArgs(envRow.Text())
+		setEntryRowError(envRow, envErr)
+		return args, env, argsErr == nil && envErr == nil
+	}
+	argsRow.ConnectChanged(func() { parseArgs() })
+	envRow.ConnectChanged(func() { parseArgs() })
+
+	readLaunch := func() (launchOptions, bool) {
+		args, env, ok := parseArgs()
+		if !ok {
+			row.SetExpanded(true)
+			return launchOptions{}, false
+		}
+		return launchOptions{Action: selectedAction, Args: args, Env: env}, true
+	}
+	return launchOptionsRow{ExpanderRow: row, refresh: func() { refresh(false) }}, readLaunch
+}
+
+// createFallbacksRow creates an expander row editing an ordered list of
+// fallback browsers. onChange is called with the new list after every edit.
+// Browsers that aren't installed stay in the list, marked as such.
+func createFallbacksRow(title, subtitle string, initial []string, browsers []*Browser, onChange func([]string)) *adw.ExpanderRow {
+	row := adw.NewExpanderRow()
+	row.SetTitle(title)
+	row.SetSubtitle(subtitle)
+	row.SetExpanded(len(initial) > 0)
+
+	ids := append([]string(nil), initial...)
+	var children []gtk.Widgetter
+	var rebuild func()
+	changed := func() {
+		onChange(append([]string(nil), ids...))
+		// Rows can't be removed from their own signal handlers
+		glib.IdleAdd(rebuild)
+	}
+
+	rebuild = func() {
+		for _, child := range children {
+			row.Remove(child)
+		}
+		children = nil
+
+		for i, id := range ids {
+			i := i // capture
+			itemRow := adw.NewActionRow()
+			if b := findBrowserByID(browsers, id); b != nil {
+				itemRow.SetTitle(b.Name)
+				itemRow.AddPrefix(loadBrowserIcon(b, 24))
+			} else {
+				itemRow.SetTitle(id)
+				itemRow.SetSubtitle("Not installed")
+			}
+
+			upBtn := gtk.NewButton()
+			upBtn.SetIconName("go-up-symbolic")
+			upBtn.AddCSSClass("flat")
+			upBtn.SetVAlign(gtk.AlignCenter)
+			upBtn.SetSensitive(i > 0)
+			upBtn.SetTooltipText("Try this browser earlier")
+			upBtn.ConnectClicked(func() {
+				ids[i], ids[i-1] = ids[i-1], ids[i]
+				changed()
+			})
+			itemRow.AddSuffix(upBtn)
+
+			deleteBtn := newDeleteButton("Remove this fallback")
+			deleteBtn.ConnectClicked(func() {
+				ids = append(ids[:i], ids[i+1:]...)
+				changed()
+			})
+			itemRow.AddSuffix(deleteBtn)
+
+			row.AddRow(itemRow)
+			children = append(children, itemRow)
+		}
+
+		// Browsers that can still be added
+		var candidates []*Browser
+		names := []string{"Choose a browser"}
+		for _, b := range browsers {
+			if !slices.Contains(ids, b.ID) {
+				candidates = append(candidates, b)
+				names = append(names, b.Name)
+			}
+		}
+		addRow := adw.NewComboRow()
+		addRow.SetTitle("Add Fallback")
+		addRow.SetModel(gtk.NewStringList(names))
+		addRow.SetSensitive(len(candidates) > 0)
+		addRow.Connect("notify::selected", func() {
+			if idx := int(addRow.Selected()); idx > 0 && idx <= len(candidates) {
+				ids = append(ids, candidates[idx-1].ID)
+				changed()
+			}
+		})
+		row.AddRow(addRow)
+		children = append(children, addRow)
+	}
+	rebuild()
+
+	return row
+}
+
+// setEntryRowError toggles the error style on an entry row, with err as its tooltip
+func setEntryRowError(row *adw.EntryRow, err error) {
+	if err != nil {
+		row.AddCSSClass("error")
+		row.SetTooltipText(err.Error())
+	} else {
+		row.RemoveCSSClass("error")
+		row.SetTooltipText("")
+	}
+}
+
+// createConditionTreeEditor creates an editor for a condition tree. onChanged is
+// called after every edit. The whole tree is rebuilt when conditions or groups
+// are added or removed.
+func createConditionTreeEditor(root *ConditionGroup, onChanged func()) gtk.Widgetter {
+	container := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	var rebuild func()
+	rebuild = func() {
+		if child := container.FirstChild(); child != nil {
+			container.Remove(child)
+		}
+		container.Append(createConditionGroupEditor(root, true, onChanged, rebuild, nil))
+		onChanged()
+	}
+
+	rebuild()
+	return container
+}
+
+// createConditionGroupEditor creates a boxed list for one condition group, with
+// nested groups rendered recursively inside it. onRemove is nil for the root group.
+func createConditionGroupEditor(
+	group *ConditionGroup,
+	isRoot bool,
+	onChanged func(),
+	rebuild func(),
+	onRemove func(),
+) *gtk.ListBox {
+	listBox := gtk.NewListBox()
+	listBox.SetSelectionMode(gtk.SelectionNone)
+	listBox.AddCSSClass("boxed-list")
+
+	// Logic selector row
+	logicRow := adw.NewComboRow()
+	logicRow.SetModel(gtk.NewStringList([]string{"All conditions", "Any condition"}))
+	if group.Logic == "any" {
+		logicRow.SetSelected(1)
+	} else {
+		logicRow.SetSelected(0)
+	}
+	logicRow.Connect("notify::selected", func() {
+		group.Logic = getLogicFromComboRow(logicRow)
+	})
+
+	if isRoot {
+		logicRow.SetTitle("Match Logic")
+	} else {
+		logicRow.SetTitle("Group")
+
+		negateBtn := newNegateToggle(group.Negate, "Match URLs that don't match this group")
+		negateBtn.ConnectToggled(func() {
+			group.Negate = negateBtn.Active()
+		})
+		logicRow.AddSuffix(negateBtn)
+
+		deleteBtn := newDeleteButton("Delete this group")
+		deleteBtn.ConnectClicked(onRemove)
+		logicRow.AddSuffix(deleteBtn)
+	}
+	listBox.Append(logicRow)
+
+	// A group must keep at least one condition or nested group
+	canDelete := len(group.Conditions)+len(group.Groups) > 1
+
+	for i := range group.Conditions {
+		listBox.Append(createConditionRow(&group.Conditions, i, canDelete, onChanged, rebuild))
+	}
+
+	for i := range group.Groups {
+		groupIdx := i
+		nested := createConditionGroupEditor(&group.Groups[groupIdx], false, onChanged, rebuild, func() {
+			if canDelete {
+				group.Groups = append(group.Groups[:groupIdx], group.Groups[groupIdx+1:]...)
+				rebuild()
+			}
+		})
+		nested.SetMarginStart(12)
+		nested.SetMarginEnd(12)
+		nested.SetMarginTop(6)
+		nested.SetMarginBottom(6)
+
+		groupRow := gtk.NewListBoxRow()
+		groupRow.SetActivatable(false)
+		groupRow.SetSelectable(false)
+		groupRow.SetChild(nested)
+		listBox.Append(groupRow)
+	}
+
+	// Add "Add Condition" and "Add Group" rows at the end of the list
+	addConditionRow := adw.NewActionRow()
+	addConditionRow.SetTitle("Add Condition")
+	addConditionRow.AddPrefix(gtk.NewImageFromIconName("list-add-symbolic"))
+	addConditionRow.SetActivatable(true)
+	addConditionRow.ConnectActivated(func() {
+		group.Conditions = append(group.Conditions, Condition{Type: "domain", Pattern: ""})
+		rebuild()
+	})
+	listBox.Append(addConditionRow)
+
+	addGroupRow := adw.NewActionRow()
+	addGroupRow.SetTitle("Add Group")
+	addGroupRow.SetSubtitle("Nest conditions with their own logic")
+	addGroupRow.AddPrefix(gtk.NewImageFromIconName("list-add-symbolic"))
+	addGroupRow.SetActivatable(true)
+	addGroupRow.ConnectActivated(func() {
+		group.Groups = append(group.Groups, ConditionGroup{
+			Logic:      "any",
+			Conditions: []Condition{{Type: "domain", Pattern: ""}},
+		})
+		rebuild()
+	})
+	listBox.Append(addGroupRow)
+
+	return listBox
+}
+
 // createConditionRow creates a single condition editing row with all controls
 func createConditionRow(
 	conditions *[]Condition,
 	condIdx int,
-	actionBtn *gtk.Button,
-	rebuildConditions func(),
+	canDelete bool,
+	onChanged func(),
+	rebuild func(),
 ) *gtk.ListBoxRow {
 	conditionRow := gtk.NewListBoxRow()
 	conditionRow.SetActivatable(false)
@@ -170,47 +458,64 @@ func createConditionRow(
 	conditionContainer.SetMarginStart(12)
 	conditionContainer.SetMarginEnd(12)
 
+	// Negate toggle
+	negateBtn := newNegateToggle((*conditions)[condIdx].Negate, "Match URLs that don't match this condition")
+	negateBtn.ConnectToggled(func() {
+		(*conditions)[condIdx].Negate = negateBtn.Active()
+	})
+	conditionContainer.Append(negateBtn)
+
 	// Match type dropdown
-	typeDropdown := gtk.NewDropDown(
-		gtk.NewStringList([]string{"Exact Domain", "URL Contains", "Wildcard", "Regex"}),
-		nil,
-	)
+	typeDropdown := gtk.NewDropDown(gtk.NewStringList(getConditionTypeLabels()), nil)
 	typeDropdown.SetSelected(conditionTypeToIndex((*conditions)[condIdx].Type))
 	typeDropdown.SetVAlign(gtk.AlignCenter)
 	typeDropdown.SetSizeRequest(150, -1) // Fixed width for consistent alignment
 	conditionContainer.Append(typeDropdown)
 
-	// Pattern entry
-	patternEntry := gtk.NewEntry()
-	patternEntry.SetText((*conditions)[condIdx].Pattern)
-	patternEntry.SetHExpand(true)
-	patternEntry.SetPlaceholderText("Pattern")
-	conditionContainer.Append(patternEntry)
+	// Pattern editor - rebuilt whenever the type changes since each type has its own widget
+	editorBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	editorBox.SetHExpand(true)
+	conditionContainer.Append(editorBox)
+
+	var setError func(bool)
+	updateValidation := func() {
+		cond := (*conditions)[condIdx]
+		setError(validateConditionPattern(cond.Type, cond.Pattern) != nil)
+		onChanged()
+	}
+
+	buildEditor := func() {
+		if child := editorBox.FirstChild(); child != nil {
+			editorBox.Remove(child)
+		}
+		cond := &(*conditions)[condIdx]
+		var editor gtk.Widgetter
+		setError = nil
+		editor, setError = createConditionEditor(cond.Type, cond.Pattern, func(pattern string) {
+			(*conditions)[condIdx].Pattern = pattern
+			// Editors may reset the pattern while they're being built, before setError is known
+			if setError != nil {
+				updateValidation()
+			}
+		})
+		editorBox.Append(editor)
+		updateValidation()
+	}
 
-	// Connect handlers
 	typeDropdown.Connect("notify::selected", func() {
 		(*conditions)[condIdx].Type = indexToConditionType(typeDropdown.Selected())
-		validateConditionEntry(conditions, condIdx, typeDropdown, patternEntry, actionBtn)
+		buildEditor()
 	})
 
-	patternEntry.Connect("changed", func() {
-		(*conditions)[condIdx].Pattern = patternEntry.Text()
-		validateConditionEntry(conditions, condIdx, typeDropdown, patternEntry, actionBtn)
-	})
+	buildEditor()
 
 	// Delete button
-	deleteBtn := gtk.NewButton()
-	deleteBtn.SetIconName("edit-delete-symbolic")
-	deleteBtn.SetTooltipText("Delete this condition")
-	deleteBtn.AddCSSClass("flat")
-	deleteBtn.AddCSSClass("circular")
-	deleteBtn.AddCSSClass("destructive-action")
-	deleteBtn.SetVAlign(gtk.AlignCenter)
-	deleteBtn.SetSensitive(len(*conditions) > 1)
+	deleteBtn := newDeleteButton("Delete this condition")
+	deleteBtn.SetSensitive(canDelete)
 	deleteBtn.ConnectClicked(func() {
-		if len(*conditions) > 1 && condIdx < len(*conditions) {
+		if canDelete && condIdx < len(*conditions) {
 			*conditions = append((*conditions)[:condIdx], (*conditions)[condIdx+1:]...)
-			rebuildConditions()
+			rebuild()
 		}
 	})
 	conditionContainer.Append(deleteBtn)
@@ -219,23 +524,245 @@ func createConditionRow(
 	return conditionRow
 }
 
-// validateConditionEntry validates a pattern and updates UI accordingly
-func validateConditionEntry(
-	conditions *[]Condition,
-	condIdx int,
-	typeDropdown *gtk.DropDown,
-	patternEntry *gtk.Entry,
-	actionBtn *gtk.Button,
-) {
-	pattern := patternEntry.Text()
-	condType := indexToConditionType(typeDropdown.Selected())
+// newNegateToggle creates a "Not" toggle button for inverting a condition or group
+func newNegateToggle(active bool, tooltip string) *gtk.ToggleButton {
+	btn := gtk.NewToggleButtonWithLabel("Not")
+	btn.SetActive(active)
+	btn.SetTooltipText(tooltip)
+	btn.AddCSSClass("flat")
+	btn.SetVAlign(gtk.AlignCenter)
+	return btn
+}
+
+// newDeleteButton creates a small destructive delete button
+func newDeleteButton(tooltip string) *gtk.Button {
+	btn := gtk.NewButton()
+	btn.SetIconName("edit-delete-symbolic")
+	btn.SetTooltipText(tooltip)
+	btn.AddCSSClass("flat")
+	btn.AddCSSClass("circular")
+	btn.AddCSSClass("destructive-action")
+	btn.SetVAlign(gtk.AlignCenter)
+	return btn
+}
+
+// createConditionEditor creates the pattern editing widget for a condition type.
+// onChange is called with the new pattern whenever the user edits it, and the
+// returned setError function toggles the widget's error styling.
+func createConditionEditor(condType, pattern string, onChange func(string)) (gtk.Widgetter, func(bool)) {
+	switch condType {
+	case "port":
+		return createPortEditor(pattern, onChange)
+	case "query":
+		return createQueryEditor(pattern, onChange)
+	case "schedule":
+		return createScheduleEditor(pattern, onChange)
+	default:
+		entry := newPatternEntry(pattern, conditionPlaceholder(condType), onChange)
+		return entry, func(invalid bool) { setEntryError(entry, invalid) }
+	}
+}
+
+// createPortEditor creates a spin button for port conditions.
+func createPortEditor(pattern string, onChange func(string)) (gtk.Widgetter, func(bool)) {
+	spin := gtk.NewSpinButtonWithRange(1, 65535, 1)
+	spin.SetHExpand(true)
+	spin.SetNumeric(true)
+	if isValidPort(pattern) {
+		spin.SetValue(float64(parsePort(pattern)))
+	} else {
+		// Switching from another type: start from a sensible port instead of keeping its pattern
+		spin.SetValue(443)
+		onChange("443")
+	}
+	spin.ConnectValueChanged(func() {
+		onChange(strconv.Itoa(spin.ValueAsInt()))
+	})
+	return spin, func(invalid bool) {
+		if invalid {
+			spin.AddCSSClass("error")
+		} else {
+			spin.RemoveCSSClass("error")
+		}
+	}
+}
+
+// createQueryEditor creates separate name and value entries for query parameter conditions.
+// An empty value matches any URL where the parameter is present.
+func createQueryEditor(pattern string, onChange func(string)) (gtk.Widgetter, func(bool)) {
+	name, value, _ := strings.Cut(pattern, "=")
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	box.SetHExpand(true)
+
+	nameEntry := gtk.NewEntry()
+	valueEntry := gtk.NewEntry()
+
+	emit := func() {
+		if valueEntry.Text() == "" {
+			onChange(nameEntry.Text())
+		} else {
+			onChange(nameEntry.Text() + "=" + valueEntry.Text())
+		}
+	}
+
+	nameEntry.SetText(name)
+	nameEntry.SetHExpand(true)
+	nameEntry.SetPlaceholderText("Parameter")
+	nameEntry.Connect("changed", emit)
+	box.Append(nameEntry)
 
-	err := validateConditionPattern(condType, pattern)
+	box.Append(gtk.NewLabel("="))
+
+	valueEntry.SetText(value)
+	valueEntry.SetHExpand(true)
+	valueEntry.SetPlaceholderText("Any value")
+	valueEntry.Connect("changed", emit)
+	box.Append(valueEntry)
+
+	return box, func(invalid bool) { setEntryError(nameEntry, invalid) }
+}
+
+// createScheduleEditor creates day toggles, start and end times and a time zone
+// entry for schedule conditions.
+func createScheduleEditor(pattern string, onChange func(string)) (gtk.Widgetter, func(bool)) {
+	sched, err := parseSchedule(pattern)
 	if err != nil {
-		patternEntry.AddCSSClass("error")
+		// Switching from another type: start from business hours instead of keeping its pattern
+		pattern = "mon-fri 09:00-17:00"
+		sched, _ = parseSchedule(pattern)
+		onChange(pattern)
+	}
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.SetHExpand(true)
+
+	daysBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	daysBox.AddCSSClass("linked")
+	box.Append(daysBox)
+
+	timeBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	box.Append(timeBox)
+
+	startEntry := gtk.NewEntry()
+	endEntry := gtk.NewEntry()
+	zoneEntry := gtk.NewEntry()
+	dayButtons := make(map[time.Weekday]*gtk.ToggleButton)
+
+	emit := func() {
+		var days [7]bool
+		anyDay := false
+		for d, btn := range dayButtons {
+			days[d] = btn.Active()
+			anyDay = anyDay || days[d]
+		}
+		if !anyDay {
+			// No days can never match, report it as invalid
+			onChange("")
+			return
+		}
+		timeRange := ""
+		if startEntry.Text() != "" || endEntry.Text() != "" {
+			timeRange = startEntry.Text() + "-" + endEntry.Text()
+		}
+		onChange(formatSchedule(formatDays(days), timeRange, zoneEntry.Text()))
+	}
+
+	for _, d := range weekOrder {
+		btn := gtk.NewToggleButtonWithLabel(d.String()[:3])
+		btn.SetTooltipText(d.String())
+		btn.SetActive(sched.days[d])
+		btn.ConnectToggled(emit)
+		dayButtons[d] = btn
+		daysBox.Append(btn)
+	}
+
+	for _, entry := range []*gtk.Entry{startEntry, endEntry} {
+		entry.SetMaxWidthChars(5)
+		entry.SetWidthChars(5)
+	}
+	if sched.hasTime {
+		startEntry.SetText(formatClock(sched.start))
+		endEntry.SetText(formatClock(sched.end))
+	}
+	startEntry.SetPlaceholderText("09:00")
+	startEntry.SetTooltipText("Start time (24-hour)")
+	startEntry.Connect("changed", emit)
+	timeBox.Append(startEntry)
+
+	timeBox.Append(gtk.NewLabel("–"))
+
+	endEntry.SetPlaceholderText("17:00")
+	endEntry.SetTooltipText("End time (24-hour). Times before the start time end on the next day")
+	endEntry.Connect("changed", emit)
+	timeBox.Append(endEntry)
+
+	zoneEntry.SetText(sched.timezone)
+	zoneEntry.SetHExpand(true)
+	zoneEntry.SetPlaceholderText("Local time")
+	zoneEntry.SetTooltipText("Time zone, e.g. Europe/Berlin")
+	zoneEntry.Connect("changed", emit)
+	timeBox.Append(zoneEntry)
+
+	return box, func(invalid bool) {
+		setEntryError(startEntry, invalid)
+		setEntryError(endEntry, invalid)
+	}
+}
+
+// newPatternEntry creates a text entry for a condition pattern.
+func newPatternEntry(pattern, placeholder string, onChange func(string)) *gtk.Entry {
+	entry := gtk.NewEntry()
+	entry.SetText(pattern)
+	entry.SetHExpand(true)
+	entry.SetPlaceholderText(placeholder)
+	entry.Connect("changed", func() {
+		onChange(entry.Text())
+	})
+	return entry
+}
+
+// setEntryError toggles the error style on an entry
+func setEntryError(entry *gtk.Entry, invalid bool) {
+	if invalid {
+		entry.AddCSSClass("error")
 	} else {
-		patternEntry.RemoveCSSClass("error")
+		entry.RemoveCSSClass("error")
 	}
+}
 
-	actionBtn.SetSensitive(areAllConditionsValid(*conditions))
+// conditionPlaceholder returns an example pattern for a condition type
+func conditionPlaceholder(condType string) string {
+	switch condType {
+	case "domain", "domain_suffix":
+		return "example.com"
+	case "keyword":
+		return "Text in URL"
+	case "glob":
+		return "*.example.com"
+	case "regex":
+		return "^https://.*\\.example\\.com"
+	case "scheme":
+		return "https"
+	case "host":
+		return "*.example.com"
+	case "path_prefix":
+		return "/docs"
+	case "path_glob":
+		return "/*/pull/*"
+	case "fragment":
+		return "section"
+	case "extension":
+		return "pdf"
+	case "schedule":
+		return "mon-fri 09:00-17:00"
+	case "source_app":
+		return "org.mozilla.Thunderbird or terminal"
+	case "mail_to", "mail_cc":
+		return "@example.com or alice@example.com"
+	case "mail_subject":
+		return "Text in subject"
+	default:
+		return "Pattern"
+	}
 }
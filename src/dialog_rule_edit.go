@@ -10,7 +10,7 @@ import (
 // showEditRuleDialog displays the edit rule dialog.
 func showEditRuleDialog(parent *adw.Window, cfg *Config, rule *Rule, browsers []*Browser, rebuildRulesList func()) {
 	// Ensure rules have at least one condition
-	if len(rule.Conditions) == 0 {
+	if root := rule.rootGroup(); root.isEmpty() {
 		rule.Conditions = []Condition{{
 			Type:    "domain",
 			Pattern: "",
@@ -46,7 +46,7 @@ func showEditRuleDialog(parent *adw.Window, cfg *Config, rule *Rule, browsers []
 	scrolledWindow.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
 	scrolledWindow.SetVExpand(true)
 
-	nameEntry, conditions, logicRow, alwaysAskRow, browserRow, content := buildRuleDialogContent(rule, browsers, saveBtn)
+	nameEntry, root, alwaysAskRow, notifyRow, browserRow, readLaunch, readFallbacks, content := buildRuleDialogContent(rule, browsers, saveBtn)
 
 	scrolledWindow.SetChild(content)
 	toolbarView.SetContent(scrolledWindow)
@@ -55,17 +55,23 @@ func showEditRuleDialog(parent *adw.Window, cfg *Config, rule *Rule, browsers []
 	saveBtn.ConnectClicked(func() {
 		browserIdx := browserRow.Selected()
 
-		if len(*conditions) > 0 && int(browserIdx) < len(browsers) {
-			if !validateConditions(*conditions) {
+		if int(browserIdx) < len(browsers) {
+			if !isConditionGroupValid(*root) {
+				return
+			}
+			launch, ok := readLaunch()
+			if !ok {
 				return
 			}
 
 			// Update rule
 			rule.Name = nameEntry.Text()
-			rule.Conditions = *conditions
-			rule.Logic = getLogicFromComboRow(logicRow)
+			rule.setRootGroup(*root)
 			rule.Browser = browsers[browserIdx].ID
+			rule.Action, rule.Args, rule.Env = launch.Action, launch.Args, launch.Env
+			rule.Fallbacks = readFallbacks()
 			rule.AlwaysAsk = alwaysAskRow.Active()
+			rule.Quiet = !notifyRow.Active()
 
 			saveConfigWithFlag(cfg)
 			rebuildRulesList()
@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// execEntry is a desktop entry's Exec key, with the keys its field codes
+// expand to.
+type execEntry struct {
+	Exec string // with the desktop file's string escapes already processed
+	Icon string // Icon key, for %i
+	Name string // translated Name key, for %c
+	Path string // location of the desktop file, for %k
+	DBus string // bus name to launch the app with instead, see desktopEntry.dbusName
+}
+
+// execPart is a run of literal text in an Exec argument, or a field code.
+type execPart struct {
+	text string
+	code rune // the letter after %, or 0 for text
+}
+
+// execArg is one argument of a parsed Exec key.
+type execArg []execPart
+
+// isCode reports whether the argument is a single field code on its own, like %U.
+func (a execArg) isCode(codes string) bool {
+	return len(a) == 1 && a[0].code != 0 && strings.ContainsRune(codes, a[0].code)
+}
+
+// parseExec splits an Exec key into arguments as the desktop entry spec says.
+// Arguments are separated by spaces and may be quoted with double quotes, in
+// which ", `, $ and \ are escaped with a backslash. Like GLib, single quotes
+// and backslashes outside quotes are accepted too. Field codes are only
+// recognized outside quotes; %% is a literal percent sign everywhere.
+func parseExec(exec string) ([]execArg, error) {
+	var args []execArg
+	var arg execArg
+	var text strings.Builder
+	inArg := false
+	var quote rune
+
+	flushText := func() {
+		if text.Len() > 0 {
+			arg = append(arg, execPart{text: text.String()})
+			text.Reset()
+		}
+	}
+	endArg := func() {
+		flushText()
+		if len(arg) == 0 {
+			arg = execArg{{}} // "" is an empty argument
+		}
+		args = append(args, arg)
+		arg, inArg = nil, false
+	}
+
+	runes := []rune(exec)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				text.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"`$\\", runes[i+1]):
+				i++
+				text.WriteRune(runes[i])
+			case r == '%' && i+1 < len(runes) && runes[i+1] == '%':
+				i++
+				text.WriteRune('%')
+			default:
+				text.WriteRune(r)
+			}
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				endArg()
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("Exec ends with a backslash")
+			}
+			i++
+			text.WriteRune(runes[i])
+			inArg = true
+		case r == '%' && i+1 < len(runes):
+			i++
+			if runes[i] == '%' {
+				text.WriteRune('%')
+			} else {
+				flushText()
+				arg = append(arg, execPart{code: runes[i]})
+			}
+			inArg = true
+		default:
+			text.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Exec has an unterminated %c quote", quote)
+	}
+	if inArg {
+		endArg()
+	}
+	return args, nil
+}
+
+// commandlineInvocations substitutes URLs into a desktop entry's Exec key.
+// Commands that take a list (%U or %F) are run once with every URL, others once
+// per URL, as the desktop entry spec requires. extraArgs, like the arguments
+// selecting a profile, are added before the URLs.
+func commandlineInvocations(entry execEntry, urls, extraArgs []string) ([][]string, error) {
+	args, err := parseExec(entry.Exec)
+	if err != nil {
+		return nil, err
+	}
+	if takesURLList(args) {
+		return [][]string{expandExec(args, urls, extraArgs, entry)}, nil
+	}
+	invocations := make([][]string, 0, len(urls))
+	for _, url := range urls {
+		invocations = append(invocations, expandExec(args, []string{url}, extraArgs, entry))
+	}
+	return invocations, nil
+}
+
+// takesURLList reports whether an Exec key has a field code for a list of URLs.
+func takesURLList(args []execArg) bool {
+	for _, arg := range args {
+		if arg.isCode("UF") {
+			return true
+		}
+	}
+	return false
+}
+
+// expandCommandline parses an Exec key and expands its field codes, see expandExec.
+func expandCommandline(entry execEntry, urls, extraArgs []string) ([]string, error) {
+	args, err := parseExec(entry.Exec)
+	if err != nil {
+		return nil, err
+	}
+	return expandExec(args, urls, extraArgs, entry), nil
+}
+
+// expandExec expands the field codes of a parsed Exec key:
+//
+//   - %U and %F expand to every URL as separate arguments, %u and %f to the
+//     first one. %f and %F turn file: URLs into paths.
+//   - %i expands to --icon and the Icon key as two arguments, if it's set.
+//   - %c expands to the translated name and %k to the desktop file's location.
+//   - Deprecated and unknown field codes expand to nothing.
+//
+// Arguments that were only field codes and expand to nothing are removed.
+// extraArgs go right before the first URL, or at the end if there are no URL
+// field codes.
+func expandExec(args []execArg, urls, extraArgs []string, entry execEntry) []string {
+	var first, firstPath string
+	if len(urls) > 0 {
+		first, firstPath = urls[0], localPath(urls[0])
+	}
+
+	var expanded []string
+	pending := extraArgs
+	for _, arg := range args {
+		for _, part := range arg {
+			if part.code != 0 && strings.ContainsRune("uUfF", part.code) {
+				expanded = append(expanded, pending...)
+				pending = nil
+				break
+			}
+		}
+
+		switch {
+		case arg.isCode("U"):
+			expanded = append(expanded, urls...)
+			continue
+		case arg.isCode("F"):
+			for _, url := range urls {
+				expanded = append(expanded, localPath(url))
+			}
+			continue
+		case arg.isCode("i"):
+			if entry.Icon != "" {
+				expanded = append(expanded, "--icon", entry.Icon)
+			}
+			continue
+		}
+
+		var b strings.Builder
+		onlyCodes := true
+		for _, part := range arg {
+			switch part.code {
+			case 0:
+				b.WriteString(part.text)
+				onlyCodes = false
+			case 'u', 'U':
+				b.WriteString(first)
+			case 'f', 'F':
+				b.WriteString(firstPath)
+			case 'c':
+				b.WriteString(entry.Name)
+			case 'k':
+				b.WriteString(entry.Path)
+			}
+		}
+		if b.Len() > 0 || !onlyCodes {
+			expanded = append(expanded, b.String())
+		}
+	}
+	return append(expanded, pending...)
+}
+
+// localPath returns the path of a local file: URL, for %f and %F. Other URLs
+// are passed as they are, since browsers take URLs wherever they take files.
+func localPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") || u.Path == "" {
+		return rawURL
+	}
+	return u.Path
+}
+
+// launchGracePeriod is how long a started command is watched before it counts
+// as launched. Browsers that hand links to a running instance exit within it,
+// but successfully.
+const launchGracePeriod = 500 * time.Millisecond
+
+// waitForStartup waits up to grace for started commands to fail by exiting
+// with a non-zero status, and returns the first such error. It returns early
+// once all of them have exited. Commands still running are left alone, and
+// reaped once they exit.
+func waitForStartup(cmds []*exec.Cmd, grace time.Duration) error {
+	done := make(chan error, len(cmds))
+	for _, cmd := range cmds {
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				done <- fmt.Errorf("%s exited right away: %w", filepath.Base(cmd.Path), err)
+				return
+			}
+			done <- nil
+		}()
+	}
+
+	timeout := time.After(grace)
+	for range cmds {
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+	return nil
+}
+
+// hostArgs wraps a command with flatpak-spawn --host when running in Flatpak,
+// passing the activation token and env, as KEY=VALUE pairs, along, so it runs
+// outside the sandbox.
+func hostArgs(args []string, activationToken string, env []string) []string {
+	if os.Getenv("FLATPAK_ID") == "" || len(args) == 0 || strings.HasPrefix(args[0], "flatpak-spawn") {
+		return args
+	}
+	wrapped := []string{"flatpak-spawn", "--host", "--env=XDG_ACTIVATION_TOKEN=" + activationToken}
+	for _, e := range env {
+		wrapped = append(wrapped, "--env="+e)
+	}
+	return append(wrapped, args...)
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCommandlineInvocations tests substituting one or several URLs into command lines
+func TestCommandlineInvocations(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdline string
+		urls    []string
+		extra   []string
+		want    [][]string
+	}{
+		{
+			name:    "single URL",
+			cmdline: "firefox %u",
+			urls:    []string{"https://a.example"},
+			want:    [][]string{{"firefox", "https://a.example"}},
+		},
+		{
+			name:    "list field code opens every URL at once",
+			cmdline: "chromium --new-window %U",
+			urls:    []string{"https://a.example", "https://b.example"},
+			want:    [][]string{{"chromium", "--new-window", "https://a.example", "https://b.example"}},
+		},
+		{
+			name:    "single field code runs once per URL",
+			cmdline: "firefox --new-tab %u",
+			urls:    []string{"https://a.example", "https://b.example"},
+			want: [][]string{
+				{"firefox", "--new-tab", "https://a.example"},
+				{"firefox", "--new-tab", "https://b.example"},
+			},
+		},
+		{
+			name:    "file list field code",
+			cmdline: "browser %F",
+			urls:    []string{"https://a.example", "https://b.example"},
+			want:    [][]string{{"browser", "https://a.example", "https://b.example"}},
+		},
+		{
+			name:    "other field codes are removed",
+			cmdline: "browser %i %c %k %u",
+			urls:    []string{"https://a.example"},
+			want:    [][]string{{"browser", "https://a.example"}},
+		},
+		{
+			name:    "extra arguments go before the URL",
+			cmdline: "flatpak run org.mozilla.firefox --new-window %u",
+			urls:    []string{"https://a.example"},
+			extra:   []string{"-P", "Work"},
+			want:    [][]string{{"flatpak", "run", "org.mozilla.firefox", "--new-window", "-P", "Work", "https://a.example"}},
+		},
+		{
+			name:    "extra arguments for every invocation",
+			cmdline: "firefox %u",
+			urls:    []string{"https://a.example", "https://b.example"},
+			extra:   []string{"-P", "Work"},
+			want: [][]string{
+				{"firefox", "-P", "Work", "https://a.example"},
+				{"firefox", "-P", "Work", "https://b.example"},
+			},
+		},
+		{
+			name:    "extra arguments without a field code",
+			cmdline: "chromium",
+			urls:    []string{"https://a.example"},
+			extra:   []string{"--profile-directory=Profile 1"},
+			want:    [][]string{{"chromium", "--profile-directory=Profile 1"}},
+		},
+		{
+			name:    "no field code",
+			cmdline: "browser --new-window",
+			urls:    []string{"https://a.example"},
+			want:    [][]string{{"browser", "--new-window"}},
+		},
+		{
+			name:    "list field code in quotes is not a list",
+			cmdline: `sh -c "browser %U"`,
+			urls:    []string{"https://a.example", "https://b.example"},
+			want:    [][]string{{"sh", "-c", "browser %U"}, {"sh", "-c", "browser %U"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commandlineInvocations(execEntry{Exec: tt.cmdline}, tt.urls, tt.extra)
+			if err != nil {
+				t.Fatalf("commandlineInvocations() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandlineInvocations(%q, %q) = %q, want %q", tt.cmdline, tt.urls, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpandCommandline tests parsing Exec keys and expanding their field codes
+// as the desktop entry spec says
+func TestExpandCommandline(t *testing.T) {
+	entry := execEntry{
+		Icon: "firefox",
+		Name: "Firefox Web Browser",
+		Path: "/usr/share/applications/firefox.desktop",
+	}
+	oneURL := []string{"https://a.example/?q=1&r=2"}
+	twoURLs := []string{"https://a.example", "https://b.example"}
+
+	tests := []struct {
+		name    string
+		exec    string
+		urls    []string
+		want    []string
+		wantErr bool
+	}{
+		// Splitting and quoting
+		{name: "spaces and tabs separate arguments", exec: "firefox \t --new-window   %u", urls: oneURL, want: []string{"firefox", "--new-window", "https://a.example/?q=1&r=2"}},
+		{name: "quoted program with spaces", exec: `"/opt/My Browser/browser" %u`, urls: oneURL, want: []string{"/opt/My Browser/browser", "https://a.example/?q=1&r=2"}},
+		{name: "quotes join with adjacent text", exec: `browser --name="My Browser"`, want: []string{"browser", "--name=My Browser"}},
+		{name: "escaped double quote", exec: `browser "say \"hi\""`, want: []string{"browser", `say "hi"`}},
+		{name: "escaped backtick and dollar", exec: "browser \"\\`id\\` \\$HOME\"", want: []string{"browser", "`id` $HOME"}},
+		{name: "escaped backslash", exec: `browser "C:\\path"`, want: []string{"browser", `C:\path`}},
+		{name: "other backslashes in quotes are literal", exec: `browser "a\nb"`, want: []string{"browser", `a\nb`}},
+		{name: "empty quoted argument", exec: `browser "" %u`, urls: oneURL, want: []string{"browser", "", "https://a.example/?q=1&r=2"}},
+		{name: "single quotes", exec: `sh -c 'exec browser "$1"' sh %u`, urls: oneURL, want: []string{"sh", "-c", `exec browser "$1"`, "sh", "https://a.example/?q=1&r=2"}},
+		{name: "backslash outside quotes", exec: `/opt/My\ Browser/browser %u`, urls: oneURL, want: []string{"/opt/My Browser/browser", "https://a.example/?q=1&r=2"}},
+		{name: "unterminated double quote", exec: `browser "%u`, wantErr: true},
+		{name: "unterminated single quote", exec: `browser '%u`, wantErr: true},
+		{name: "trailing backslash", exec: `browser \`, wantErr: true},
+
+		// Field codes
+		{name: "percent escape", exec: "browser --progress=50%% %u", urls: oneURL, want: []string{"browser", "--progress=50%", "https://a.example/?q=1&r=2"}},
+		{name: "percent escape in quotes", exec: `browser "100%%"`, want: []string{"browser", "100%"}},
+		{name: "field codes in quotes are not expanded", exec: `sh -c "browser %u"`, urls: oneURL, want: []string{"sh", "-c", "browser %u"}},
+		{name: "URL inside an argument", exec: "browser --url=%u", urls: oneURL, want: []string{"browser", "--url=https://a.example/?q=1&r=2"}},
+		{name: "URL list", exec: "browser %U", urls: twoURLs, want: []string{"browser", "https://a.example", "https://b.example"}},
+		{name: "single URL of several", exec: "browser %u", urls: twoURLs, want: []string{"browser", "https://a.example"}},
+		{name: "list code inside an argument takes the first URL", exec: "browser --urls=%U", urls: twoURLs, want: []string{"browser", "--urls=https://a.example"}},
+		{name: "no URLs", exec: "browser %U", want: []string{"browser"}},
+		{name: "no URL", exec: "browser %u --new-window", want: []string{"browser", "--new-window"}},
+		{name: "file code turns file URLs into paths", exec: "viewer %f", urls: []string{"file:///home/alice/My%20Page.html"}, want: []string{"viewer", "/home/alice/My Page.html"}},
+		{name: "file list code", exec: "viewer %F", urls: []string{"file://localhost/tmp/a.html", "https://b.example"}, want: []string{"viewer", "/tmp/a.html", "https://b.example"}},
+		{name: "URL code keeps file URLs", exec: "browser %u", urls: []string{"file:///tmp/a.html"}, want: []string{"browser", "file:///tmp/a.html"}},
+		{name: "remote file URL", exec: "viewer %f", urls: []string{"file://server/share/a.html"}, want: []string{"viewer", "file://server/share/a.html"}},
+		{name: "icon", exec: "browser %i %u", urls: oneURL, want: []string{"browser", "--icon", "firefox", "https://a.example/?q=1&r=2"}},
+		{name: "name", exec: "browser --class %c", want: []string{"browser", "--class", "Firefox Web Browser"}},
+		{name: "desktop file", exec: "browser --desktop-file=%k", want: []string{"browser", "--desktop-file=/usr/share/applications/firefox.desktop"}},
+		{name: "deprecated codes are removed", exec: "browser %d %D %n %N %v %m %u", urls: oneURL, want: []string{"browser", "https://a.example/?q=1&r=2"}},
+		{name: "unknown code is removed", exec: "browser --x%z %u", urls: oneURL, want: []string{"browser", "--x", "https://a.example/?q=1&r=2"}},
+		{name: "trailing percent", exec: "browser 100%", want: []string{"browser", "100%"}},
+		{name: "URL is one argument", exec: "browser %u", urls: []string{"https://a.example/a b;c\"d"}, want: []string{"browser", "https://a.example/a b;c\"d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := entry
+			e.Exec = tt.exec
+			got, err := expandCommandline(e, tt.urls, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandCommandline(%q) error = %v, wantErr %v", tt.exec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandCommandline(%q) = %q, want %q", tt.exec, got, tt.want)
+			}
+		})
+	}
+
+	// Without an icon, %i is removed
+	got, _ := expandCommandline(execEntry{Exec: "browser %i %u"}, oneURL, nil)
+	if want := []string{"browser", "https://a.example/?q=1&r=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%%i without an icon = %q, want %q", got, want)
+	}
+}
+
+// TestWaitForStartup tests detecting commands that fail right after starting
+func TestWaitForStartup(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands [][]string
+		wantErr  bool
+		maxWait  time.Duration
+	}{
+		{name: "exits successfully", commands: [][]string{{"true"}}, maxWait: 150 * time.Millisecond},
+		{name: "exits with an error", commands: [][]string{{"false"}}, wantErr: true},
+		{name: "keeps running", commands: [][]string{{"sleep", "5"}}},
+		{name: "one of several fails", commands: [][]string{{"sleep", "5"}, {"true"}, {"false"}}, wantErr: true},
+		// Several commands are watched together, not one after another
+		{name: "several keep running", commands: [][]string{{"sleep", "5"}, {"sleep", "5"}, {"sleep", "5"}}, maxWait: 350 * time.Millisecond},
+		{name: "none", maxWait: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmds []*exec.Cmd
+			for _, args := range tt.commands {
+				if _, err := exec.LookPath(args[0]); err != nil {
+					t.Skipf("%s not installed", args[0])
+				}
+				cmd := exec.Command(args[0], args[1:]...)
+				if err := cmd.Start(); err != nil {
+					t.Fatal(err)
+				}
+				defer cmd.Process.Kill()
+				cmds = append(cmds, cmd)
+			}
+			start := time.Now()
+			if err := waitForStartup(cmds, 200*time.Millisecond); (err != nil) != tt.wantErr {
+				t.Errorf("waitForStartup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if took := time.Since(start); tt.maxWait > 0 && took > tt.maxWait {
+				t.Errorf("waitForStartup() took %v, want at most %v", took, tt.maxWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// urlTrace explains how a URL is routed: how it was transformed, which rules
+// and conditions matched and why, and what would be launched.
+type urlTrace struct {
+	Input        string        `json:"input"`
+	Steps        []urlStep     `json:"steps"`
+	URL          string        `json:"url"` // the URL rules are matched against and the browser gets
+	Source       *sourceApp    `json:"source,omitempty"`
+	Rules        []ruleTrace   `json:"rules"`
+	Decision     routeDecision `json:"decision"`
+	Command      []string      `json:"command,omitempty"`       // what launchCommand would run, if a browser is launched
+	Env          []string      `json:"env,omitempty"`           // KEY=VALUE pairs the command gets in its environment
+	CommandError string        `json:"command_error,omitempty"` // why the command can't be run
+	DBus         string        `json:"dbus,omitempty"`          // bus name the browser is asked to open the URL on first, see launchCommand
+}
+
+// ruleTrace is the outcome of matching one rule.
+type ruleTrace struct {
+	Index      int            `json:"index"` // 1-based position
+	Name       string         `json:"name,omitempty"`
+	Browser    string         `json:"browser,omitempty"`
+	AlwaysAsk  bool           `json:"always_ask,omitempty"`
+	Disabled   bool           `json:"disabled,omitempty"`
+	Matched    bool           `json:"matched"`
+	Conditions conditionTrace `json:"conditions"`
+}
+
+// conditionTrace is the outcome of matching a condition, or a group of them
+// when Logic is set.
+type conditionTrace struct {
+	Type     string           `json:"type,omitempty"`
+	Pattern  string           `json:"pattern,omitempty"`
+	Logic    string           `json:"logic,omitempty"`
+	Negate   bool             `json:"negate,omitempty"`
+	Matched  bool             `json:"matched"`
+	Value    string           `json:"value,omitempty"` // what the pattern was compared against
+	Error    string           `json:"error,omitempty"` // why the pattern is invalid and never matches
+	Children []conditionTrace `json:"children,omitempty"`
+}
+
+// explainURL runs the same decision as handleURLs without launching anything.
+// commandline returns the Exec line of an installed browser, or of one of its
+// desktop actions if action isn't empty, or the command of a custom target, and
+// false if the browser isn't installed.
+func (cfg *Config) explainURL(rawURL string, source *sourceApp, commandline func(browserID, action string) (execEntry, bool)) urlTrace {
+	trace := urlTrace{Input: rawURL, Source: source}
+
+	url := sanitizeURL(rawURL)
+	trace.Steps = append(trace.Steps, urlStep{Name: "sanitize", URL: url})
+	url, steps := cfg.prepareURL(url, source)
+	trace.Steps = append(trace.Steps, steps...)
+	trace.URL = url
+
+	in := newMatchInput(url)
+	in.source = source
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		conditions := traceGroup(rule.rootGroup(), in)
+		trace.Rules = append(trace.Rules, ruleTrace{
+			Index:      i + 1,
+			Name:       rule.Name,
+			Browser:    rule.Browser,
+			AlwaysAsk:  rule.AlwaysAsk,
+			Disabled:   rule.Disabled,
+			Matched:    conditions.Matched && !rule.Disabled,
+			Conditions: conditions,
+		})
+	}
+
+	trace.Decision = cfg.route(url, source, func(id string) bool {
+		_, ok := commandline(id, "")
+		return ok
+	})
+	if trace.Decision.Browser != "" {
+		var opts launchOptions
+		if trace.Decision.Launch != nil {
+			opts = *trace.Decision.Launch
+		}
+		if entry, ok := commandline(trace.Decision.Browser, opts.Action); ok {
+			var parts []string
+			var err error
+			if strings.HasPrefix(trace.Decision.Browser, customTargetPrefix) {
+				parts, err = customCommand(entry.Exec, url, opts.Args)
+			} else {
+				parts, err = expandCommandline(entry, []string{url}, opts.extraArgs(trace.Decision.Browser))
+			}
+			if err != nil {
+				trace.CommandError = err.Error()
+			}
+			if entry.usesDBus(opts.extraArgs(trace.Decision.Browser), opts.environ()) {
+				trace.DBus = entry.DBus
+			}
+			trace.Command = hostArgs(parts, "", opts.environ())
+			if len(trace.Command) == len(parts) {
+				trace.Env = opts.environ() // flatpak-spawn passes them as arguments instead
+			}
+		}
+	}
+	return trace
+}
+
+// traceGroup matches a group and each of its conditions and nested groups.
+func traceGroup(g ConditionGroup, in *matchInput) conditionTrace {
+	logic := g.Logic
+	if logic == "" {
+		logic = "all"
+	}
+	t := conditionTrace{
+		Logic:   logic,
+		Negate:  g.Negate,
+		Matched: compileGroup(g).match(in),
+	}
+	for _, c := range g.Conditions {
+		t.Children = append(t.Children, traceCondition(c, in))
+	}
+	for _, sub := range g.Groups {
+		t.Children = append(t.Children, traceGroup(sub, in))
+	}
+	return t
+}
+
+// traceCondition matches a single condition and records what it was compared against.
+func traceCondition(c Condition, in *matchInput) conditionTrace {
+	t := conditionTrace{
+		Type:    c.Type,
+		Pattern: c.Pattern,
+		Negate:  c.Negate,
+		Matched: compileCondition(c).match(in),
+		Value:   conditionValue(c, in),
+	}
+	if err := validateCondition(c); err != nil {
+		t.Error = err.Error()
+	}
+	return t
+}
+
+// conditionValue returns the part of the URL, or of the context it was opened
+// in, that a condition's pattern is compared against.
+func conditionValue(c Condition, in *matchInput) string {
+	switch c.Type {
+	case "domain":
+		return in.domain
+	case "domain_suffix", "host":
+		return in.parts.Host
+	case "keyword", "regex":
+		return in.url
+	case "glob":
+		return in.domain + " or " + in.url
+	case "scheme":
+		return in.parts.Scheme
+	case "port":
+		return in.parts.Port
+	case "path_prefix", "path_glob", "extension":
+		return in.parts.Path
+	case "query":
+		return in.parts.Query.Encode()
+	case "fragment":
+		return in.parts.Fragment
+	case "schedule":
+		now := in.now
+		if s, err := parseSchedule(c.Pattern); err == nil && s.loc != nil {
+			now = now.In(s.loc)
+		}
+		return now.Format("Mon 15:04 MST")
+	case "source_app":
+		if in.source == nil {
+			return "unknown app"
+		}
+		return in.source.describe()
+	case "mail_to", "mail_cc", "mail_subject":
+		if in.mail == nil {
+			return ""
+		}
+		switch c.Type {
+		case "mail_to":
+			return strings.Join(in.mail.To, ", ")
+		case "mail_cc":
+			return strings.Join(in.mail.Cc, ", ")
+		}
+		return in.mail.Subject
+	}
+	return ""
+}
+
+// describe lists the identifiers of a source app, for explaining matches.
+func (s *sourceApp) describe() string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range []string{s.FlatpakID, s.DesktopID, s.Exe} {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if s.Terminal {
+		ids = append(ids, "terminal")
+	}
+	return strings.Join(ids, ", ")
+}
+
+// writeTrace writes a trace as human-readable text.
+func writeTrace(w io.Writer, t urlTrace) {
+	fmt.Fprintf(w, "URL: %s\n", t.Input)
+	previous := t.Input
+	for _, step := range t.Steps {
+		if step.URL != previous {
+			fmt.Fprintf(w, "  %s: %s\n", step.Name, step.URL)
+			previous = step.URL
+		}
+	}
+	if t.Source != nil {
+		fmt.Fprintf(w, "Opened from: %s\n", t.Source.describe())
+	}
+
+	fmt.Fprintln(w)
+	if len(t.Rules) == 0 {
+		fmt.Fprintln(w, "No rules")
+	} else {
+		fmt.Fprintln(w, "Rules:")
+	}
+	for _, r := range t.Rules {
+		target := r.Browser
+		if r.AlwaysAsk {
+			target = "always ask"
+		}
+		var notes []string
+		if r.Disabled {
+			notes = append(notes, "disabled")
+		}
+		if r.Index == t.Decision.RuleIndex {
+			notes = append(notes, "used")
+		}
+		note := ""
+		if len(notes) > 0 {
+			note = " (" + strings.Join(notes, ", ") + ")"
+		}
+		name := r.Name
+		if name == "" {
+			name = "Unnamed rule"
+		}
+		fmt.Fprintf(w, "%s %d. %s → %s%s\n", matchMark(r.Matched), r.Index, name, target, note)
+		writeConditionTrace(w, r.Conditions, "    ", true)
+	}
+
+	fmt.Fprintln(w)
+	switch t.Decision.Action {
+	case routeBrowser, routeFavorite, routeFallback:
+		fmt.Fprintf(w, "Decision: open in %s, %s\n", t.Decision.Browser, t.Decision.Reason)
+	default:
+		fmt.Fprintf(w, "Decision: show the picker, %s\n", t.Decision.Reason)
+	}
+	if len(t.Decision.Fallbacks) > 0 {
+		fmt.Fprintf(w, "Fallbacks: %s\n", strings.Join(t.Decision.Fallbacks, ", "))
+	}
+	if t.DBus != "" {
+		fmt.Fprintf(w, "D-Bus: %s.Open on %s, falling back to the command\n", dbusApplicationInterface, t.DBus)
+	}
+	if t.CommandError != "" {
+		fmt.Fprintf(w, "Command: can't be run, %s\n", t.CommandError)
+	}
+	if len(t.Command) > 0 {
+		var env []string
+		for _, e := range t.Env {
+			name, value, _ := strings.Cut(e, "=")
+			env = append(env, name+"="+shellJoin([]string{value}))
+		}
+		fmt.Fprintf(w, "Command: %s\n", strings.Join(append(env, shellJoin(t.Command)), " "))
+	}
+}
+
+// writeConditionTrace writes a condition tree, one condition per line. A rule's
+// root group is only written when it combines several conditions.
+func writeConditionTrace(w io.Writer, c conditionTrace, indent string, root bool) {
+	if c.Logic != "" {
+		if !root || c.Negate || len(c.Children) > 1 {
+			fmt.Fprintf(w, "%s%s %s:\n", indent, matchMark(c.Matched), groupLabel(c))
+			indent += "    "
+		}
+		for _, child := range c.Children {
+			writeConditionTrace(w, child, indent, false)
+		}
+		return
+	}
+
+	line := fmt.Sprintf("%s%s %s", indent, matchMark(c.Matched), formatCondition(Condition{Type: c.Type, Pattern: c.Pattern, Negate: c.Negate}))
+	switch {
+	case c.Error != "":
+		line += " (invalid: " + c.Error + ")"
+	case c.Value != "":
+		line += fmt.Sprintf(" (was %q)", c.Value)
+	default:
+		line += " (was empty)"
+	}
+	fmt.Fprintln(w, line)
+}
+
+// groupLabel describes how a group combines its conditions.
+func groupLabel(c conditionTrace) string {
+	switch {
+	case c.Negate && c.Logic == "any":
+		return "None of"
+	case c.Negate:
+		return "Not all of"
+	case c.Logic == "any":
+		return "Any of"
+	default:
+		return "All of"
+	}
+}
+
+func matchMark(matched bool) string {
+	if matched {
+		return "✓"
+	}
+	return "✗"
+}
+
+// shellJoin joins arguments into a command line that can be pasted into a shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`&|;<>()*?[]#~!{}") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,332 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCommandlines returns a commandline lookup for explainURL. Desktop actions
+// are keyed by "browser/action", and browsers without the action use their own.
+func testCommandlines(cmdlines map[string]string) func(string, string) (execEntry, bool) {
+	return func(id, action string) (execEntry, bool) {
+		if cmdline, ok := cmdlines[id+"/"+action]; ok && action != "" {
+			return execEntry{Exec: cmdline}, true
+		}
+		cmdline, ok := cmdlines[id]
+		return execEntry{Exec: cmdline}, ok
+	}
+}
+
+func explainTestConfig() *Config {
+	return &Config{
+		PromptOnClick: true,
+		Rewrites:      []Rewrite{{StripParams: []string{"utm_*"}}},
+		Rules: []Rule{
+			{
+				Name:    "Work",
+				Browser: "chromium.desktop",
+				Logic:   "all",
+				Conditions: []Condition{
+					{Type: "domain_suffix", Pattern: "github.com"},
+					{Type: "path_prefix", Pattern: "/work"},
+				},
+			},
+			{
+				Name:       "Off",
+				Browser:    "chromium.desktop",
+				Disabled:   true,
+				Conditions: []Condition{{Type: "keyword", Pattern: "github"}},
+			},
+			{
+				Name:    "GitHub",
+				Browser: "firefox.desktop",
+				Conditions: []Condition{
+					{Type: "domain", Pattern: "github.com"},
+				},
+				Groups: []ConditionGroup{
+					{Logic: "any", Negate: true, Conditions: []Condition{
+						{Type: "query", Pattern: "tab=private"},
+						{Type: "source_app", Pattern: "thunderbird"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// TestConfigExplainURL tests the routing trace
+func TestConfigExplainURL(t *testing.T) {
+	cmdlines := testCommandlines(map[string]string{
+		"firefox.desktop":  "firefox --new-window %u",
+		"chromium.desktop": "chromium %U",
+	})
+
+	trace := explainTestConfig().explainURL("  https://github.com/alice?utm_source=x&tab=repos ", nil, cmdlines)
+
+	if trace.URL != "https://github.com/alice?tab=repos" {
+		t.Errorf("URL = %q", trace.URL)
+	}
+	if trace.Steps[0].Name != "sanitize" || trace.Steps[0].URL != "https://github.com/alice?utm_source=x&tab=repos" {
+		t.Errorf("first step = %+v, want sanitize", trace.Steps[0])
+	}
+
+	if len(trace.Rules) != 3 {
+		t.Fatalf("got %d rule traces, want 3", len(trace.Rules))
+	}
+	work, off, github := trace.Rules[0], trace.Rules[1], trace.Rules[2]
+	if work.Matched || !work.Conditions.Children[0].Matched || work.Conditions.Children[1].Matched {
+		t.Errorf("Work trace = %+v", work)
+	}
+	if got := work.Conditions.Children[1].Value; got != "/alice" {
+		t.Errorf("path_prefix value = %q, want /alice", got)
+	}
+	if off.Matched || !off.Disabled || !off.Conditions.Matched {
+		t.Errorf("disabled rule trace = %+v, want conditions matched but rule not", off)
+	}
+	if !github.Matched || len(github.Conditions.Children) != 2 || !github.Conditions.Children[1].Matched {
+		t.Errorf("GitHub trace = %+v", github)
+	}
+	if got := github.Conditions.Children[1].Children[1].Value; got != "unknown app" {
+		t.Errorf("source_app value = %q, want unknown app", got)
+	}
+
+	if trace.Decision.Action != routeBrowser || trace.Decision.Browser != "firefox.desktop" || trace.Decision.RuleIndex != 3 {
+		t.Errorf("Decision = %+v", trace.Decision)
+	}
+	want := []string{"firefox", "--new-window", "https://github.com/alice?tab=repos"}
+	if strings.Join(trace.Command, " ") != strings.Join(want, " ") {
+		t.Errorf("Command = %q, want %q", trace.Command, want)
+	}
+}
+
+// TestConfigExplainURL_Source tests that the source app is part of the trace
+func TestConfigExplainURL_Source(t *testing.T) {
+	cmdlines := testCommandlines(map[string]string{"firefox.desktop": "firefox %u"})
+	source := &sourceApp{Exe: "thunderbird", DesktopID: "org.mozilla.Thunderbird.desktop"}
+
+	trace := explainTestConfig().explainURL("https://github.com/alice", source, cmdlines)
+
+	if trace.Rules[2].Matched {
+		t.Error("GitHub rule matched a link from Thunderbird")
+	}
+	if got := trace.Rules[2].Conditions.Children[1].Children[1].Value; got != "org.mozilla.Thunderbird.desktop, thunderbird" {
+		t.Errorf("source_app value = %q", got)
+	}
+	if trace.Decision.Action != routePicker || trace.Command != nil {
+		t.Errorf("Decision = %+v, Command = %v, want the picker", trace.Decision, trace.Command)
+	}
+}
+
+// TestConfigExplainURL_Schedule tests that schedules show the time they were checked at
+func TestConfigExplainURL_Schedule(t *testing.T) {
+	setClock(t, time.Date(2025, 3, 3, 10, 30, 0, 0, time.UTC)) // a Monday
+
+	cfg := &Config{Rules: []Rule{{
+		Browser:    "firefox.desktop",
+		Conditions: []Condition{{Type: "schedule", Pattern: "mon-fri 09:00-17:00 UTC"}},
+	}}}
+	trace := cfg.explainURL("https://example.com", nil, testCommandlines(nil))
+
+	cond := trace.Rules[0].Conditions.Children[0]
+	if !cond.Matched || cond.Value != "Mon 10:30 UTC" {
+		t.Errorf("schedule trace = %+v", cond)
+	}
+	if trace.Decision.Action != routePicker {
+		t.Errorf("Decision = %+v, want the picker since firefox isn't installed", trace.Decision)
+	}
+}
+
+// TestConfigExplainURL_LaunchOptions tests that the command uses the rule's
+// desktop action, arguments and environment
+func TestConfigExplainURL_LaunchOptions(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	cmdlines := testCommandlines(map[string]string{
+		"firefox.desktop":                    "firefox %u",
+		"firefox.desktop/new-private-window": "firefox --private-window %u",
+	})
+	cfg := &Config{Rules: []Rule{{
+		Browser:    "firefox.desktop",
+		Action:     "new-private-window",
+		Args:       []string{"--kiosk"},
+		Env:        map[string]string{"MOZ_ENABLE_WAYLAND": "1", "LANG": "de_DE.UTF-8"},
+		Conditions: []Condition{{Type: "domain", Pattern: "bank.example"}},
+	}}}
+
+	trace := cfg.explainURL("https://bank.example", nil, cmdlines)
+
+	if trace.Decision.Launch == nil || trace.Decision.Launch.Action != "new-private-window" {
+		t.Errorf("Decision = %+v, want the rule's launch options", trace.Decision)
+	}
+	want := []string{"firefox", "--private-window", "--kiosk", "https://bank.example"}
+	if strings.Join(trace.Command, " ") != strings.Join(want, " ") {
+		t.Errorf("Command = %q, want %q", trace.Command, want)
+	}
+	if strings.Join(trace.Env, " ") != "LANG=de_DE.UTF-8 MOZ_ENABLE_WAYLAND=1" {
+		t.Errorf("Env = %q", trace.Env)
+	}
+
+	var buf bytes.Buffer
+	writeTrace(&buf, trace)
+	if want := "Command: LANG=de_DE.UTF-8 MOZ_ENABLE_WAYLAND=1 firefox --private-window --kiosk https://bank.example\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("trace is missing %q:\n%s", want, buf.String())
+	}
+
+	// Browsers without the action are launched normally
+	cfg.Rules[0].Action = "new-incognito-window"
+	trace = cfg.explainURL("https://bank.example", nil, cmdlines)
+	want = []string{"firefox", "--kiosk", "https://bank.example"}
+	if strings.Join(trace.Command, " ") != strings.Join(want, " ") {
+		t.Errorf("Command = %q, want %q", trace.Command, want)
+	}
+}
+
+// TestConfigExplainURL_CustomTarget tests the command of a custom target
+func TestConfigExplainURL_CustomTarget(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	cfg := &Config{
+		Targets: []CustomTarget{{ID: "mpv", Command: "mpv --force-window {url}"}},
+		Rules: []Rule{{
+			Browser:    "custom:mpv",
+			Args:       []string{"--fs"},
+			Conditions: []Condition{{Type: "domain_suffix", Pattern: "youtube.com"}},
+		}},
+	}
+	cmdlines := testCommandlines(map[string]string{"custom:mpv": cfg.Targets[0].Command})
+
+	trace := cfg.explainURL("https://www.youtube.com/watch?v=abc", nil, cmdlines)
+
+	want := []string{"mpv", "--fs", "--force-window", "https://www.youtube.com/watch?v=abc"}
+	if trace.Decision.Browser != "custom:mpv" || !reflect.DeepEqual(trace.Command, want) {
+		t.Errorf("Decision = %+v, Command = %q, want %q", trace.Decision, trace.Command, want)
+	}
+}
+
+// TestConfigExplainURL_DBus tests that D-Bus activatable browsers are opened over D-Bus when they can be
+func TestConfigExplainURL_DBus(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	cmdlines := func(id, action string) (execEntry, bool) {
+		return execEntry{Exec: "epiphany %u", DBus: "org.gnome.Epiphany"}, id == "org.gnome.Epiphany.desktop"
+	}
+	cfg := &Config{Rules: []Rule{{
+		Browser:    "org.gnome.Epiphany.desktop",
+		Conditions: []Condition{{Type: "domain", Pattern: "gnome.org"}},
+	}}}
+
+	trace := cfg.explainURL("https://gnome.org", nil, cmdlines)
+	if trace.DBus != "org.gnome.Epiphany" {
+		t.Errorf("DBus = %q, want %q", trace.DBus, "org.gnome.Epiphany")
+	}
+	var buf bytes.Buffer
+	writeTrace(&buf, trace)
+	for _, want := range []string{
+		"D-Bus: org.freedesktop.Application.Open on org.gnome.Epiphany, falling back to the command\n",
+		"Command: epiphany https://gnome.org\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("trace is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Extra arguments can only be passed on the command line
+	cfg.Rules[0].Args = []string{"--private-instance"}
+	if trace := cfg.explainURL("https://gnome.org", nil, cmdlines); trace.DBus != "" {
+		t.Errorf("DBus = %q with extra arguments, want empty", trace.DBus)
+	}
+}
+
+// TestConfigExplainURL_Fallbacks tests explaining a missing browser's fallback
+func TestConfigExplainURL_Fallbacks(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	cfg := &Config{
+		FallbackBrowsers: []string{"firefox.desktop"},
+		Rules: []Rule{{
+			Browser:    "edge.desktop",
+			Fallbacks:  []string{"chromium.desktop"},
+			Conditions: []Condition{{Type: "domain", Pattern: "work.example"}},
+		}},
+	}
+	cmdlines := testCommandlines(map[string]string{"chromium.desktop": "chromium %U", "firefox.desktop": "firefox %u"})
+
+	trace := cfg.explainURL("https://work.example", nil, cmdlines)
+	var buf bytes.Buffer
+	writeTrace(&buf, trace)
+	for _, want := range []string{
+		"Decision: open in chromium.desktop, rule 1 matched, but edge.desktop is not installed, so its fallback chromium.desktop is used\n",
+		"Fallbacks: firefox.desktop\n",
+		"Command: chromium https://work.example\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("trace is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestWriteTrace tests the human-readable trace
+func TestWriteTrace(t *testing.T) {
+	cmdlines := testCommandlines(map[string]string{"firefox.desktop": "firefox %u"})
+	trace := explainTestConfig().explainURL("https://github.com/alice?utm_source=x&tab=repos", nil, cmdlines)
+
+	var buf bytes.Buffer
+	writeTrace(&buf, trace)
+	out := buf.String()
+
+	for _, want := range []string{
+		"URL: https://github.com/alice?utm_source=x&tab=repos",
+		"  rewrite: https://github.com/alice?tab=repos",
+		`✗ 1. Work → chromium.desktop`,
+		"    ✗ All of:",
+		`        ✓ Domain and Subdomains: github.com (was "github.com")`,
+		`✗ 2. Off → chromium.desktop (disabled)`,
+		`✓ 3. GitHub → firefox.desktop (used)`,
+		`        ✗ Query Parameter: tab=private (was "tab=repos")`,
+		"        ✓ None of:",
+		`            ✗ Opened From: thunderbird (was "unknown app")`,
+		`Decision: open in firefox.desktop, rule 3 ("GitHub") matched`,
+		`Command: firefox 'https://github.com/alice?tab=repos'`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("trace is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestExplainURL_JSON tests that the trace can be encoded as JSON
+func TestExplainURL_JSON(t *testing.T) {
+	cmdlines := testCommandlines(map[string]string{"firefox.desktop": "firefox %u"})
+	trace := explainTestConfig().explainURL("https://github.com/alice", nil, cmdlines)
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded struct {
+		URL      string
+		Rules    []struct{ Matched bool }
+		Decision struct {
+			Action  string
+			Browser string
+		}
+		Command []string
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Decision.Action != "browser" || decoded.Decision.Browser != "firefox.desktop" || len(decoded.Rules) != 3 || len(decoded.Command) != 2 {
+		t.Errorf("decoded trace = %+v\n%s", decoded, data)
+	}
+}
+
+// TestShellJoin tests quoting commands for display
+func TestShellJoin(t *testing.T) {
+	got := shellJoin([]string{"firefox", "--new-window", "https://example.com/?a=1&b=2", "it's", ""})
+	want := `firefox --new-window 'https://example.com/?a=1&b=2' 'it'\''s' ''`
+	if got != want {
+		t.Errorf("shellJoin() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// launchFailure is a browser that failed to open a group's URLs.
+type launchFailure struct {
+	Browser string
+	Err     error
+}
+
+// launchWithFallbacks opens the group's URLs in its browser and, if it fails to
+// start, in each of its fallbacks in turn. Fallbacks are launched normally,
+// since the group's launch options are meant for its browser. It returns the
+// browser that opened the URLs, "" if none did, and the browsers that failed.
+func (g launchGroup) launchWithFallbacks(launch func(browserID string, opts launchOptions) error) (string, []launchFailure) {
+	var failures []launchFailure
+	opts := g.Launch
+	for _, id := range append([]string{g.Browser}, g.Fallbacks...) {
+		err := launch(id, opts)
+		if err == nil {
+			return id, failures
+		}
+		failures = append(failures, launchFailure{Browser: id, Err: err})
+		opts = launchOptions{}
+	}
+	return "", failures
+}
+
+// fallbackNotice returns the title and body of the notification telling the
+// user that links didn't open where they were meant to, or "" if they did.
+// used is the browser that opened them, "" if none did, and name returns a
+// browser's display name.
+func (g launchGroup) fallbackNotice(used string, failures []launchFailure, name func(browserID string) string) (title, body string) {
+	if g.Missing == "" && len(failures) == 0 {
+		return "", ""
+	}
+
+	var problems []string
+	if g.Missing != "" {
+		problems = append(problems, fmt.Sprintf("%s is not installed.", name(g.Missing)))
+	}
+	for _, f := range failures {
+		problems = append(problems, fmt.Sprintf("%s failed to start: %v.", name(f.Browser), f.Err))
+	}
+	body = strings.Join(problems, " ")
+
+	links := "link"
+	if len(g.URLs) > 1 {
+		links = "links"
+	}
+	if used == "" {
+		return fmt.Sprintf("Couldn't open %s", links), body + " Choose another browser."
+	}
+	return fmt.Sprintf("Opened %s in %s", links, name(used)), body
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestLaunchGroupLaunchWithFallbacks tests trying fallbacks in order until one starts
+func TestLaunchGroupLaunchWithFallbacks(t *testing.T) {
+	group := launchGroup{
+		Browser:   "firefox.desktop",
+		Launch:    launchOptions{Action: "new-private-window"},
+		Fallbacks: []string{"chromium.desktop", "epiphany.desktop"},
+		URLs:      []string{"https://a.example"},
+	}
+
+	tests := []struct {
+		name         string
+		failing      map[string]bool
+		wantUsed     string
+		wantTried    []string
+		wantFailures int
+	}{
+		{name: "browser starts", wantUsed: "firefox.desktop", wantTried: []string{"firefox.desktop"}},
+		{
+			name: "first fallback starts", failing: map[string]bool{"firefox.desktop": true},
+			wantUsed: "chromium.desktop", wantTried: []string{"firefox.desktop", "chromium.desktop"}, wantFailures: 1,
+		},
+		{
+			name: "nothing starts", failing: map[string]bool{"firefox.desktop": true, "chromium.desktop": true, "epiphany.desktop": true},
+			wantTried: []string{"firefox.desktop", "chromium.desktop", "epiphany.desktop"}, wantFailures: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tried []string
+			used, failures := group.launchWithFallbacks(func(id string, opts launchOptions) error {
+				tried = append(tried, id)
+				// Only the group's own browser gets its launch options
+				if (id == group.Browser) != (opts.Action != "") {
+					t.Errorf("%s launched with %+v", id, opts)
+				}
+				if tt.failing[id] {
+					return errors.New("exit status 1")
+				}
+				return nil
+			})
+			if used != tt.wantUsed || !reflect.DeepEqual(tried, tt.wantTried) || len(failures) != tt.wantFailures {
+				t.Errorf("launchWithFallbacks() = %q after %q with %d failures, want %q after %q with %d",
+					used, tried, len(failures), tt.wantUsed, tt.wantTried, tt.wantFailures)
+			}
+		})
+	}
+}
+
+// TestLaunchGroupFallbackNotice tests the notification about fallbacks
+func TestLaunchGroupFallbackNotice(t *testing.T) {
+	names := map[string]string{"firefox.desktop": "Firefox", "chromium.desktop": "Chromium"}
+	name := func(id string) string {
+		if n, ok := names[id]; ok {
+			return n
+		}
+		return id
+	}
+	failed := []launchFailure{{Browser: "firefox.desktop", Err: errors.New("firefox exited right away: exit status 1")}}
+
+	tests := []struct {
+		name      string
+		group     launchGroup
+		used      string
+		failures  []launchFailure
+		wantTitle string
+		wantBody  string
+	}{
+		{name: "opened as meant", group: launchGroup{Browser: "firefox.desktop", URLs: []string{"a"}}, used: "firefox.desktop"},
+		{
+			name: "missing browser", group: launchGroup{Browser: "chromium.desktop", Missing: "edge.desktop", URLs: []string{"a"}},
+			used: "chromium.desktop", wantTitle: "Opened link in Chromium", wantBody: "edge.desktop is not installed.",
+		},
+		{
+			name: "failed browser", group: launchGroup{Browser: "firefox.desktop", URLs: []string{"a", "b"}},
+			used: "chromium.desktop", failures: failed,
+			wantTitle: "Opened links in Chromium", wantBody: "Firefox failed to start: firefox exited right away: exit status 1.",
+		},
+		{
+			name: "nothing started", group: launchGroup{Browser: "firefox.desktop", URLs: []string{"a"}}, failures: failed,
+			wantTitle: "Couldn't open link", wantBody: "Firefox failed to start: firefox exited right away: exit status 1. Choose another browser.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, body := tt.group.fallbackNotice(tt.used, tt.failures, name)
+			if title != tt.wantTitle || body != tt.wantBody {
+				t.Errorf("fallbackNotice() = %q, %q, want %q, %q", title, body, tt.wantTitle, tt.wantBody)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@
 
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // formatRuleSubtitle formats a subtitle for a rule row with pattern included
 func formatRuleSubtitle(rule *Rule, browserName string) string {
@@ -17,8 +20,10 @@ func formatRuleSubtitleNoPattern(rule *Rule, browserName string) string {
 // formatRuleSubtitleInternal is the internal implementation for formatting rule subtitles
 func formatRuleSubtitleInternal(rule *Rule, browserName string, includePattern bool) string {
 	// Handle multi-condition format
-	if len(rule.Conditions) > 0 {
-		condCount := len(rule.Conditions)
+	root := rule.rootGroup()
+	if !root.isEmpty() {
+		condCount := countConditions(root)
+		single := len(rule.Conditions) == 1 && len(rule.Groups) == 0
 		var logicText string
 		if rule.Logic == "any" {
 			logicText = "Any match"
@@ -27,13 +32,13 @@ func formatRuleSubtitleInternal(rule *Rule, browserName string, includePattern b
 		}
 
 		if rule.AlwaysAsk {
-			if condCount == 1 && includePattern {
-				return fmt.Sprintf("%s: %s · Always ask", getTypeLabel(rule.Conditions[0].Type), rule.Conditions[0].Pattern)
+			if single && includePattern {
+				return fmt.Sprintf("%s · Always ask", formatCondition(rule.Conditions[0]))
 			}
 			return fmt.Sprintf("%d conditions (%s) · Always ask", condCount, logicText)
 		}
-		if condCount == 1 && includePattern {
-			return fmt.Sprintf("%s: %s · Opens in %s", getTypeLabel(rule.Conditions[0].Type), rule.Conditions[0].Pattern, browserName)
+		if single && includePattern {
+			return fmt.Sprintf("%s · Opens in %s", formatCondition(rule.Conditions[0]), browserName)
 		}
 		return fmt.Sprintf("%d conditions (%s) · Opens in %s", condCount, logicText, browserName)
 	}
@@ -42,18 +47,88 @@ func formatRuleSubtitleInternal(rule *Rule, browserName string, includePattern b
 	return "No conditions"
 }
 
+// formatRewriteSubtitle formats a subtitle for a rewrite row, describing what it
+// does and which URLs it applies to
+func formatRewriteSubtitle(rw *Rewrite) string {
+	var action string
+	switch {
+	case len(rw.StripParams) > 0 && rw.Template != "":
+		action = fmt.Sprintf("Removes %s, then rewrites to %s", strings.Join(rw.StripParams, ", "), rw.Template)
+	case len(rw.StripParams) > 0:
+		action = fmt.Sprintf("Removes %s", strings.Join(rw.StripParams, ", "))
+	default:
+		action = fmt.Sprintf("Rewrites to %s", rw.Template)
+	}
+
+	group := rw.conditionGroup()
+	if group.isEmpty() {
+		return action + " · All URLs"
+	}
+	if len(rw.Conditions) == 1 && len(rw.Groups) == 0 {
+		return fmt.Sprintf("%s · %s", action, formatCondition(rw.Conditions[0]))
+	}
+	return fmt.Sprintf("%s · %d conditions", action, countConditions(group))
+}
+
+// formatCondition formats a condition as "Label: pattern", prefixed with "Not" when negated
+func formatCondition(c Condition) string {
+	if c.Negate {
+		return fmt.Sprintf("Not %s: %s", getTypeLabel(c.Type), c.Pattern)
+	}
+	return fmt.Sprintf("%s: %s", getTypeLabel(c.Type), c.Pattern)
+}
+
+// countConditions counts the conditions in a group and all of its nested groups
+func countConditions(g ConditionGroup) int {
+	count := len(g.Conditions)
+	for _, sub := range g.Groups {
+		count += countConditions(sub)
+	}
+	return count
+}
+
+// conditionTypes lists every condition type with its display label, in the order
+// they appear in the condition type dropdowns.
+var conditionTypes = []struct {
+	Type  string
+	Label string
+}{
+	{"domain", "Exact Domain"},
+	{"domain_suffix", "Domain and Subdomains"},
+	{"keyword", "URL Contains"},
+	{"glob", "Wildcard"},
+	{"regex", "Regex"},
+	{"scheme", "Scheme"},
+	{"host", "Host"},
+	{"port", "Port"},
+	{"path_prefix", "Path Starts With"},
+	{"path_glob", "Path Wildcard"},
+	{"query", "Query Parameter"},
+	{"fragment", "Fragment"},
+	{"extension", "File Extension"},
+	{"schedule", "Schedule"},
+	{"source_app", "Opened From"},
+	{"mail_to", "Mail To"},
+	{"mail_cc", "Mail Cc or Bcc"},
+	{"mail_subject", "Mail Subject"},
+}
+
+// isKnownConditionType reports whether condType is one of the supported condition types
+func isKnownConditionType(condType string) bool {
+	for _, ct := range conditionTypes {
+		if ct.Type == condType {
+			return true
+		}
+	}
+	return false
+}
+
 // getTypeLabel returns a human-readable label for a condition type
 func getTypeLabel(patternType string) string {
-	switch patternType {
-	case "domain":
-		return "Exact Domain"
-	case "keyword":
-		return "URL Contains"
-	case "glob":
-		return "Wildcard"
-	case "regex":
-		return "Regex"
-	default:
-		return patternType
+	for _, ct := range conditionTypes {
+		if ct.Type == patternType {
+			return ct.Label
+		}
 	}
+	return patternType
 }
@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistoryDays       = 30   // days entries are kept, unless history_days is set
+	defaultHistoryMaxEntries = 1000 // entries kept in the history file, unless history_max_entries is set
+)
+
+// historyEntry is a routed link in the history file, one JSON object per line.
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`                 // only the scheme and host with history_host_only
+	Rule     int       `json:"rule,omitempty"`      // 1-based position of the matched rule, 0 if none
+	RuleName string    `json:"rule_name,omitempty"` // kept since positions change as rules are edited
+	Browser  string    `json:"browser"`
+	Picker   bool      `json:"picker,omitempty"` // the browser was chosen in the picker
+}
+
+// historyMu serializes access to the history file within this process.
+var historyMu sync.Mutex
+
+// historyPath returns where routed links are recorded.
+func historyPath() string {
+	return filepath.Join(stateDir(), "history.jsonl")
+}
+
+// historyEntries returns the entries for URLs opened in a browser. rules holds
+// the rule that matched each URL, and may be shorter than urls.
+func (cfg *Config) historyEntries(urls []string, rules []int, browserID string, picker bool) []historyEntry {
+	now := clock()
+	entries := make([]historyEntry, 0, len(urls))
+	for i, u := range urls {
+		entry := historyEntry{Time: now, URL: u, Browser: browserID, Picker: picker}
+		if cfg.HistoryHostOnly {
+			entry.URL = historyHost(u)
+		}
+		if i < len(rules) && rules[i] > 0 && rules[i] <= len(cfg.Rules) {
+			entry.Rule = rules[i]
+			entry.RuleName = cfg.Rules[rules[i]-1].Name
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// historyHost cuts a URL down to its scheme and host, e.g. "https://github.com",
+// or only the scheme for links without a host, like "mailto:".
+func historyHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	if u.Host == "" {
+		return u.Scheme + ":"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// recordHistory adds entries to the history file if history is turned on.
+// They're appended, and once a day, on the first link recorded that day, the
+// file is rewritten without entries older than history_days and the oldest
+// beyond history_max_entries. Failing to write the history isn't an error.
+func (cfg *Config) recordHistory(entries []historyEntry) {
+	if !cfg.History || len(entries) == 0 {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	path := historyPath()
+	var err error
+	if last, ok := lastHistoryTime(path); ok && sameDay(last, clock()) {
+		err = appendHistory(path, entries)
+	} else {
+		err = writeHistory(path, cfg.pruneHistory(append(readHistory(path), entries...)))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write history: %v\n", err)
+	}
+}
+
+// sameDay reports whether a and b are on the same day in local time.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Local().Date()
+	by, bm, bd := b.Local().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// historyTailSize is how much of the end of the history file is read to find
+// the newest entry.
+const historyTailSize = 16 * 1024
+
+// lastHistoryTime returns when the newest entry in the history file was
+// recorded, reading only the end of the file. It returns false if the file is
+// missing or its last line can't be read.
+func lastHistoryTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	offset := max(info.Size()-historyTailSize, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil {
+		return time.Time{}, false
+	}
+	tail = bytes.TrimRight(tail, "\n")
+	var e historyEntry
+	if json.Unmarshal(tail[bytes.LastIndexByte(tail, '\n')+1:], &e) != nil {
+		return time.Time{}, false
+	}
+	return e.Time, true
+}
+
+// pruneHistory returns the entries within the retention and size limits.
+func (cfg *Config) pruneHistory(entries []historyEntry) []historyEntry {
+	days, limit := cfg.HistoryDays, cfg.HistoryMaxEntries
+	if days <= 0 {
+		days = defaultHistoryDays
+	}
+	if limit <= 0 {
+		limit = defaultHistoryMaxEntries
+	}
+
+	cutoff := clock().AddDate(0, 0, -days)
+	var kept []historyEntry
+	for _, e := range entries {
+		if !e.Time.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) > limit {
+		kept = kept[len(kept)-limit:]
+	}
+	return kept
+}
+
+// readHistory reads the history file, oldest entry first. Lines that can't be
+// read, e.g. one cut short by a crash, are skipped.
+func readHistory(path string) []historyEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entries []historyEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e historyEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// encodeHistory returns entries as JSON lines.
+func encodeHistory(entries []historyEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// appendHistory adds entries to the end of the history file.
+func appendHistory(path string, entries []historyEntry) error {
+	data, err := encodeHistory(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeHistory replaces the history file atomically, so concurrent Switchyard
+// processes never read a partial file.
+func writeHistory(path string, entries []historyEntry) error {
+	data, err := encodeHistory(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*.jsonl")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadHistory returns the recorded links, newest first.
+func loadHistory() []historyEntry {
+	historyMu.Lock()
+	entries := readHistory(historyPath())
+	historyMu.Unlock()
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// clearHistory deletes all recorded links.
+func clearHistory() error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if err := os.Remove(historyPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// searchHistory returns the entries whose URL, browser or rule name contains
+// query, ignoring case. name returns a browser's display name, which is
+// searched too.
+func searchHistory(entries []historyEntry, query string, name func(browserID string) string) []historyEntry {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return entries
+	}
+	var found []historyEntry
+	for _, e := range entries {
+		for _, field := range []string{e.URL, e.Browser, name(e.Browser), e.RuleName} {
+			if strings.Contains(strings.ToLower(field), query) {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// ruleTemplate returns a new rule that opens links like the entry's in its
+// browser: on the same host, or with the same scheme for links without one.
+// It returns nil if the entry's link can't be parsed.
+func (e historyEntry) ruleTemplate() *Rule {
+	u, err := url.Parse(e.URL)
+	if err != nil || u.Scheme == "" {
+		return nil
+	}
+	rule := &Rule{Browser: e.Browser, Logic: "all"}
+	if u.Hostname() != "" {
+		rule.Name = u.Hostname()
+		rule.Conditions = []Condition{{Type: "domain", Pattern: u.Hostname()}}
+	} else {
+		rule.Name = u.Scheme + " links"
+		rule.Conditions = []Condition{{Type: "scheme", Pattern: u.Scheme}}
+	}
+	return rule
+}
+
+// pickerRules returns the always ask rule that sent each URL to the picker, or
+// 0 for URLs no rule matched.
+func (cfg *Config) pickerRules(urls []string, source *sourceApp) []int {
+	rules := make([]int, len(urls))
+	for i, u := range urls {
+		if d := cfg.route(u, source, func(string) bool { return true }); d.Action == routeAsk {
+			rules[i] = d.RuleIndex
+		}
+	}
+	return rules
+}
+
+// formatHistorySubtitle describes where an entry's link was opened, which rule
+// matched and when, e.g. "Firefox · Rule 2 ("Work") · Oct 17, 14:03".
+func formatHistorySubtitle(e historyEntry, browserName string) string {
+	parts := []string{browserName}
+	if e.Rule > 0 {
+		parts = append(parts, fmt.Sprintf("Rule %d%s", e.Rule, quotedName(e.RuleName)))
+	}
+	if e.Picker {
+		parts = append(parts, "Chosen in picker")
+	}
+	parts = append(parts, e.Time.Local().Format("Jan 2, 15:04"))
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfigHistoryEntries tests the entries recorded for opened links
+func TestConfigHistoryEntries(t *testing.T) {
+	now := time.Date(2026, 10, 17, 14, 3, 0, 0, time.UTC)
+	setClock(t, now)
+	cfg := &Config{Rules: []Rule{{Name: "Work"}, {}}}
+	urls := []string{"https://github.com/alice?tab=repos", "mailto:bob@example.com", "https://example.com/"}
+
+	got := cfg.historyEntries(urls, []int{1, 2, 0}, "firefox.desktop", false)
+	want := []historyEntry{
+		{Time: now, URL: urls[0], Rule: 1, RuleName: "Work", Browser: "firefox.desktop"},
+		{Time: now, URL: urls[1], Rule: 2, Browser: "firefox.desktop"},
+		{Time: now, URL: urls[2], Browser: "firefox.desktop"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("historyEntries() = %+v, want %+v", got, want)
+	}
+
+	cfg.HistoryHostOnly = true
+	got = cfg.historyEntries(urls, nil, "chromium.desktop", true)
+	for i, wantURL := range []string{"https://github.com", "mailto:", "https://example.com"} {
+		if got[i].URL != wantURL || got[i].Rule != 0 || !got[i].Picker {
+			t.Errorf("host only entry %d = %+v, want URL %q", i, got[i], wantURL)
+		}
+	}
+}
+
+// TestConfigRecordHistory tests writing the history file within its limits
+func TestConfigRecordHistory(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	setClock(t, start)
+
+	entry := func(u string) historyEntry { return historyEntry{Time: clock(), URL: u, Browser: "firefox.desktop"} }
+
+	// Turned off by default, nothing is written
+	off := &Config{}
+	off.recordHistory([]historyEntry{entry("https://a.example")})
+	if _, err := os.Stat(historyPath()); !os.IsNotExist(err) {
+		t.Fatalf("history written while turned off: %v", err)
+	}
+
+	cfg := &Config{History: true, HistoryDays: 7, HistoryMaxEntries: 3}
+	cfg.recordHistory([]historyEntry{entry("https://a.example"), entry("https://b.example")})
+	setClock(t, start.AddDate(0, 0, 5))
+	cfg.recordHistory([]historyEntry{entry("https://c.example")})
+	if got := historyURLs(loadHistory()); got != "https://c.example https://b.example https://a.example" {
+		t.Errorf("history = %s", got)
+	}
+
+	// Later links that day are only appended, even beyond the size limit
+	cfg.recordHistory([]historyEntry{entry("https://d.example")})
+	if got := historyURLs(loadHistory()); got != "https://d.example https://c.example https://b.example https://a.example" {
+		t.Errorf("history over the size limit the same day = %s", got)
+	}
+
+	// The first link of the next day drops the oldest entries beyond the limit
+	setClock(t, start.AddDate(0, 0, 6))
+	cfg.recordHistory([]historyEntry{entry("https://e.example")})
+	if got := historyURLs(loadHistory()); got != "https://e.example https://d.example https://c.example" {
+		t.Errorf("history over the size limit the next day = %s", got)
+	}
+
+	// And those older than the retention
+	setClock(t, start.AddDate(0, 0, 13))
+	cfg.recordHistory([]historyEntry{entry("https://f.example")})
+	if got := historyURLs(loadHistory()); got != "https://f.example https://e.example" {
+		t.Errorf("history past the retention = %s", got)
+	}
+
+	if err := clearHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadHistory(); len(got) != 0 {
+		t.Errorf("history after clearing = %+v", got)
+	}
+	if err := clearHistory(); err != nil {
+		t.Errorf("clearing an empty history: %v", err)
+	}
+}
+
+// historyURLs joins the URLs of entries for comparison
+func historyURLs(entries []historyEntry) string {
+	urls := make([]string, len(entries))
+	for i, e := range entries {
+		urls[i] = e.URL
+	}
+	return strings.Join(urls, " ")
+}
+
+// TestReadHistory tests that broken lines don't lose the rest of the history
+func TestReadHistory(t *testing.T) {
+	path := t.TempDir() + "/history.jsonl"
+	data := `{"time":"2026-10-17T14:03:00Z","url":"https://a.example","browser":"firefox.desktop"}
+{"time":"2026-10-17T14:04:00Z","url":"https://b.exa
+{"time":"2026-10-17T14:05:00Z","url":"https://c.example","rule":2,"browser":"firefox.desktop","picker":true}
+`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got := readHistory(path)
+	if historyURLs(got) != "https://a.example https://c.example" || got[1].Rule != 2 || !got[1].Picker {
+		t.Errorf("readHistory() = %+v", got)
+	}
+	if got := readHistory(path + ".missing"); got != nil {
+		t.Errorf("readHistory() of a missing file = %+v", got)
+	}
+}
+
+// TestLastHistoryTime tests finding the newest entry from the end of the file
+func TestLastHistoryTime(t *testing.T) {
+	path := t.TempDir() + "/history.jsonl"
+	if _, ok := lastHistoryTime(path); ok {
+		t.Error("lastHistoryTime() of a missing file = true")
+	}
+
+	long := `{"time":"2026-10-17T14:03:00Z","url":"https://a.example/` + strings.Repeat("a", historyTailSize) + `","browser":"firefox.desktop"}`
+	data := long + "\n" + `{"time":"2026-10-17T14:05:00Z","url":"https://c.example","browser":"firefox.desktop"}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := lastHistoryTime(path); !ok || !got.Equal(time.Date(2026, 10, 17, 14, 5, 0, 0, time.UTC)) {
+		t.Errorf("lastHistoryTime() = %v, %v", got, ok)
+	}
+
+	// A last line cut short by a crash can't be read
+	if err := os.WriteFile(path, []byte(data+`{"time":"2026-10-17T14:06:00Z","url":"https://d.exa`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lastHistoryTime(path); ok {
+		t.Error("lastHistoryTime() of a broken last line = true")
+	}
+}
+
+// TestSearchHistory tests searching links, browsers and rule names
+func TestSearchHistory(t *testing.T) {
+	entries := []historyEntry{
+		{URL: "https://github.com/alice", Browser: "firefox.desktop", RuleName: "Code"},
+		{URL: "https://corp.example/wiki", Browser: "chromium.desktop", RuleName: "Work"},
+		{URL: "https://news.example", Browser: "firefox.desktop"},
+	}
+	name := func(id string) string {
+		return map[string]string{"firefox.desktop": "Firefox", "chromium.desktop": "Chromium"}[id]
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "https://github.com/alice https://corp.example/wiki https://news.example"},
+		{query: "GITHUB", want: "https://github.com/alice"},
+		{query: "chromium", want: "https://corp.example/wiki"},
+		{query: " work ", want: "https://corp.example/wiki"},
+		{query: "Firefox", want: "https://github.com/alice https://news.example"},
+		{query: "nothing", want: ""},
+	}
+	for _, tt := range tests {
+		if got := historyURLs(searchHistory(entries, tt.query, name)); got != tt.want {
+			t.Errorf("searchHistory(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestHistoryEntryRuleTemplate tests the rule prefilled from a history entry
+func TestHistoryEntryRuleTemplate(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Rule
+	}{
+		{
+			url:  "https://github.com:8443/alice?tab=repos",
+			want: Rule{Name: "github.com", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		},
+		{
+			url:  "https://github.com",
+			want: Rule{Name: "github.com", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		},
+		{
+			url:  "mailto:",
+			want: Rule{Name: "mailto links", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "scheme", Pattern: "mailto"}}},
+		},
+	}
+	for _, tt := range tests {
+		got := historyEntry{URL: tt.url, Browser: "firefox.desktop"}.ruleTemplate()
+		if got == nil || !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ruleTemplate() for %q = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+
+	// Links that can't be parsed don't make a rule
+	for _, u := range []string{"", "github.com", "https://a.example/%zz"} {
+		if got := (historyEntry{URL: u, Browser: "firefox.desktop"}).ruleTemplate(); got != nil {
+			t.Errorf("ruleTemplate() for %q = %+v, want nil", u, *got)
+		}
+	}
+}
+
+// TestConfigPickerRules tests finding the always ask rules that showed the picker
+func TestConfigPickerRules(t *testing.T) {
+	cfg := &Config{Rules: []Rule{
+		{Browser: "firefox.desktop", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		{AlwaysAsk: true, Conditions: []Condition{{Type: "domain", Pattern: "ask.example"}}},
+	}}
+	got := cfg.pickerRules([]string{"https://ask.example/", "https://github.com/", "https://other.example/"}, nil)
+	if want := []int{2, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pickerRules() = %v, want %v", got, want)
+	}
+}
+
+// TestFormatHistorySubtitle tests describing where a link was opened
+func TestFormatHistorySubtitle(t *testing.T) {
+	at := time.Date(2026, 10, 17, 14, 3, 0, 0, time.Local)
+	tests := []struct {
+		entry historyEntry
+		want  string
+	}{
+		{entry: historyEntry{Time: at, Rule: 2, RuleName: "Work"}, want: `Firefox · Rule 2 ("Work") · Oct 17, 14:03`},
+		{entry: historyEntry{Time: at, Picker: true}, want: "Firefox · Chosen in picker · Oct 17, 14:03"},
+		{entry: historyEntry{Time: at, Rule: 3, Picker: true}, want: "Firefox · Rule 3 · Chosen in picker · Oct 17, 14:03"},
+	}
+	for _, tt := range tests {
+		if got := formatHistorySubtitle(tt.entry, "Firefox"); got != tt.want {
+			t.Errorf("formatHistorySubtitle(%+v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
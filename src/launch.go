@@ -3,57 +3,146 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 )
 
-// launchCommand executes a desktop file command line with URL substitution
+// launchCommand executes a desktop entry's Exec line with URL substitution
 // and proper activation token handling for window raising on Wayland.
-func launchCommand(cmdline, url string, appInfo *gio.AppInfo) error {
-	// Replace %u, %U, %f, %F with URL
-	cmdline = strings.ReplaceAll(cmdline, "%u", url)
-	cmdline = strings.ReplaceAll(cmdline, "%U", url)
-	cmdline = strings.ReplaceAll(cmdline, "%f", url)
-	cmdline = strings.ReplaceAll(cmdline, "%F", url)
+// Command lines that only take a single URL are run once per URL. extraArgs
+// are added before the URLs, and env, as KEY=VALUE pairs, to the environment.
+// D-Bus activatable apps are asked to open the URLs over D-Bus instead, and
+// the Exec line is only run if that fails.
+func launchCommand(entry execEntry, urls, extraArgs, env []string, appInfo *gio.AppInfo) error {
+	if entry.usesDBus(extraArgs, env) {
+		err := openWithDBus(entry.DBus, urls, activationToken(appInfo))
+		if err == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Couldn't activate %s over D-Bus, running it instead: %v\n", entry.DBus, err)
+	}
+
+	invocations, err := commandlineInvocations(entry, urls, extraArgs)
+	if err != nil {
+		return err
+	}
+	return startCommands(invocations, env, appInfo)
+}
 
-	// Remove other field codes
-	for _, code := range []string{"%i", "%c", "%k"} {
-		cmdline = strings.ReplaceAll(cmdline, code, "")
+// startCommands starts expanded command lines, and fails if one can't be
+// started or exits with an error right away. They're all watched together, so
+// running a command once per URL doesn't wait once per URL, see waitForStartup.
+// appInfo is nil for commands that aren't from a desktop file.
+func startCommands(invocations [][]string, env []string, appInfo *gio.AppInfo) error {
+	var started []*exec.Cmd
+	for _, parts := range invocations {
+		cmd, err := startCommand(parts, env, appInfo)
+		if err != nil {
+			return err
+		}
+		if cmd != nil {
+			started = append(started, cmd)
+		}
 	}
+	return waitForStartup(started, launchGracePeriod)
+}
 
-	// Parse the command line
-	parts := strings.Fields(cmdline)
+// startCommand starts one expanded command line without waiting for it.
+func startCommand(parts, env []string, appInfo *gio.AppInfo) (*exec.Cmd, error) {
 	if len(parts) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// Get activation token from GDK launch context for window raising on Wayland
-	var activationToken string
-	if display := gdk.DisplayGetDefault(); display != nil {
-		activationToken = display.AppLaunchContext().StartupNotifyID(appInfo, nil)
-	}
+	activationToken := activationToken(appInfo)
 
 	// When running in Flatpak, wrap with flatpak-spawn --host
 	// and pass activation token via --env flag
-	if os.Getenv("FLATPAK_ID") != "" && !strings.HasPrefix(parts[0], "flatpak-spawn") {
-		parts = append([]string{"flatpak-spawn", "--host", "--env=XDG_ACTIVATION_TOKEN=" + activationToken}, parts...)
+	if wrapped := hostArgs(parts, activationToken, env); len(wrapped) != len(parts) {
+		parts = wrapped
 		activationToken = "" // Already handled via flatpak-spawn
+		env = nil
 	}
 
 	// Execute the command
 	cmd := exec.Command(parts[0], parts[1:]...)
 	if activationToken != "" {
-		cmd.Env = append(os.Environ(), "XDG_ACTIVATION_TOKEN="+activationToken)
+		env = append(env, "XDG_ACTIVATION_TOKEN="+activationToken)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 
 	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// activationToken returns a startup notification ID from the GDK launch
+// context, so the launched app can raise its window. It's empty for commands
+// that aren't from a desktop file, or without a display.
+func activationToken(appInfo *gio.AppInfo) string {
+	display := gdk.DisplayGetDefault()
+	if display == nil || appInfo == nil {
+		return ""
+	}
+	return display.AppLaunchContext().StartupNotifyID(appInfo, nil)
+}
+
+// dbusOpenTimeout is how long an app is given to answer Open, including being
+// started by the bus, before its Exec line is run instead. The call blocks the
+// main loop, so it's much shorter than the D-Bus default of 25 seconds.
+const dbusOpenTimeout = 5 * time.Second
+
+// sessionBus returns the connection apps are opened over. Tests replace it.
+var sessionBus = func() (*gio.DBusConnection, error) {
+	return gio.BusGetSync(context.Background(), gio.BusTypeSession)
+}
+
+// openWithDBus asks a D-Bus activatable app to open URLs on the session bus.
+func openWithDBus(busName string, urls []string, activationToken string) error {
+	conn, err := sessionBus()
+	if err != nil {
 		return err
 	}
+	return dbusOpen(conn, busName, urls, activationToken)
+}
+
+// dbusOpen calls the Open method of org.freedesktop.Application on an app,
+// which the bus starts first if it isn't running. The activation token goes in
+// the platform data.
+func dbusOpen(conn *gio.DBusConnection, busName string, urls []string, activationToken string) error {
+	uris := make([]*glib.Variant, 0, len(urls))
+	for _, u := range urls {
+		uris = append(uris, glib.NewVariantString(u))
+	}
+
+	platformData := dbusPlatformData(activationToken)
+	keys := make([]string, 0, len(platformData))
+	for key := range platformData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]*glib.Variant, 0, len(keys))
+	for _, key := range keys {
+		value := glib.NewVariantVariant(glib.NewVariantString(platformData[key]))
+		entries = append(entries, glib.NewVariantDictEntry(glib.NewVariantString(key), value))
+	}
 
-	go cmd.Wait()
-	return nil
+	params := glib.NewVariantTuple([]*glib.Variant{
+		glib.NewVariantArray(glib.NewVariantType("s"), uris),
+		glib.NewVariantArray(glib.NewVariantType("{sv}"), entries),
+	})
+	_, err := conn.CallSync(context.Background(), busName, dbusObjectPath(busName), dbusApplicationInterface,
+		"Open", params, nil, gio.DBusCallFlagsNone, int(dbusOpenTimeout.Milliseconds()))
+	return err
 }
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// launchOptions are how a rule launches its browser: with one of its desktop
+// actions instead of its main command line, with extra arguments, and with
+// extra environment variables.
+type launchOptions struct {
+	Action string            `json:"action,omitempty"` // desktop action ID, e.g. "new-private-window"
+	Args   []string          `json:"args,omitempty"`   // added before the URLs
+	Env    map[string]string `json:"env,omitempty"`
+}
+
+// launchOptions returns how the rule launches its browser.
+func (r *Rule) launchOptions() launchOptions {
+	return launchOptions{Action: r.Action, Args: r.Args, Env: r.Env}
+}
+
+// isDefault reports whether the browser is launched as it is without a rule.
+func (o launchOptions) isDefault() bool {
+	return o.Action == "" && len(o.Args) == 0 && len(o.Env) == 0
+}
+
+// environ returns the environment variables as sorted KEY=VALUE pairs.
+func (o launchOptions) environ() []string {
+	env := make([]string, 0, len(o.Env))
+	for key, value := range o.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// extraArgs returns the arguments added before the URLs when launching a
+// browser target: the ones selecting its profile, then the rule's.
+func (o launchOptions) extraArgs(browserID string) []string {
+	return append(profileArgs(browserID), o.Args...)
+}
+
+// key identifies the options, so URLs launched the same way can be grouped.
+func (o launchOptions) key() string {
+	return o.Action + "\x00" + strings.Join(o.Args, "\x00") + "\x00\x00" + strings.Join(o.environ(), "\x00")
+}
+
+// envNamePattern matches the environment variable names POSIX shells accept.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateLaunchOptions checks if a rule's environment variables have valid names.
+func validateLaunchOptions(o launchOptions) error {
+	for name := range o.Env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("Environment variable name %q is invalid", name)
+		}
+	}
+	return nil
+}
+
+// splitArgs splits arguments typed on one line, like a shell does: they're
+// separated by spaces, and single quotes, double quotes and backslashes
+// keep spaces in an argument.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\' && (quote == 0 || (i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]))):
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("Arguments end with a backslash")
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Arguments have an unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// parseEnvArgs parses environment variables typed as KEY=VALUE pairs on one
+// line, quoted like arguments. It returns nil if there are none.
+func parseEnvArgs(s string) (map[string]string, error) {
+	pairs, err := splitArgs(s)
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]string
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("Environment variable %q must be written as NAME=VALUE", pair)
+		}
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("Environment variable name %q is invalid", name)
+		}
+		if env == nil {
+			env = make(map[string]string)
+		}
+		env[name] = value
+	}
+	return env, nil
+}
+
+// formatEnvArgs formats environment variables for parseEnvArgs.
+func formatEnvArgs(env map[string]string) string {
+	return shellJoin(launchOptions{Env: env}.environ())
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitArgs tests splitting arguments typed on one line
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "  --kiosk   --new-window ", want: []string{"--kiosk", "--new-window"}},
+		{input: `--class "Work Browser"`, want: []string{"--class", "Work Browser"}},
+		{input: `--name='it''s'`, want: []string{"--name=its"}},
+		{input: `'it'\''s'`, want: []string{"it's"}},
+		{input: `"a \"b\" \c"`, want: []string{`a "b" \c`}},
+		{input: `a\ b ''`, want: []string{"a b", ""}},
+		{input: `"unterminated`, wantErr: true},
+		{input: `trailing\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := splitArgs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseEnvArgs tests parsing environment variables and formatting them back
+func TestParseEnvArgs(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "MOZ_ENABLE_WAYLAND=1 LANG=de_DE.UTF-8", want: map[string]string{"MOZ_ENABLE_WAYLAND": "1", "LANG": "de_DE.UTF-8"}},
+		{input: "EMPTY= 'TITLE=My Browser'", want: map[string]string{"EMPTY": "", "TITLE": "My Browser"}},
+		{input: "A=1=2", want: map[string]string{"A": "1=2"}},
+		{input: "NOVALUE", wantErr: true},
+		{input: "1ST=x", wantErr: true},
+		{input: "MY-VAR=x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseEnvArgs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEnvArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvArgs() = %q, want %q", got, tt.want)
+			}
+			if again, _ := parseEnvArgs(formatEnvArgs(got)); !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("parseEnvArgs(formatEnvArgs()) = %q, want %q", again, tt.want)
+			}
+		})
+	}
+}
+
+// TestLaunchOptions tests the options a rule launches its browser with
+func TestLaunchOptions(t *testing.T) {
+	rule := Rule{
+		Browser: "firefox.desktop#Work",
+		Action:  "new-private-window",
+		Args:    []string{"--kiosk"},
+		Env:     map[string]string{"B": "2", "A": "1"},
+	}
+	opts := rule.launchOptions()
+
+	if opts.isDefault() || !(launchOptions{}).isDefault() {
+		t.Error("isDefault() is wrong")
+	}
+	if got, want := opts.environ(), []string{"A=1", "B=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("environ() = %q, want %q", got, want)
+	}
+	if got, want := opts.extraArgs(rule.Browser), []string{"-P", "Work", "--kiosk"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extraArgs() = %q, want %q", got, want)
+	}
+	if opts.key() == (launchOptions{Action: "new-private-window"}).key() {
+		t.Error("key() is the same for different options")
+	}
+	if opts.key() != rule.launchOptions().key() {
+		t.Error("key() differs for the same options")
+	}
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// startPrivateBus starts a dbus-daemon for the test and returns its address.
+func startPrivateBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// connectPrivateBus opens a connection to the bus at address.
+func connectPrivateBus(t *testing.T, address string) *gio.DBusConnection {
+	t.Helper()
+	conn, err := gio.NewDBusConnectionForAddressSync(context.Background(), address,
+		gio.DBusConnectionFlagsAuthenticationClient|gio.DBusConnectionFlagsMessageBusConnection, nil)
+	if err != nil {
+		t.Fatalf("connecting to the private bus: %v", err)
+	}
+	return conn
+}
+
+// TestDBusOpen tests the Open call sent to a D-Bus activatable app, watching a
+// private bus with dbus-monitor
+func TestDBusOpen(t *testing.T) {
+	address := startPrivateBus(t)
+	if _, err := exec.LookPath("dbus-monitor"); err != nil {
+		t.Skip("dbus-monitor not installed")
+	}
+
+	monitor := exec.Command("dbus-monitor", "--address", address, "interface='"+dbusApplicationInterface+"'")
+	stdout, err := monitor.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		monitor.Process.Kill()
+		monitor.Wait()
+	})
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	// The monitor is ready once it reports taking its own name
+	<-lines
+
+	conn := connectPrivateBus(t, address)
+
+	// Nothing owns the name, so the call fails, see TestLaunchCommand_DBus
+	urls := []string{"https://a.example", "https://b.example/?q=1"}
+	if err := dbusOpen(conn, "org.example.Browser", urls, "token-123"); err == nil {
+		t.Error("dbusOpen() succeeded without an app on the bus, want an error")
+	}
+
+	var out strings.Builder
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(out.String(), `"token-123"`) {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("dbus-monitor exited:\n%s", out.String())
+			}
+			out.WriteString(line + "\n")
+		case <-timeout:
+			t.Fatalf("no Open call seen:\n%s", out.String())
+		}
+	}
+	for _, want := range []string{
+		"destination=org.example.Browser",
+		"path=/org/example/Browser; interface=org.freedesktop.Application; member=Open",
+		`string "https://a.example"`,
+		`string "https://b.example/?q=1"`,
+		`string "activation-token"`,
+		`string "desktop-startup-id"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Open call is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// startFakeApp owns busName on the bus at address, answering Open calls like a
+// D-Bus activatable app. It returns the URIs of each call.
+func startFakeApp(t *testing.T, address, busName string) <-chan []string {
+	t.Helper()
+	conn := connectPrivateBus(t, address)
+	calls := make(chan []string, 4)
+
+	// Method calls are answered by a filter, which runs before GDBus looks
+	// for a registered object
+	conn.AddFilter(func(conn *gio.DBusConnection, message *gio.DBusMessage, incoming bool) *gio.DBusMessage {
+		if !incoming || message.MessageType() != gio.DBusMessageTypeMethodCall || message.Interface() != dbusApplicationInterface {
+			return message
+		}
+		if message.Member() == "Open" {
+			calls <- message.Body().ChildValue(0).Strv()
+		}
+		conn.SendMessage(message.NewMethodReply(), gio.DBusSendMessageFlagsNone)
+		return nil
+	})
+
+	_, err := conn.CallSync(context.Background(), "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"RequestName", glib.NewVariantTuple([]*glib.Variant{glib.NewVariantString(busName), glib.NewVariantUint32(0)}),
+		nil, gio.DBusCallFlagsNone, -1)
+	if err != nil {
+		t.Fatalf("owning %s: %v", busName, err)
+	}
+	return calls
+}
+
+// useSessionBus makes apps be opened over the bus at address during a test.
+func useSessionBus(t *testing.T, address string) {
+	t.Helper()
+	orig := sessionBus
+	conn := connectPrivateBus(t, address)
+	sessionBus = func() (*gio.DBusConnection, error) { return conn, nil }
+	t.Cleanup(func() { sessionBus = orig })
+}
+
+// TestLaunchCommand_DBus tests that D-Bus activatable apps are opened over the
+// bus, and with their Exec line when that fails
+func TestLaunchCommand_DBus(t *testing.T) {
+	address := startPrivateBus(t)
+	useSessionBus(t, address)
+	calls := startFakeApp(t, address, "org.example.Browser")
+
+	// The Exec line records the URLs it was run with
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	script := filepath.Join(dir, "browser")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{"https://a.example", "https://b.example/?q=1"}
+
+	tests := []struct {
+		name     string
+		busName  string
+		args     []string
+		wantOpen bool
+	}{
+		{name: "activatable app", busName: "org.example.Browser", wantOpen: true},
+		{name: "app not on the bus", busName: "org.example.Missing"},
+		{name: "extra arguments", busName: "org.example.Browser", args: []string{"--private-window"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(marker)
+			entry := execEntry{Exec: script + " %U", DBus: tt.busName}
+			if err := launchCommand(entry, urls, tt.args, nil, nil); err != nil {
+				t.Fatalf("launchCommand() error = %v", err)
+			}
+
+			ran, err := os.ReadFile(marker)
+			if tt.wantOpen {
+				select {
+				case got := <-calls:
+					if !slices.Equal(got, urls) {
+						t.Errorf("Open URIs = %q, want %q", got, urls)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("no Open call")
+				}
+				if err == nil {
+					t.Errorf("Exec line ran as well, with %q", ran)
+				}
+				return
+			}
+			want := strings.Join(append(tt.args, urls...), "\n") + "\n"
+			if err != nil || string(ran) != want {
+				t.Errorf("Exec line ran with %q (%v), want %q", ran, err, want)
+			}
+			select {
+			case got := <-calls:
+				t.Errorf("unexpected Open call with %q", got)
+			default:
+			}
+		})
+	}
+}
+
+// TestBrowserLaunchEntry tests the command line a rule's desktop action launches,
+// which explain shows too
+func TestBrowserLaunchEntry(t *testing.T) {
+	entry, err := parseDesktopEntry([]byte(`[Desktop Entry]
+Name=Web
+Exec=epiphany %u
+DBusActivatable=true
+Actions=new-window;preferences;
+
+[Desktop Action new-window]
+Name=New Window
+Exec=epiphany --new-window %u
+
+[Desktop Action preferences]
+Name=Preferences
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.ID = "org.gnome.Epiphany.desktop"
+	b := &Browser{ID: entry.ID, Name: "Web", Entry: entry}
+
+	tests := []struct {
+		action      string
+		wantExec    string
+		wantDBus    string
+		wantWarning bool
+	}{
+		{action: "", wantExec: "epiphany %u", wantDBus: "org.gnome.Epiphany"},
+		{action: "new-window", wantExec: "epiphany --new-window %u"},
+		{action: "preferences", wantExec: "epiphany %u", wantDBus: "org.gnome.Epiphany", wantWarning: true}, // no Exec line
+		{action: "missing", wantExec: "epiphany %u", wantDBus: "org.gnome.Epiphany", wantWarning: true},
+	}
+	for _, tt := range tests {
+		got, warning := b.launchEntry(tt.action)
+		if got.Exec != tt.wantExec || got.DBus != tt.wantDBus || (warning != "") != tt.wantWarning {
+			t.Errorf("launchEntry(%q) = %+v, %q, want Exec %q, DBus %q, warning %v", tt.action, got, warning, tt.wantExec, tt.wantDBus, tt.wantWarning)
+		}
+	}
+}
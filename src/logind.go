@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// displaySession asks logind for the ID of the user's graphical session, the
+// one the desktop runs in. It's empty if logind can't be reached or the user
+// has none. Tests replace it.
+var displaySession = func() string {
+	conn, err := gio.BusGetSync(context.Background(), gio.BusTypeSystem)
+	if err != nil {
+		return ""
+	}
+	reply, err := conn.CallSync(context.Background(), "org.freedesktop.login1", "/org/freedesktop/login1/user/self", "org.freedesktop.DBus.Properties",
+		"Get", glib.NewVariantTuple([]*glib.Variant{glib.NewVariantString("org.freedesktop.login1.User"), glib.NewVariantString("Display")}),
+		glib.NewVariantType("(v)"), gio.DBusCallFlagsNone, -1)
+	if err != nil {
+		return ""
+	}
+	// Display is the session's ID and object path
+	display := reply.ChildValue(0).Variant()
+	if display.NChildren() != 2 {
+		return ""
+	}
+	return display.ChildValue(0).String()
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// mailtoURL is a mailto: link parsed per RFC 6068. Addresses are lowercased.
+type mailtoURL struct {
+	To      []string // addresses before the ? and in to= fields
+	Cc      []string // addresses in cc= and bcc= fields
+	Subject string
+	Body    string
+}
+
+// parseMailto parses a mailto: link, returning false if rawURL isn't one.
+// Unlike query strings, + is not a space in mailto: links.
+func parseMailto(rawURL string) (*mailtoURL, bool) {
+	if len(rawURL) < len("mailto:") || !strings.EqualFold(rawURL[:len("mailto:")], "mailto:") {
+		return nil, false
+	}
+	to, query, _ := strings.Cut(rawURL[len("mailto:"):], "?")
+
+	m := &mailtoURL{}
+	m.To = appendAddresses(m.To, to)
+	subjectSeen := false
+	for _, field := range strings.Split(query, "&") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(unescapeMailto(name)) {
+		case "to":
+			m.To = appendAddresses(m.To, value)
+		case "cc", "bcc":
+			m.Cc = appendAddresses(m.Cc, value)
+		case "subject":
+			// Clients use the first subject, like other single-valued headers
+			if !subjectSeen {
+				m.Subject = unescapeMailto(value)
+				subjectSeen = true
+			}
+		case "body":
+			m.Body = unescapeMailto(value)
+		}
+	}
+	return m, true
+}
+
+// appendAddresses appends the comma-separated addresses of a mailto: field.
+// Display names are dropped, so "Alice <alice@example.com>" becomes the address.
+func appendAddresses(addrs []string, field string) []string {
+	for _, addr := range strings.Split(unescapeMailto(field), ",") {
+		addr = strings.TrimSpace(addr)
+		if start := strings.LastIndex(addr, "<"); start != -1 && strings.HasSuffix(addr, ">") {
+			addr = addr[start+1 : len(addr)-1]
+		}
+		if addr != "" {
+			addrs = append(addrs, strings.ToLower(addr))
+		}
+	}
+	return addrs
+}
+
+// unescapeMailto percent-decodes a mailto: field, leaving it as is if it's malformed.
+func unescapeMailto(s string) string {
+	if decoded, err := url.PathUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// matchAddress matches an address against a pattern: a full address, or a
+// domain, optionally starting with @, which also matches its subdomains.
+func matchAddress(addr, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if local, domain, ok := strings.Cut(pattern, "@"); ok && local != "" {
+		return addr == local+"@"+domain
+	}
+	at := strings.LastIndex(addr, "@")
+	if at == -1 {
+		return false
+	}
+	return matchDomainSuffix(addr[at+1:], strings.TrimPrefix(pattern, "@"))
+}
+
+// mailMatcher matches mail_to, mail_cc and mail_subject conditions. It never
+// matches links other than mailto: links.
+type mailMatcher struct {
+	field   string
+	pattern string
+}
+
+func (m mailMatcher) match(in *matchInput) bool {
+	if in.mail == nil {
+		return false
+	}
+	switch m.field {
+	case "mail_to":
+		return matchAnyAddress(in.mail.To, m.pattern)
+	case "mail_cc":
+		return matchAnyAddress(in.mail.Cc, m.pattern)
+	case "mail_subject":
+		return strings.Contains(strings.ToLower(in.mail.Subject), strings.ToLower(m.pattern))
+	}
+	return false
+}
+
+func matchAnyAddress(addrs []string, pattern string) bool {
+	for _, addr := range addrs {
+		if matchAddress(addr, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMailAddressPattern checks if a mail_to or mail_cc pattern is a full
+// address like "alice@example.com", or a domain like "@example.com".
+func validateMailAddressPattern(pattern string) error {
+	local, domain, ok := strings.Cut(strings.TrimSpace(pattern), "@")
+	if !ok {
+		domain = local
+	} else if strings.ContainsAny(local, " ,<>") {
+		return fmt.Errorf("Address contains invalid characters")
+	}
+	if domain == "" {
+		return fmt.Errorf("Address needs a domain after @")
+	}
+	if !ok || local == "" {
+		// A bare domain matches its subdomains too
+		return validateDomainSuffixPattern(domain)
+	}
+	return validateDomainPattern(domain)
+}
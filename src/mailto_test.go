@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseMailto tests parsing mailto: links per RFC 6068
+func TestParseMailto(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want *mailtoURL
+	}{
+		{
+			name: "single address",
+			url:  "mailto:Alice@Example.com",
+			want: &mailtoURL{To: []string{"alice@example.com"}},
+		},
+		{
+			name: "several addresses and fields",
+			url:  "mailto:a@example.com,b@example.org?to=c@example.net&cc=d@example.com&bcc=e@example.com&subject=Hello%20there&body=Hi",
+			want: &mailtoURL{
+				To:      []string{"a@example.com", "b@example.org", "c@example.net"},
+				Cc:      []string{"d@example.com", "e@example.com"},
+				Subject: "Hello there",
+				Body:    "Hi",
+			},
+		},
+		{
+			name: "no address",
+			url:  "mailto:?to=a@example.com&subject=Hi",
+			want: &mailtoURL{To: []string{"a@example.com"}, Subject: "Hi"},
+		},
+		{
+			name: "encoded address and display name",
+			url:  "mailto:Alice%20%3Calice%40example.com%3E",
+			want: &mailtoURL{To: []string{"alice@example.com"}},
+		},
+		{
+			name: "plus is not a space",
+			url:  "mailto:alice+tag@example.com?subject=1+1",
+			want: &mailtoURL{To: []string{"alice+tag@example.com"}, Subject: "1+1"},
+		},
+		{
+			name: "field names are case-insensitive and the first subject wins",
+			url:  "MAILTO:a@example.com?CC=b@example.com&Subject=First&subject=Second",
+			want: &mailtoURL{To: []string{"a@example.com"}, Cc: []string{"b@example.com"}, Subject: "First"},
+		},
+		{
+			name: "malformed escape is kept",
+			url:  "mailto:a@example.com?subject=100%",
+			want: &mailtoURL{To: []string{"a@example.com"}, Subject: "100%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMailto(tt.url)
+			if !ok {
+				t.Fatalf("parseMailto(%q) is not a mailto link", tt.url)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMailto(%q) = %+v, want %+v", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	for _, url := range []string{"https://example.com/mailto:a@example.com", "mail:a@example.com", ""} {
+		if _, ok := parseMailto(url); ok {
+			t.Errorf("parseMailto(%q) parsed a link that isn't mailto:", url)
+		}
+	}
+}
+
+// TestMailConditions tests matching mailto: links by recipient and subject
+func TestMailConditions(t *testing.T) {
+	const link = "mailto:alice@corp.example.com?cc=bob@Partner.org&subject=Quarterly%20Invoice"
+
+	tests := []struct {
+		name     string
+		url      string
+		condType string
+		pattern  string
+		want     bool
+	}{
+		{name: "recipient address", url: link, condType: "mail_to", pattern: "Alice@corp.example.com", want: true},
+		{name: "other address", url: link, condType: "mail_to", pattern: "carol@corp.example.com", want: false},
+		{name: "recipient domain", url: link, condType: "mail_to", pattern: "@corp.example.com", want: true},
+		{name: "recipient parent domain", url: link, condType: "mail_to", pattern: "example.com", want: true},
+		{name: "similar domain", url: link, condType: "mail_to", pattern: "@ample.com", want: false},
+		{name: "cc is not a recipient", url: link, condType: "mail_to", pattern: "@partner.org", want: false},
+		{name: "cc domain", url: link, condType: "mail_cc", pattern: "@partner.org", want: true},
+		{name: "subject keyword", url: link, condType: "mail_subject", pattern: "invoice", want: true},
+		{name: "subject missing keyword", url: link, condType: "mail_subject", pattern: "receipt", want: false},
+		{name: "web link", url: "https://corp.example.com/?subject=invoice", condType: "mail_subject", pattern: "invoice", want: false},
+		{name: "web link domain", url: "https://corp.example.com/", condType: "mail_to", pattern: "corp.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesPattern(tt.url, tt.pattern, tt.condType); got != tt.want {
+				t.Errorf("matchesPattern(%q, %q, %q) = %v, want %v", tt.url, tt.pattern, tt.condType, got, tt.want)
+			}
+		})
+	}
+
+	// Work mail opens in Thunderbird, everything else in the webmail browser
+	cfg := &Config{Rules: []Rule{
+		{Name: "Work", Browser: "thunderbird.desktop", Conditions: []Condition{{Type: "mail_to", Pattern: "@corp.example.com"}}},
+		{Name: "Webmail", Browser: "firefox.desktop", Conditions: []Condition{{Type: "scheme", Pattern: "mailto"}}},
+	}}
+	if rule := cfg.findRule(link); rule == nil || rule.Name != "Work" {
+		t.Errorf("work mail matched %+v, want the Work rule", rule)
+	}
+	if rule := cfg.findRule("mailto:me@home.example"); rule == nil || rule.Name != "Webmail" {
+		t.Errorf("personal mail matched %+v, want the Webmail rule", rule)
+	}
+}
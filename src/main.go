@@ -4,7 +4,10 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
@@ -20,8 +23,26 @@ var (
 )
 
 func main() {
+	// Rule and config management commands run without a display
+	if isCLICommand(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	app := adw.NewApplication(getAppID(), gio.ApplicationHandlesOpen)
 
+	// Detect which app opened the link before GApplication hands it to a
+	// running instance, whose parent process is unrelated
+	source := detectSourceApp(os.Getppid())
+	if len(os.Args) > 1 && forwardToPrimary(app, os.Args[1:], source) {
+		return
+	}
+
+	// Notification buttons activate these, even in an instance the desktop
+	// starts just for them
+	app.ConnectStartup(func() {
+		addNotificationActions(app)
+	})
+
 	app.ConnectActivate(func() {
 		setupApp()
 		showSettingsWindow(app)
@@ -35,9 +56,16 @@ func main() {
 			return
 		}
 
-		url := files[0].URI()
-		url = sanitizeURL(url)
-		handleURL(app, url)
+		src := source
+		if forwarded, ok := decodeSourceHint(hint); ok {
+			src = forwarded
+		}
+
+		urls := make([]string, 0, len(files))
+		for _, file := range files {
+			urls = append(urls, sanitizeURL(file.URI()))
+		}
+		handleURLs(app, urls, src)
 	})
 
 	if code := app.Run(os.Args); code > 0 {
@@ -45,6 +73,33 @@ func main() {
 	}
 }
 
+// forwardToPrimary opens the URLs in an already running instance, passing the
+// source app along in the open hint. It returns false if this process is the
+// primary instance and should handle the URLs itself.
+func forwardToPrimary(app *adw.Application, args []string, source *sourceApp) bool {
+	// Leave options to GApplication's own command line handling, before
+	// registering, since --gapplication-service changes how it registers
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	if err := app.Register(context.Background()); err != nil || !app.IsRemote() {
+		return false
+	}
+
+	files := make([]gio.Filer, 0, len(args))
+	for _, arg := range args {
+		files = append(files, gio.NewFileForCommandlineArg(arg))
+	}
+
+	app.Open(files, encodeSourceHint(source))
+	if conn := app.DBusConnection(); conn != nil {
+		conn.FlushSync(context.Background())
+	}
+	return true
+}
+
 // setupApp initializes app-wide settings like dark mode and icon paths
 func setupApp() {
 	cfg := loadConfig()
@@ -67,37 +122,58 @@ func setupApp() {
 	}
 }
 
-// handleURL routes a URL to the appropriate browser based on rules
-func handleURL(app *adw.Application, url string) {
+// handleURLs routes each URL to the appropriate browser based on rules. URLs
+// going to the same browser are opened together, and any left over are shown
+// in the picker. A notification tells where rules opened them, see noticeFor.
+// source is the app that opened the URLs, or nil if unknown.
+func handleURLs(app *adw.Application, urls []string, source *sourceApp) {
 	cfg := loadConfig()
-	browsers := detectBrowsers()
-
-	// Try to match a rule
-	browserID, alwaysAsk, matched := cfg.matchRule(url)
-	if matched {
-		// Check if rule has AlwaysAsk enabled
-		if alwaysAsk {
-			showPickerWindow(app, url, browsers)
-			return
-		}
+	cfg.sticky = loadStickyChoices()
+	targets := cfg.withCustomTargets(detectTargets(append(cfg.schemeNames(), urlSchemes(urls)...)))
 
-		// Find the browser and launch it
-		if browser := findBrowserByID(browsers, browserID); browser != nil {
-			launchBrowser(browser, url)
-			app.Quit()
-			return
+	groups, pick := cfg.groupURLs(urls, source, func(id string) bool {
+		return findBrowserByID(targets, id) != nil
+	})
+	for _, group := range groups {
+		used, failures := group.launchWithFallbacks(func(id string, opts launchOptions) error {
+			return launchBrowserWith(findBrowserByID(targets, id), group.URLs, opts)
+		})
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "Error launching %s: %v\n", f.Browser, f.Err)
+		}
+		if title, body := group.fallbackNotice(used, failures, targetName(targets)); title != "" {
+			sendNotification(app, title, body)
+		} else if notice, ok := cfg.noticeFor(group, targetName(targets)); ok {
+			notifyRoute(app, notice, group.URLs)
+		}
+		// Links no browser could open aren't lost, they're shown in the picker
+		if used == "" {
+			pick = append(pick, group.URLs...)
+		} else {
+			cfg.recordHistory(cfg.historyEntries(group.URLs, group.Rules, used, false))
 		}
 	}
 
-	// No rule matched
-	if !cfg.PromptOnClick && cfg.FavoriteBrowser != "" {
-		if browser := findBrowserByID(browsers, cfg.FavoriteBrowser); browser != nil {
-			launchBrowser(browser, url)
-			app.Quit()
-			return
-		}
+	if len(pick) == 0 {
+		app.Quit()
+		return
 	}
+	showPickerWindow(app, pick, cfg.withCustomTargets(pickerApps(pick)), source)
+}
 
-	// Show picker
-	showPickerWindow(app, url, browsers)
+// pickerApps returns the apps that can open the URLs, so a picker for mailto
+// links shows mail clients. Browsers are shown if no app handles them.
+func pickerApps(urls []string) []*Browser {
+	var apps []*Browser
+	for _, scheme := range urlSchemes(urls) {
+		for _, b := range detectHandlers(scheme) {
+			if findBrowserByID(apps, b.ID) == nil {
+				apps = append(apps, b)
+			}
+		}
+	}
+	if len(apps) == 0 {
+		return detectBrowsers()
+	}
+	return apps
 }
@@ -0,0 +1,387 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// matchInput is a URL prepared once so every compiled condition can match
+// against it without re-parsing.
+type matchInput struct {
+	url    string
+	lower  string
+	domain string // lowercased extractDomain result, used by domain and glob conditions
+	parts  urlComponents
+	now    time.Time  // when the URL was opened, used by schedule conditions
+	source *sourceApp // the app that opened the URL, nil when unknown
+	mail   *mailtoURL // the parsed link for mailto: links, nil otherwise
+}
+
+func newMatchInput(url string) *matchInput {
+	mail, _ := parseMailto(url)
+	return &matchInput{
+		url:    url,
+		lower:  strings.ToLower(url),
+		domain: strings.ToLower(extractDomain(url)),
+		parts:  parseURLComponents(url),
+		now:    clock(),
+		mail:   mail,
+	}
+}
+
+// conditionMatcher is a compiled condition or group of conditions.
+type conditionMatcher interface {
+	match(in *matchInput) bool
+}
+
+type neverMatcher struct{}
+
+func (neverMatcher) match(*matchInput) bool { return false }
+
+type domainMatcher struct{ domain string }
+
+func (m domainMatcher) match(in *matchInput) bool { return in.domain == m.domain }
+
+type keywordMatcher struct{ keyword string }
+
+func (m keywordMatcher) match(in *matchInput) bool { return strings.Contains(in.lower, m.keyword) }
+
+type regexMatcher struct{ re *regexp.Regexp }
+
+func (m regexMatcher) match(in *matchInput) bool { return m.re.MatchString(in.url) }
+
+type globMatcher struct{ re *regexp.Regexp }
+
+// Globs match against the domain or the full URL
+func (m globMatcher) match(in *matchInput) bool {
+	return m.re.MatchString(in.domain) || m.re.MatchString(in.url)
+}
+
+type componentMatcher struct{ pattern, patternType string }
+
+func (m componentMatcher) match(in *matchInput) bool {
+	return matchComponent(&in.parts, m.pattern, m.patternType)
+}
+
+type scheduleMatcher struct{ schedule *schedule }
+
+func (m scheduleMatcher) match(in *matchInput) bool { return m.schedule.contains(in.now) }
+
+type sourceMatcher struct{ pattern string }
+
+func (m sourceMatcher) match(in *matchInput) bool {
+	return in.source != nil && in.source.matches(m.pattern)
+}
+
+// hostSetMatcher matches any of a set of exact domains or domain suffixes with
+// hash lookups, so "any" groups with thousands of domains stay constant time.
+type hostSetMatcher struct {
+	domains  map[string]bool
+	suffixes map[string]bool
+}
+
+func newHostSetMatcher() *hostSetMatcher {
+	return &hostSetMatcher{domains: make(map[string]bool), suffixes: make(map[string]bool)}
+}
+
+func (m *hostSetMatcher) match(in *matchInput) bool {
+	if m.domains[in.domain] {
+		return true
+	}
+	if len(m.suffixes) == 0 {
+		return false
+	}
+	found := false
+	forEachSuffix(in.parts.Host, func(suffix string) bool {
+		found = m.suffixes[suffix]
+		return !found
+	})
+	return found
+}
+
+// notMatcher inverts a negated condition or group.
+type notMatcher struct{ m conditionMatcher }
+
+func (m notMatcher) match(in *matchInput) bool { return !m.m.match(in) }
+
+// groupMatcher combines conditions with "all" (AND) or "any" (OR) logic.
+type groupMatcher struct {
+	any      bool
+	matchers []conditionMatcher
+}
+
+func (m *groupMatcher) match(in *matchInput) bool {
+	if len(m.matchers) == 0 {
+		return false
+	}
+	for _, cm := range m.matchers {
+		if cm.match(in) == m.any {
+			return m.any
+		}
+	}
+	return !m.any
+}
+
+// compileCondition compiles a single condition, including its negation.
+func compileCondition(c Condition) conditionMatcher {
+	m := compilePattern(c)
+	if c.Negate {
+		return notMatcher{m}
+	}
+	return m
+}
+
+// compilePattern compiles a condition's pattern. Invalid patterns never match.
+func compilePattern(c Condition) conditionMatcher {
+	switch c.Type {
+	case "domain":
+		return domainMatcher{domain: strings.ToLower(c.Pattern)}
+	case "keyword":
+		return keywordMatcher{keyword: strings.ToLower(c.Pattern)}
+	case "regex":
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return neverMatcher{}
+		}
+		return regexMatcher{re: re}
+	case "glob":
+		re, err := compileGlob(c.Pattern)
+		if err != nil {
+			return neverMatcher{}
+		}
+		return globMatcher{re: re}
+	case "schedule":
+		s, err := parseSchedule(c.Pattern)
+		if err != nil {
+			return neverMatcher{}
+		}
+		return scheduleMatcher{schedule: s}
+	case "source_app":
+		return sourceMatcher{pattern: c.Pattern}
+	case "mail_to", "mail_cc", "mail_subject":
+		return mailMatcher{field: c.Type, pattern: c.Pattern}
+	case "domain_suffix", "scheme", "host", "port", "path_prefix", "path_glob", "query", "fragment", "extension":
+		return componentMatcher{pattern: c.Pattern, patternType: c.Type}
+	default:
+		return neverMatcher{}
+	}
+}
+
+// compileGlob converts a glob pattern, where * matches any characters, to an anchored regex
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.ReplaceAll(pattern, ".", "\\.")
+	pattern = strings.ReplaceAll(pattern, "*", ".*")
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// compileGroup compiles a condition group and its nested groups.
+// For "any" logic, domain conditions are merged into a single hash lookup.
+// Empty groups never match, even when negated.
+func compileGroup(g ConditionGroup) conditionMatcher {
+	if g.isEmpty() {
+		return neverMatcher{}
+	}
+
+	group := &groupMatcher{any: g.Logic == "any"}
+
+	var hosts *hostSetMatcher
+	for _, c := range g.Conditions {
+		if group.any && isDomainCondition(c) {
+			if hosts == nil {
+				hosts = newHostSetMatcher()
+				group.matchers = append(group.matchers, hosts)
+			}
+			hosts.add(c)
+			continue
+		}
+		group.matchers = append(group.matchers, compileCondition(c))
+	}
+	for _, sub := range g.Groups {
+		if sub.isEmpty() {
+			continue
+		}
+		group.matchers = append(group.matchers, compileGroup(sub))
+	}
+
+	if g.Negate {
+		return notMatcher{group}
+	}
+	return group
+}
+
+// isDomainCondition reports whether c requires the URL to be on a given domain
+func isDomainCondition(c Condition) bool {
+	return !c.Negate && (c.Type == "domain" || c.Type == "domain_suffix")
+}
+
+func (m *hostSetMatcher) add(c Condition) {
+	pattern := strings.ToLower(c.Pattern)
+	if c.Type == "domain" {
+		m.domains[pattern] = true
+	} else {
+		m.suffixes[strings.TrimPrefix(pattern, ".")] = true
+	}
+}
+
+// compiledRule is a rule ready for evaluation.
+type compiledRule struct {
+	rule    *Rule
+	matcher conditionMatcher
+}
+
+// ruleMatcher is the compiled form of a rule list. Rules whose match depends on
+// the URL's domain are indexed by it, so only rules that can possibly match are
+// evaluated. Candidates are still evaluated in rule order, so the first matching
+// rule wins exactly as with a linear scan.
+type ruleMatcher struct {
+	rules    []compiledRule
+	byDomain map[string][]int // exact domain -> indices of rules requiring it
+	bySuffix map[string][]int // domain suffix -> indices of rules requiring it
+	always   []int            // rules that aren't indexed and are always evaluated
+}
+
+// compileRules compiles and indexes a list of rules.
+func compileRules(rules []Rule) *ruleMatcher {
+	m := &ruleMatcher{
+		rules:    make([]compiledRule, len(rules)),
+		byDomain: make(map[string][]int),
+		bySuffix: make(map[string][]int),
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Disabled {
+			// Keep the slot so indices still line up with rules
+			m.rules[i] = compiledRule{rule: rule, matcher: neverMatcher{}}
+			continue
+		}
+		m.rules[i] = compiledRule{rule: rule, matcher: rule.compile()}
+
+		domains, suffixes, indexed := ruleHostRequirements(rule)
+		if !indexed {
+			m.always = append(m.always, i)
+			continue
+		}
+		for _, d := range domains {
+			m.byDomain[d] = appendUnique(m.byDomain[d], i)
+		}
+		for _, s := range suffixes {
+			m.bySuffix[s] = appendUnique(m.bySuffix[s], i)
+		}
+	}
+	return m
+}
+
+// ruleHostRequirements returns the domains and domain suffixes one of which a URL
+// must have for the rule to possibly match. indexed is false when the rule can
+// match URLs on any host.
+func ruleHostRequirements(rule *Rule) (domains, suffixes []string, indexed bool) {
+	if root := rule.rootGroup(); root.isEmpty() {
+		return nil, nil, false
+	}
+
+	add := func(c Condition) {
+		pattern := strings.ToLower(c.Pattern)
+		if c.Type == "domain" {
+			domains = append(domains, pattern)
+		} else {
+			suffixes = append(suffixes, strings.TrimPrefix(pattern, "."))
+		}
+	}
+
+	if rule.Logic == "any" {
+		// Every condition must be a domain condition, otherwise any host could match
+		if len(rule.Groups) > 0 {
+			return nil, nil, false
+		}
+		for _, c := range rule.Conditions {
+			if !isDomainCondition(c) {
+				return nil, nil, false
+			}
+		}
+		for _, c := range rule.Conditions {
+			add(c)
+		}
+		return domains, suffixes, true
+	}
+
+	// With "all" logic, a single domain condition is enough to narrow the rule down
+	for _, c := range rule.Conditions {
+		if isDomainCondition(c) {
+			add(c)
+			return domains, suffixes, true
+		}
+	}
+	return nil, nil, false
+}
+
+// match returns the first rule matching the input, or nil.
+func (m *ruleMatcher) match(in *matchInput) *Rule {
+	candidates := m.candidates(in)
+	for _, i := range candidates {
+		if m.rules[i].matcher.match(in) {
+			return m.rules[i].rule
+		}
+	}
+	return nil
+}
+
+// candidates returns the indices of rules that could match the input, in rule order.
+func (m *ruleMatcher) candidates(in *matchInput) []int {
+	candidates := append([]int(nil), m.always...)
+	candidates = append(candidates, m.byDomain[in.domain]...)
+	if len(m.bySuffix) > 0 {
+		forEachSuffix(in.parts.Host, func(suffix string) bool {
+			candidates = append(candidates, m.bySuffix[suffix]...)
+			return true
+		})
+	}
+
+	sort.Ints(candidates)
+	return compactInts(candidates)
+}
+
+// compile compiles the rule's condition tree. Missing logic defaults to "all".
+func (r *Rule) compile() conditionMatcher {
+	return compileGroup(r.rootGroup())
+}
+
+// forEachSuffix calls fn with host and each of its parent domains on label
+// boundaries ("a.b.com", "b.com", "com") until fn returns false.
+func forEachSuffix(host string, fn func(suffix string) bool) {
+	for host != "" {
+		if !fn(host) {
+			return
+		}
+		i := strings.IndexByte(host, '.')
+		if i == -1 {
+			return
+		}
+		host = host[i+1:]
+	}
+}
+
+func appendUnique(list []int, v int) []int {
+	if len(list) > 0 && list[len(list)-1] == v {
+		return list
+	}
+	return append(list, v)
+}
+
+// compactInts removes adjacent duplicates from a sorted slice in place.
+func compactInts(list []int) []int {
+	if len(list) < 2 {
+		return list
+	}
+	out := list[:1]
+	for _, v := range list[1:] {
+		if v != out[len(out)-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// sendNotification shows a desktop notification.
+func sendNotification(app *adw.Application, title, body string) {
+	notification := gio.NewNotification(title)
+	notification.SetBody(body)
+	deliverNotification(app, notification)
+}
+
+// deliverNotification sends a notification over D-Bus, which is flushed right
+// away since Switchyard often quits after opening links.
+func deliverNotification(app *adw.Application, notification *gio.Notification) {
+	app.SendNotification("", notification)
+	if conn := app.DBusConnection(); conn != nil {
+		conn.FlushSync(context.Background())
+	}
+}
+
+// gtkNotificationsBusName is GNOME Shell's notification server, which starts an
+// app over D-Bus to activate the action of a button.
+const gtkNotificationsBusName = "org.gtk.Notifications"
+
+// notifyRoute tells the user where a rule opened links. Buttons to open them
+// in another browser or to edit the rule are only added where they still work
+// after Switchyard quits, see notificationsActivate.
+func notifyRoute(app *adw.Application, notice routeNotice, urls []string) {
+	buttons := notificationsActivate(app.DBusConnection(), getAppID())
+	deliverNotification(app, routeNotification(notice, urls, buttons))
+}
+
+// routeNotification returns the notification for notice, optionally with
+// buttons activating the app actions of addNotificationActions.
+func routeNotification(notice routeNotice, urls []string, buttons bool) *gio.Notification {
+	notification := gio.NewNotification(notice.Title)
+	notification.SetBody(notice.Body)
+	if buttons {
+		notification.AddButtonWithTarget("Open in Another Browser", "app."+noticeActionOpenElsewhere, glib.NewVariantStrv(urls))
+		if notice.Rule > 0 {
+			notification.AddButtonWithTarget("Edit Rule", "app."+noticeActionEditRule, glib.NewVariantInt32(int32(notice.Rule)))
+		}
+	}
+	return notification
+}
+
+// notificationsActivate reports whether the buttons of appID's notifications
+// reach it after it quits. The notification portal in Flatpak and GNOME Shell
+// start the app with its D-Bus service file to activate a button's action.
+// Other notification servers send actions to the process that showed the
+// notification, which has quit by then.
+func notificationsActivate(conn *gio.DBusConnection, appID string) bool {
+	if os.Getenv("FLATPAK_ID") != "" {
+		return true
+	}
+	if conn == nil {
+		return false
+	}
+
+	reply, err := conn.CallSync(context.Background(), "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"NameHasOwner", glib.NewVariantTuple([]*glib.Variant{glib.NewVariantString(gtkNotificationsBusName)}),
+		glib.NewVariantType("(b)"), gio.DBusCallFlagsNone, -1)
+	if err != nil || !reply.ChildValue(0).Boolean() {
+		return false
+	}
+	reply, err = conn.CallSync(context.Background(), "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"ListActivatableNames", nil, glib.NewVariantType("(as)"), gio.DBusCallFlagsNone, -1)
+	return err == nil && slices.Contains(reply.ChildValue(0).Strv(), appID)
+}
+
+// addNotificationActions adds the app actions behind the buttons of
+// notifyRoute's notifications: open-elsewhere shows the picker for a list of
+// URLs, and edit-rule opens the editor of a rule by its 1-based position.
+func addNotificationActions(app *adw.Application) {
+	openElsewhere := gio.NewSimpleAction(noticeActionOpenElsewhere, glib.NewVariantType("as"))
+	openElsewhere.ConnectActivate(func(param *glib.Variant) {
+		urls := param.Strv()
+		if len(urls) == 0 {
+			return
+		}
+		setupApp()
+		showPickerWindow(app, urls, loadConfig().withCustomTargets(pickerApps(urls)), nil)
+	})
+	app.AddAction(openElsewhere)
+
+	editRule := gio.NewSimpleAction(noticeActionEditRule, glib.NewVariantType("i"))
+	editRule.ConnectActivate(func(param *glib.Variant) {
+		// A rule removed since shows the Rules page without an editor
+		setupApp()
+		showRuleEditor(app, int(param.Int32()))
+	})
+	app.AddAction(editRule)
+}
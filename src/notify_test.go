@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// TestNotificationActions tests the app actions behind the buttons of route
+// notifications, whose targets must match what routeNotification sends
+func TestNotificationActions(t *testing.T) {
+	app := adw.NewApplication(defaultAppID+".Test", gio.ApplicationNonUnique)
+	addNotificationActions(app)
+
+	tests := []struct {
+		action    string
+		paramType string
+	}{
+		{action: noticeActionOpenElsewhere, paramType: "as"}, // the links
+		{action: noticeActionEditRule, paramType: "i"},       // the rule's 1-based position
+	}
+	for _, tt := range tests {
+		if !app.HasAction(tt.action) {
+			t.Errorf("no %s action", tt.action)
+			continue
+		}
+		if got := app.ActionParameterType(tt.action).DupString(); got != tt.paramType {
+			t.Errorf("%s parameter type = %q, want %q", tt.action, got, tt.paramType)
+		}
+	}
+}
+
+// startFakeNotificationServer stands in for GNOME Shell's notification server
+// on the bus at address, returning the notifications it's sent.
+func startFakeNotificationServer(t *testing.T, address string) <-chan *glib.Variant {
+	t.Helper()
+	conn := connectPrivateBus(t, address)
+	notifications := make(chan *glib.Variant, 4)
+
+	conn.AddFilter(func(conn *gio.DBusConnection, message *gio.DBusMessage, incoming bool) *gio.DBusMessage {
+		if !incoming || message.MessageType() != gio.DBusMessageTypeMethodCall || message.Interface() != gtkNotificationsBusName {
+			return message
+		}
+		if message.Member() == "AddNotification" {
+			notifications <- message.Body().ChildValue(2) // after the app and notification IDs
+		}
+		conn.SendMessage(message.NewMethodReply(), gio.DBusSendMessageFlagsNone)
+		return nil
+	})
+
+	_, err := conn.CallSync(context.Background(), "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"RequestName", glib.NewVariantTuple([]*glib.Variant{glib.NewVariantString(gtkNotificationsBusName), glib.NewVariantUint32(0)}),
+		nil, gio.DBusCallFlagsNone, -1)
+	if err != nil {
+		t.Fatalf("owning %s: %v", gtkNotificationsBusName, err)
+	}
+	return notifications
+}
+
+// installDBusService makes the buses started afterwards able to start appID,
+// as Switchyard's installed service file does.
+func installDBusService(t *testing.T, appID string) {
+	t.Helper()
+	dir := filepath.Join(os.Getenv("XDG_DATA_HOME"), "dbus-1", "services")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	service := "[D-BUS Service]\nName=" + appID + "\nExec=/bin/false\n"
+	if err := os.WriteFile(filepath.Join(dir, appID+".service"), []byte(service), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNotificationsActivate tests that buttons are only offered where the
+// notification server can start Switchyard for them
+func TestNotificationsActivate(t *testing.T) {
+	t.Setenv("FLATPAK_ID", "")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	installDBusService(t, defaultAppID)
+
+	// Other notification servers send actions to the process that has quit
+	address := startPrivateBus(t)
+	conn := connectPrivateBus(t, address)
+	if notificationsActivate(conn, defaultAppID) {
+		t.Error("notificationsActivate() = true without org.gtk.Notifications")
+	}
+
+	startFakeNotificationServer(t, address)
+	if !notificationsActivate(conn, defaultAppID) {
+		t.Error("notificationsActivate() = false with org.gtk.Notifications and a service file")
+	}
+	if notificationsActivate(conn, "org.example.Uninstalled") {
+		t.Error("notificationsActivate() = true without a service file")
+	}
+	if notificationsActivate(nil, defaultAppID) {
+		t.Error("notificationsActivate() = true without a bus")
+	}
+
+	// The portal starts Flatpak apps
+	t.Setenv("FLATPAK_ID", defaultAppID)
+	if !notificationsActivate(nil, defaultAppID) {
+		t.Error("notificationsActivate() = false in Flatpak")
+	}
+}
+
+// TestRouteNotification tests the notification a stand-in notification server
+// is sent when a rule opens links, with its buttons and their targets
+func TestRouteNotification(t *testing.T) {
+	address := startPrivateBus(t)
+	notifications := startFakeNotificationServer(t, address)
+
+	// GApplication sends notifications over the session bus, which GLib
+	// connects to once per process
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	app := gio.NewApplication(defaultAppID+".Test", gio.ApplicationFlagsNone)
+	if err := app.Register(context.Background()); err != nil {
+		t.Fatalf("registering the app: %v", err)
+	}
+
+	urls := []string{"https://a.example/?x=1&y=2", "https://b.example/"}
+	notice := routeNotice{Title: "Opened 2 links in Firefox", Body: `Rule 2 ("Work") matched`, Rule: 2}
+	app.SendNotification("", routeNotification(notice, urls, true))
+	app.DBusConnection().FlushSync(context.Background())
+
+	var notification *glib.Variant
+	select {
+	case notification = <-notifications:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no AddNotification call")
+	}
+	dict := glib.NewVariantDict(notification)
+	if got := dict.LookupValue("title", glib.NewVariantType("s")); got == nil || got.String() != notice.Title {
+		t.Errorf("title = %v, want %q", got, notice.Title)
+	}
+	if got := dict.LookupValue("body", glib.NewVariantType("s")); got == nil || got.String() != notice.Body {
+		t.Errorf("body = %v, want %q", got, notice.Body)
+	}
+
+	buttons := dict.LookupValue("buttons", glib.NewVariantType("aa{sv}"))
+	if buttons == nil || buttons.NChildren() != 2 {
+		t.Fatalf("buttons = %v, want 2", buttons)
+	}
+	open := glib.NewVariantDict(buttons.ChildValue(0))
+	if got := open.LookupValue("action", glib.NewVariantType("s")); got == nil || got.String() != "app."+noticeActionOpenElsewhere {
+		t.Errorf("first button action = %v", got)
+	}
+	if got := open.LookupValue("target", glib.NewVariantType("as")); got == nil || !slices.Equal(got.Strv(), urls) {
+		t.Errorf("first button target = %v, want %q", got, urls)
+	}
+	edit := glib.NewVariantDict(buttons.ChildValue(1))
+	if got := edit.LookupValue("action", glib.NewVariantType("s")); got == nil || got.String() != "app."+noticeActionEditRule {
+		t.Errorf("second button action = %v", got)
+	}
+	if got := edit.LookupValue("target", glib.NewVariantType("i")); got == nil || got.Int32() != 2 {
+		t.Errorf("second button target = %v, want 2", got)
+	}
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profileFamily is how a browser stores its profiles and selects one on its command line.
+type profileFamily int
+
+const (
+	firefoxProfiles  profileFamily = iota // profiles.ini, launched with -P NAME
+	chromiumProfiles                      // Local State, launched with --profile-directory=DIR
+)
+
+// profileSource is where a browser, by desktop file ID, keeps its profiles.
+type profileSource struct {
+	desktopIDs []string
+	family     profileFamily
+	dirs       []string // relative to the home directory, the first one that exists is used
+}
+
+var profileSources = []profileSource{
+	// Firefox
+	{[]string{"firefox.desktop", "firefox-esr.desktop"}, firefoxProfiles, []string{".mozilla/firefox", ".config/mozilla/firefox"}},
+	{[]string{"org.mozilla.firefox.desktop"}, firefoxProfiles, []string{".var/app/org.mozilla.firefox/.mozilla/firefox", ".var/app/org.mozilla.firefox/config/mozilla/firefox"}},
+	{[]string{"firefox_firefox.desktop"}, firefoxProfiles, []string{"snap/firefox/common/.mozilla/firefox"}},
+
+	// Chromium family
+	{[]string{"google-chrome.desktop"}, chromiumProfiles, []string{".config/google-chrome"}},
+	{[]string{"com.google.Chrome.desktop"}, chromiumProfiles, []string{".var/app/com.google.Chrome/config/google-chrome"}},
+	{[]string{"chromium.desktop", "chromium-browser.desktop"}, chromiumProfiles, []string{".config/chromium"}},
+	{[]string{"org.chromium.Chromium.desktop"}, chromiumProfiles, []string{".var/app/org.chromium.Chromium/config/chromium"}},
+	{[]string{"chromium_chromium.desktop"}, chromiumProfiles, []string{"snap/chromium/common/chromium"}},
+	{[]string{"brave-browser.desktop"}, chromiumProfiles, []string{".config/BraveSoftware/Brave-Browser"}},
+	{[]string{"com.brave.Browser.desktop"}, chromiumProfiles, []string{".var/app/com.brave.Browser/config/BraveSoftware/Brave-Browser"}},
+	{[]string{"brave_brave.desktop"}, chromiumProfiles, []string{"snap/brave/current/.config/BraveSoftware/Brave-Browser"}},
+	{[]string{"microsoft-edge.desktop"}, chromiumProfiles, []string{".config/microsoft-edge"}},
+	{[]string{"com.microsoft.Edge.desktop"}, chromiumProfiles, []string{".var/app/com.microsoft.Edge/config/microsoft-edge"}},
+	{[]string{"vivaldi-stable.desktop"}, chromiumProfiles, []string{".config/vivaldi"}},
+	{[]string{"com.vivaldi.Vivaldi.desktop"}, chromiumProfiles, []string{".var/app/com.vivaldi.Vivaldi/config/vivaldi"}},
+}
+
+// browserProfile is one of the profiles of a browser.
+type browserProfile struct {
+	ID   string // what selects the profile: its name for Firefox, its directory for Chromium
+	Name string // display name
+}
+
+// profileTargetID returns the ID rules use to open links in a browser profile.
+func profileTargetID(desktopID, profileID string) string {
+	return desktopID + "#" + profileID
+}
+
+// findProfileSource returns where a browser keeps its profiles, or nil if
+// Switchyard doesn't know about its profiles.
+func findProfileSource(desktopID string) *profileSource {
+	for i := range profileSources {
+		for _, id := range profileSources[i].desktopIDs {
+			if id == desktopID {
+				return &profileSources[i]
+			}
+		}
+	}
+	return nil
+}
+
+// profileArgs returns the arguments that open a profile target, or nil for
+// other browser IDs.
+func profileArgs(targetID string) []string {
+	desktopID, profile, ok := strings.Cut(targetID, "#")
+	if !ok || profile == "" {
+		return nil
+	}
+	src := findProfileSource(desktopID)
+	if src == nil {
+		return nil
+	}
+	if src.family == firefoxProfiles {
+		return []string{"-P", profile}
+	}
+	return []string{"--profile-directory=" + profile}
+}
+
+// discoverProfiles returns the profiles of a browser, by desktop file ID.
+// Browsers Switchyard doesn't know about, or that were never run, have none.
+func discoverProfiles(desktopID string) []browserProfile {
+	src := findProfileSource(desktopID)
+	if src == nil {
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	file := "Local State"
+	if src.family == firefoxProfiles {
+		file = "profiles.ini"
+	}
+	for _, dir := range src.dirs {
+		data, err := os.ReadFile(filepath.Join(home, dir, file))
+		if err != nil {
+			continue
+		}
+		if src.family == firefoxProfiles {
+			return parseFirefoxProfiles(data)
+		}
+		return parseChromiumProfiles(data)
+	}
+	return nil
+}
+
+// parseFirefoxProfiles parses the [ProfileN] sections of Firefox's profiles.ini,
+// in the order they're listed.
+func parseFirefoxProfiles(data []byte) []browserProfile {
+	var profiles []browserProfile
+	inProfile := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.HasPrefix(line, "[Profile")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inProfile || !ok || strings.TrimSpace(key) != "Name" {
+			continue
+		}
+		if name := strings.TrimSpace(value); name != "" {
+			profiles = append(profiles, browserProfile{ID: name, Name: name})
+		}
+	}
+	return profiles
+}
+
+// parseChromiumProfiles parses the profiles listed in a Chromium-family browser's
+// Local State file, in the order the browser shows them.
+func parseChromiumProfiles(data []byte) []browserProfile {
+	var state struct {
+		Profile struct {
+			InfoCache map[string]struct {
+				Name string `json:"name"`
+			} `json:"info_cache"`
+			ProfilesOrder []string `json:"profiles_order"`
+		} `json:"profile"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+
+	dirs := make([]string, 0, len(state.Profile.InfoCache))
+	for dir := range state.Profile.InfoCache {
+		dirs = append(dirs, dir)
+	}
+	order := make(map[string]int)
+	for i, dir := range state.Profile.ProfilesOrder {
+		order[dir] = i + 1
+	}
+	// Listed profiles first in their order, then the rest by directory
+	sort.Slice(dirs, func(i, j int) bool {
+		oi, oj := order[dirs[i]], order[dirs[j]]
+		if oi != oj {
+			return oj == 0 || (oi != 0 && oi < oj)
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	profiles := make([]browserProfile, 0, len(dirs))
+	for _, dir := range dirs {
+		name := state.Profile.InfoCache[dir].Name
+		if name == "" {
+			name = dir
+		}
+		profiles = append(profiles, browserProfile{ID: dir, Name: name})
+	}
+	return profiles
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testProfilesINI = `[Install4F96D1932A9F858E]
+Default=abcd.default-release
+Locked=1
+
+[Profile1]
+Name=Work
+IsRelative=1
+Path=efgh.Work
+
+[Profile0]
+Name=default-release
+IsRelative=1
+Path=abcd.default-release
+Default=1
+
+[General]
+StartWithLastProfile=1
+Version=2
+`
+
+const testLocalState = `{
+  "browser": {"enabled_labs_experiments": []},
+  "profile": {
+    "info_cache": {
+      "Default": {"name": "Personal"},
+      "Profile 1": {"name": "Work"},
+      "Profile 3": {"name": ""},
+      "Profile 2": {"name": "Banking"}
+    },
+    "profiles_order": ["Profile 1", "Default"]
+  }
+}`
+
+// TestParseFirefoxProfiles tests reading profiles.ini
+func TestParseFirefoxProfiles(t *testing.T) {
+	got := parseFirefoxProfiles([]byte(testProfilesINI))
+	want := []browserProfile{{ID: "Work", Name: "Work"}, {ID: "default-release", Name: "default-release"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFirefoxProfiles() = %+v, want %+v", got, want)
+	}
+}
+
+// TestParseChromiumProfiles tests reading Local State
+func TestParseChromiumProfiles(t *testing.T) {
+	got := parseChromiumProfiles([]byte(testLocalState))
+	want := []browserProfile{
+		{ID: "Profile 1", Name: "Work"},
+		{ID: "Default", Name: "Personal"},
+		{ID: "Profile 2", Name: "Banking"},
+		{ID: "Profile 3", Name: "Profile 3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseChromiumProfiles() = %+v, want %+v", got, want)
+	}
+
+	if got := parseChromiumProfiles([]byte("not json")); got != nil {
+		t.Errorf("parseChromiumProfiles(invalid) = %+v, want nil", got)
+	}
+}
+
+// TestDiscoverProfiles tests finding profiles of native, Flatpak and Snap browsers
+func TestDiscoverProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	write := func(path, content string) {
+		path = filepath.Join(home, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".var/app/org.mozilla.firefox/.mozilla/firefox/profiles.ini", testProfilesINI)
+	write("snap/chromium/common/chromium/Local State", testLocalState)
+	write(".config/BraveSoftware/Brave-Browser/Local State", testLocalState)
+
+	tests := []struct {
+		desktopID string
+		want      int
+	}{
+		{desktopID: "org.mozilla.firefox.desktop", want: 2},
+		{desktopID: "firefox.desktop", want: 0}, // native Firefox was never run
+		{desktopID: "chromium_chromium.desktop", want: 4},
+		{desktopID: "brave-browser.desktop", want: 4},
+		{desktopID: "epiphany.desktop", want: 0},
+	}
+	for _, tt := range tests {
+		if got := discoverProfiles(tt.desktopID); len(got) != tt.want {
+			t.Errorf("discoverProfiles(%q) = %+v, want %d profiles", tt.desktopID, got, tt.want)
+		}
+	}
+}
+
+// TestProfileArgs tests the arguments that select a profile
+func TestProfileArgs(t *testing.T) {
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{id: profileTargetID("firefox.desktop", "Work"), want: []string{"-P", "Work"}},
+		{id: profileTargetID("org.mozilla.firefox.desktop", "My Profile"), want: []string{"-P", "My Profile"}},
+		{id: profileTargetID("google-chrome.desktop", "Profile 1"), want: []string{"--profile-directory=Profile 1"}},
+		{id: profileTargetID("com.vivaldi.Vivaldi.desktop", "Default"), want: []string{"--profile-directory=Default"}},
+		{id: "firefox.desktop", want: nil},
+		{id: "firefox.desktop#", want: nil},
+		{id: "epiphany.desktop#Work", want: nil},
+	}
+	for _, tt := range tests {
+		if got := profileArgs(tt.id); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("profileArgs(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// public_suffix_list.dat is a copy of https://publicsuffix.org/list/public_suffix_list.dat,
+// including both the ICANN and private sections.
+//
+//go:embed public_suffix_list.dat
+var publicSuffixData string
+
+type suffixList struct {
+	rules      map[string]bool // "co.uk"
+	wildcards  map[string]bool // "*.ck" is stored as "ck"
+	exceptions map[string]bool // "!www.ck" is stored as "www.ck"
+}
+
+var (
+	publicSuffixes     *suffixList
+	publicSuffixesOnce sync.Once
+)
+
+// loadPublicSuffixes parses the embedded list on first use.
+func loadPublicSuffixes() *suffixList {
+	publicSuffixesOnce.Do(func() {
+		publicSuffixes = parseSuffixList(publicSuffixData)
+	})
+	return publicSuffixes
+}
+
+// parseSuffixList parses the public suffix list format: one rule per line,
+// "//" comments, "*." wildcard rules and "!" exception rules.
+func parseSuffixList(data string) *suffixList {
+	list := &suffixList{
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	for _, line := range strings.Split(data, "\n") {
+		// Rules end at the first whitespace
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			list.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			list.wildcards[rule[2:]] = true
+		default:
+			list.rules[rule] = true
+		}
+	}
+	return list
+}
+
+// publicSuffix returns the public suffix of a domain, e.g. "co.uk" for "www.bbc.co.uk".
+// explicit is false when no rule matched and the implicit "*" rule was used,
+// i.e. the suffix is just the last label of an unlisted TLD.
+func (l *suffixList) publicSuffix(domain string) (suffix string, explicit bool) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	labels := strings.Split(domain, ".")
+
+	// Walk from the longest candidate to the shortest so the most specific rule wins
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if l.exceptions[candidate] {
+			return strings.Join(labels[i+1:], "."), true
+		}
+		if l.rules[candidate] {
+			return candidate, true
+		}
+		if i+1 < len(labels) && l.wildcards[strings.Join(labels[i+1:], ".")] {
+			return candidate, true
+		}
+	}
+	return labels[len(labels)-1], false
+}
+
+// isPublicSuffix reports whether domain is itself listed as a public suffix,
+// such as "com", "co.uk" or "github.io".
+func isPublicSuffix(domain string) bool {
+	suffix, explicit := loadPublicSuffixes().publicSuffix(domain)
+	return explicit && strings.EqualFold(suffix, strings.TrimSuffix(domain, "."))
+}
+
+// registrableDomain returns the public suffix plus one label, e.g. "bbc.co.uk"
+// for "www.bbc.co.uk". It returns "" for IP addresses and bare public suffixes.
+func registrableDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || strings.Contains(host, ":") || isIPv4(host) {
+		return ""
+	}
+	suffix, _ := loadPublicSuffixes().publicSuffix(host)
+	if len(host) <= len(suffix) {
+		return ""
+	}
+	rest := strings.TrimSuffix(host[:len(host)-len(suffix)], ".")
+	if i := strings.LastIndex(rest, "."); i != -1 {
+		rest = rest[i+1:]
+	}
+	return rest + "." + suffix
+}
+
+// matchDomainSuffix reports whether host equals domain or is one of its subdomains,
+// comparing on label boundaries so "example.com" doesn't match "notexample.com".
+func matchDomainSuffix(host, domain string) bool {
+	host = strings.ToLower(host)
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// isIPv4 reports whether s looks like a dotted IPv4 address.
+func isIPv4(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" || len(p) > 3 || strings.Trim(p, "0123456789") != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"testing"
+)
+
+// TestIsPublicSuffix tests public suffix detection against the embedded list
+func TestIsPublicSuffix(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "com", want: true},
+		{domain: "co.uk", want: true},
+		{domain: "CO.UK", want: true},
+		{domain: "github.io", want: true},
+		{domain: "example.com", want: false},
+		{domain: "bbc.co.uk", want: false},
+		{domain: "localhost", want: false},
+		{domain: "anything.bd", want: true},  // *.bd wildcard
+		{domain: "www.ck", want: false},      // !www.ck exception
+		{domain: "notarealtld", want: false}, // implicit rule only
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if got := isPublicSuffix(tt.domain); got != tt.want {
+				t.Errorf("isPublicSuffix(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRegistrableDomain tests eTLD+1 extraction
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "example.com", want: "example.com"},
+		{host: "www.example.com", want: "example.com"},
+		{host: "a.b.c.example.com", want: "example.com"},
+		{host: "www.bbc.co.uk", want: "bbc.co.uk"},
+		{host: "user.github.io", want: "user.github.io"},
+		{host: "Docs.Google.COM", want: "google.com"},
+		{host: "foo.bar.bd", want: "foo.bar.bd"},
+		{host: "www.ck", want: "www.ck"},
+		{host: "co.uk", want: ""},
+		{host: "com", want: ""},
+		{host: "192.168.1.1", want: ""},
+		{host: "::1", want: ""},
+		{host: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := registrableDomain(tt.host); got != tt.want {
+				t.Errorf("registrableDomain(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMatchesPattern_DomainSuffix tests the domain and subdomains condition type
+func TestMatchesPattern_DomainSuffix(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		pattern string
+		want    bool
+	}{
+		{name: "bare domain", url: "https://example.com", pattern: "example.com", want: true},
+		{name: "subdomain", url: "https://www.example.com/path", pattern: "example.com", want: true},
+		{name: "deep subdomain", url: "https://a.b.example.com", pattern: "example.com", want: true},
+		{name: "case insensitive", url: "https://WWW.Example.COM", pattern: "example.com", want: true},
+		{name: "label boundary", url: "https://notexample.com", pattern: "example.com", want: false},
+		{name: "suffix in path", url: "https://evil.com/example.com", pattern: "example.com", want: false},
+		{name: "userinfo", url: "https://example.com@evil.com", pattern: "example.com", want: false},
+		{name: "parent domain", url: "https://example.com", pattern: "www.example.com", want: false},
+		{name: "with port", url: "https://api.example.com:8443/", pattern: "example.com", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchesPattern(tt.url, tt.pattern, "domain_suffix")
+			if got != tt.want {
+				t.Errorf("matchesPattern(%q, %q, domain_suffix) = %v, want %v", tt.url, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rememberScope is how much of a link a rule remembered in the picker covers.
+type rememberScope string
+
+const (
+	rememberHost   rememberScope = "host"   // the link's exact host
+	rememberDomain rememberScope = "domain" // the registrable domain and its subdomains
+	rememberPrefix rememberScope = "prefix" // the host and the link's path below it
+)
+
+// Where remember_position puts remembered rules in the rule list.
+const (
+	rememberAtTop    = "top" // the default, so they win over always ask rules
+	rememberAtBottom = "bottom"
+)
+
+// rememberRule returns a rule that opens links like rawURL in browserID,
+// covering as much of it as scope says. Links without a host, like mailto:,
+// can't be remembered, nor can hosts no condition matches, like IPv6
+// addresses.
+func rememberRule(rawURL string, scope rememberScope, browserID string) (Rule, error) {
+	c := parseURLComponents(strings.TrimSpace(rawURL))
+	if c.Host == "" {
+		return Rule{}, fmt.Errorf("%q has no host to remember", rawURL)
+	}
+
+	rule := Rule{Browser: browserID, Logic: "all"}
+	switch scope {
+	case rememberHost:
+		rule.Name = c.Host
+		rule.Conditions = []Condition{{Type: "domain", Pattern: c.Host}}
+	case rememberDomain:
+		if domain := registrableDomain(c.Host); domain != "" {
+			rule.Name = domain + " and subdomains"
+			rule.Conditions = []Condition{{Type: "domain_suffix", Pattern: domain}}
+		} else {
+			// IP addresses and public suffixes like github.io only match exactly
+			rule.Name = c.Host
+			rule.Conditions = []Condition{{Type: "domain", Pattern: c.Host}}
+		}
+	case rememberPrefix:
+		prefix := strings.TrimSuffix(c.RawPath, "/")
+		rule.Name = c.Host + prefix
+		rule.Conditions = []Condition{{Type: "domain", Pattern: c.Host}}
+		if prefix != "" {
+			rule.Conditions = append(rule.Conditions, Condition{Type: "path_prefix", Pattern: prefix})
+		}
+	default:
+		return Rule{}, fmt.Errorf("unknown scope %q", scope)
+	}
+
+	if err := validateRule(rule); err != nil {
+		return Rule{}, fmt.Errorf("can't remember %s: %w", rule.Name, err)
+	}
+	return rule, nil
+}
+
+// rememberable reports whether rememberRule can make a rule for rawURL, i.e.
+// whether its host can be matched.
+func rememberable(rawURL string) bool {
+	host := parseURLComponents(strings.TrimSpace(rawURL)).Host
+	return host != "" && validateDomainPattern(host) == nil
+}
+
+// addRememberedRule adds a rule remembered in the picker at the top or the
+// bottom of the rule list, as remember_position says.
+func (cfg *Config) addRememberedRule(rule Rule) {
+	if cfg.RememberPosition == rememberAtBottom {
+		cfg.Rules = append(cfg.Rules, rule)
+		return
+	}
+	cfg.Rules = append([]Rule{rule}, cfg.Rules...)
+}
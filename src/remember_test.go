@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRememberRule tests the rules made when the picker remembers a browser
+func TestRememberRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		scope   rememberScope
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name:  "exact host",
+			url:   "https://Docs.GitHub.com:8443/en/actions?q=1",
+			scope: rememberHost,
+			want:  Rule{Name: "docs.github.com", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "docs.github.com"}}},
+		},
+		{
+			name:  "registrable domain",
+			url:   "https://news.bbc.co.uk/sport",
+			scope: rememberDomain,
+			want:  Rule{Name: "bbc.co.uk and subdomains", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain_suffix", Pattern: "bbc.co.uk"}}},
+		},
+		{
+			name:  "domain of an IP address",
+			url:   "http://192.168.1.1/admin",
+			scope: rememberDomain,
+			want:  Rule{Name: "192.168.1.1", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "192.168.1.1"}}},
+		},
+		{
+			name:  "domain that is a public suffix",
+			url:   "https://github.io/",
+			scope: rememberDomain,
+			want:  Rule{Name: "github.io", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "github.io"}}},
+		},
+		{
+			name:  "domain under a public suffix",
+			url:   "https://www.alice.blogspot.com/",
+			scope: rememberDomain,
+			want:  Rule{Name: "alice.blogspot.com and subdomains", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain_suffix", Pattern: "alice.blogspot.com"}}},
+		},
+		{
+			name:  "host that is a public suffix",
+			url:   "https://blogspot.com/",
+			scope: rememberHost,
+			want:  Rule{Name: "blogspot.com", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "blogspot.com"}}},
+		},
+		{
+			name:  "url prefix",
+			url:   "https://github.com/alice/?tab=repos",
+			scope: rememberPrefix,
+			want: Rule{Name: "github.com/alice", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{
+				{Type: "domain", Pattern: "github.com"},
+				{Type: "path_prefix", Pattern: "/alice"},
+			}},
+		},
+		{
+			name:  "url prefix without a path",
+			url:   "github.com/",
+			scope: rememberPrefix,
+			want:  Rule{Name: "github.com", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		},
+		{
+			name:  "url prefix with a space",
+			url:   "https://example.com/a b/c",
+			scope: rememberPrefix,
+			want: Rule{Name: "example.com/a%20b/c", Browser: "firefox.desktop", Logic: "all", Conditions: []Condition{
+				{Type: "domain", Pattern: "example.com"},
+				{Type: "path_prefix", Pattern: "/a%20b/c"},
+			}},
+		},
+		{name: "IPv6 address", url: "http://[::1]:8080/admin", scope: rememberHost, wantErr: true},
+		{name: "IPv6 address domain", url: "http://[::1]/", scope: rememberDomain, wantErr: true},
+		{name: "no host", url: "mailto:bob@example.com", scope: rememberHost, wantErr: true},
+		{name: "unknown scope", url: "https://github.com", scope: "path", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rememberRule(tt.url, tt.scope, "firefox.desktop")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rememberRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rememberRule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRememberable tests which links the picker offers to remember
+func TestRememberable(t *testing.T) {
+	tests := map[string]bool{
+		"https://github.com/alice": true,
+		"http://192.168.1.1/":      true,
+		"https://github.io/":       true,
+		"http://[::1]:8080/":       false,
+		"mailto:bob@example.com":   false,
+		"":                         false,
+	}
+	for u, want := range tests {
+		if got := rememberable(u); got != want {
+			t.Errorf("rememberable(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
+
+// TestRememberedRuleMatches tests that remembered rules open the links they're meant for
+func TestRememberedRuleMatches(t *testing.T) {
+	tests := []struct {
+		url   string
+		scope rememberScope
+		match []string
+		miss  []string
+	}{
+		{url: "https://docs.github.com/en/", scope: rememberHost, match: []string{"https://docs.github.com/en/pages"}, miss: []string{"https://github.com/alice"}},
+		{url: "https://docs.github.com/en/", scope: rememberDomain, match: []string{"https://github.com/", "https://gist.github.com/bob"}, miss: []string{"https://notgithub.com/"}},
+		{url: "https://docs.github.com/en/", scope: rememberPrefix, match: []string{"https://docs.github.com/en", "https://docs.github.com/en/pages"}, miss: []string{"https://docs.github.com/de", "https://docs.github.com/english"}},
+		{url: "https://docs.github.com/my docs/", scope: rememberPrefix, match: []string{"https://docs.github.com/my%20docs/a", "https://docs.github.com/my docs"}, miss: []string{"https://docs.github.com/my"}},
+	}
+	for _, tt := range tests {
+		rule, err := rememberRule(tt.url, tt.scope, "firefox.desktop")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := &Config{Rules: []Rule{rule}}
+		for _, u := range tt.match {
+			if cfg.findRule(u) == nil {
+				t.Errorf("%s rule doesn't match %s", tt.scope, u)
+			}
+		}
+		for _, u := range tt.miss {
+			if cfg.findRule(u) != nil {
+				t.Errorf("%s rule matches %s", tt.scope, u)
+			}
+		}
+	}
+}
+
+// TestConfigAddRememberedRule tests placing remembered rules in the rule list
+func TestConfigAddRememberedRule(t *testing.T) {
+	tests := []struct {
+		position string
+		want     []string
+	}{
+		{position: "", want: []string{"new", "first", "second"}},
+		{position: rememberAtTop, want: []string{"new", "first", "second"}},
+		{position: rememberAtBottom, want: []string{"first", "second", "new"}},
+	}
+	for _, tt := range tests {
+		cfg := &Config{RememberPosition: tt.position, Rules: []Rule{{Name: "first"}, {Name: "second"}}}
+		cfg.addRememberedRule(Rule{Name: "new"})
+		var got []string
+		for _, r := range cfg.Rules {
+			got = append(got, r.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("addRememberedRule() at %q = %v, want %v", tt.position, got, tt.want)
+		}
+	}
+
+	if err := validateRememberPosition("middle"); err == nil {
+		t.Error("validateRememberPosition(\"middle\") = nil, want an error")
+	}
+}
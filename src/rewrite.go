@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// rewritePlaceholders describes the placeholders available in rewrite templates,
+// in the order they are documented in the UI.
+var rewritePlaceholders = []struct {
+	Name        string
+	Description string
+}{
+	{"{url}", "the whole URL"},
+	{"{scheme}", "scheme, e.g. https"},
+	{"{host}", "hostname without port"},
+	{"{port}", "explicit port, or nothing"},
+	{"{:port}", "\":\" and the port, if there is one"},
+	{"{path}", "path, starting with /"},
+	{"{query}", "query string without ?"},
+	{"{?query}", "\"?\" and the query, if there is one"},
+	{"{fragment}", "fragment without #"},
+	{"{#fragment}", "\"#\" and the fragment, if there is one"},
+	{"{query:name}", "value of the query parameter name"},
+}
+
+// conditionGroup returns the rewrite's conditions as a single group
+func (rw *Rewrite) conditionGroup() ConditionGroup {
+	return ConditionGroup{Logic: rw.Logic, Conditions: rw.Conditions, Groups: rw.Groups}
+}
+
+// setConditionGroup replaces the rewrite's conditions, groups and logic with those of g
+func (rw *Rewrite) setConditionGroup(g ConditionGroup) {
+	rw.Conditions = g.Conditions
+	rw.Groups = g.Groups
+	rw.Logic = g.Logic
+	if rw.Logic == "" {
+		rw.Logic = "all"
+	}
+}
+
+// rewriteURL applies the config's rewrites to a URL opened by source, in order.
+// Each rewrite sees the output of the previous one.
+func (cfg *Config) rewriteURL(rawURL string, source *sourceApp) string {
+	return applyRewrites(cfg.Rewrites, rawURL, source)
+}
+
+// applyRewrites applies each rewrite whose conditions match to the URL.
+// Rewrites without conditions apply to every URL.
+func applyRewrites(rewrites []Rewrite, rawURL string, source *sourceApp) string {
+	for i := range rewrites {
+		rw := &rewrites[i]
+		if group := rw.conditionGroup(); !group.isEmpty() {
+			in := newMatchInput(rawURL)
+			in.source = source
+			if !compileGroup(group).match(in) {
+				continue
+			}
+		}
+		if rewritten, err := rw.apply(rawURL); err == nil {
+			rawURL = rewritten
+		}
+	}
+	return rawURL
+}
+
+// apply strips the rewrite's query parameters from the URL, then expands its template.
+func (rw *Rewrite) apply(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rw.StripParams) > 0 {
+		u.RawQuery = stripQueryParams(u.RawQuery, rw.StripParams)
+		u.ForceQuery = false
+	}
+	if rw.Template == "" {
+		return u.String(), nil
+	}
+
+	rewritten, err := expandRewriteTemplate(rw.Template, u)
+	if err != nil {
+		return "", err
+	}
+	if parsed, err := url.Parse(rewritten); err != nil || parsed.Scheme == "" {
+		return "", fmt.Errorf("rewrite produced an invalid URL: %s", rewritten)
+	}
+	return rewritten, nil
+}
+
+// stripQueryParams removes parameters whose names match any of the patterns
+// from a raw query string. Patterns may contain * and ? wildcards, e.g. "utm_*".
+// The remaining parameters keep their order and encoding.
+func stripQueryParams(rawQuery string, patterns []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if param != "" && !matchesAnyParam(name, patterns) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func matchesAnyParam(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// expandRewriteTemplate replaces the placeholders in a template with parts of u.
+// See rewritePlaceholders for the supported placeholders.
+func expandRewriteTemplate(template string, u *url.URL) (string, error) {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(template, '{')
+		if open == -1 {
+			b.WriteString(template)
+			return b.String(), nil
+		}
+		closing := strings.IndexByte(template[open:], '}')
+		if closing == -1 {
+			return "", fmt.Errorf("Unclosed { in template")
+		}
+		closing += open
+
+		value, err := templateValue(template[open+1:closing], u)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(template[:open])
+		b.WriteString(value)
+		template = template[closing+1:]
+	}
+}
+
+// templateValue returns the value of a single template placeholder, without braces.
+func templateValue(name string, u *url.URL) (string, error) {
+	host := u.Hostname()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+
+	switch name {
+	case "url":
+		return u.String(), nil
+	case "scheme":
+		return u.Scheme, nil
+	case "host":
+		return host, nil
+	case "port":
+		return u.Port(), nil
+	case ":port":
+		return prefixIfSet(":", u.Port()), nil
+	case "path":
+		return u.EscapedPath(), nil
+	case "query":
+		return u.RawQuery, nil
+	case "?query":
+		return prefixIfSet("?", u.RawQuery), nil
+	case "fragment":
+		return u.EscapedFragment(), nil
+	case "#fragment":
+		return prefixIfSet("#", u.EscapedFragment()), nil
+	}
+
+	if param, ok := strings.CutPrefix(name, "query:"); ok && param != "" {
+		return url.QueryEscape(u.Query().Get(param)), nil
+	}
+	return "", fmt.Errorf("Unknown placeholder {%s}", name)
+}
+
+func prefixIfSet(prefix, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TestStripQueryParams tests removing query parameters by name and wildcard
+func TestStripQueryParams(t *testing.T) {
+	tracking := []string{"utm_*", "fbclid", "gclid"}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "no query", query: "", want: ""},
+		{name: "only tracking", query: "utm_source=x&utm_medium=y", want: ""},
+		{name: "keeps other params in order", query: "b=2&utm_source=x&a=1", want: "b=2&a=1"},
+		{name: "exact names", query: "fbclid=abc&id=5&gclid=def", want: "id=5"},
+		{name: "keeps encoding", query: "q=a%20b&fbclid=1", want: "q=a%20b"},
+		{name: "escaped name", query: "utm%5Fsource=x&v=1", want: "v=1"},
+		{name: "prefix is not a match", query: "fbclid_extra=1", want: "fbclid_extra=1"},
+		{name: "empty parts dropped", query: "a=1&&fbclid=2", want: "a=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripQueryParams(tt.query, tracking); got != tt.want {
+				t.Errorf("stripQueryParams(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpandRewriteTemplate tests template placeholders
+func TestExpandRewriteTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "https upgrade",
+			url:      "http://example.com:8080/a/b?x=1#top",
+			template: "https://{host}{:port}{path}{?query}{#fragment}",
+			want:     "https://example.com:8080/a/b?x=1#top",
+		},
+		{
+			name:     "optional parts omitted",
+			url:      "http://example.com/a",
+			template: "https://{host}{:port}{path}{?query}{#fragment}",
+			want:     "https://example.com/a",
+		},
+		{
+			name:     "host rewrite",
+			url:      "https://www.reddit.com/r/golang/?sort=new",
+			template: "https://old.reddit.com{path}{?query}",
+			want:     "https://old.reddit.com/r/golang/?sort=new",
+		},
+		{
+			name:     "query parameter",
+			url:      "https://www.youtube.com/watch?v=abc123&t=10",
+			template: "https://yewtu.be/watch?v={query:v}",
+			want:     "https://yewtu.be/watch?v=abc123",
+		},
+		{
+			name:     "query parameter is escaped",
+			url:      "https://example.com/?q=a+b%26c",
+			template: "https://search.example/?q={query:q}",
+			want:     "https://search.example/?q=a+b%26c",
+		},
+		{
+			name:     "whole url",
+			url:      "https://example.com/x",
+			template: "https://archive.org/wait/{url}",
+			want:     "https://archive.org/wait/https://example.com/x",
+		},
+		{
+			name:     "plain parts",
+			url:      "https://example.com:444/p?q#f",
+			template: "{scheme}|{host}|{port}|{path}|{query}|{fragment}",
+			want:     "https|example.com|444|/p|q|f",
+		},
+		{
+			name:     "ipv6 host",
+			url:      "http://[::1]:3000/",
+			template: "https://{host}{:port}{path}",
+			want:     "https://[::1]:3000/",
+		},
+		{name: "unknown placeholder", url: "https://example.com", template: "https://{domain}", wantErr: true},
+		{name: "unclosed brace", url: "https://example.com", template: "https://{host", wantErr: true},
+		{name: "empty query name", url: "https://example.com", template: "https://x/{query:}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expandRewriteTemplate(tt.template, u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandRewriteTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandRewriteTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyRewrites tests ordered, conditional rewrites
+func TestApplyRewrites(t *testing.T) {
+	rewrites := []Rewrite{
+		{
+			Name:        "Strip tracking",
+			StripParams: []string{"utm_*", "fbclid", "gclid"},
+		},
+		{
+			Name:       "Upgrade example.org",
+			Conditions: []Condition{{Type: "scheme", Pattern: "http"}, {Type: "domain_suffix", Pattern: "example.org"}},
+			Logic:      "all",
+			Template:   "https://{host}{:port}{path}{?query}{#fragment}",
+		},
+		{
+			Name:       "Old Reddit",
+			Conditions: []Condition{{Type: "domain", Pattern: "www.reddit.com"}, {Type: "domain", Pattern: "reddit.com"}},
+			Logic:      "any",
+			Template:   "https://old.reddit.com{path}{?query}{#fragment}",
+		},
+		{
+			// Runs after "Old Reddit", so it sees the rewritten host
+			Name:       "Old Reddit comments",
+			Conditions: []Condition{{Type: "host", Pattern: "old.reddit.com"}, {Type: "path_prefix", Pattern: "/comments"}},
+			Logic:      "all",
+			Template:   "{scheme}://{host}/r/all{path}",
+		},
+		{
+			Name:       "Broken template is skipped",
+			Conditions: []Condition{{Type: "domain", Pattern: "skip.example"}},
+			Template:   "{path}",
+		},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "no match", url: "https://github.com/a?b=c", want: "https://github.com/a?b=c"},
+		{name: "strip tracking", url: "https://github.com/a?utm_source=x&b=c", want: "https://github.com/a?b=c"},
+		{name: "strip all params", url: "https://github.com/a?fbclid=1", want: "https://github.com/a"},
+		{name: "upgrade http", url: "http://docs.example.org/x?utm_campaign=y", want: "https://docs.example.org/x"},
+		{name: "https untouched", url: "https://docs.example.org/x", want: "https://docs.example.org/x"},
+		{name: "other host not upgraded", url: "http://example.com/x", want: "http://example.com/x"},
+		{name: "host rewrite", url: "https://www.reddit.com/r/golang", want: "https://old.reddit.com/r/golang"},
+		{name: "chained rewrite", url: "https://reddit.com/comments/abc", want: "https://old.reddit.com/r/all/comments/abc"},
+		{name: "invalid result keeps url", url: "https://skip.example/x", want: "https://skip.example/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyRewrites(rewrites, tt.url, nil); got != tt.want {
+				t.Errorf("applyRewrites(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyRewrites_MatchesRewrittenURL tests that rules match the rewritten URL
+func TestApplyRewrites_MatchesRewrittenURL(t *testing.T) {
+	cfg := &Config{
+		Rewrites: []Rewrite{{
+			Conditions: []Condition{{Type: "domain", Pattern: "www.reddit.com"}},
+			Template:   "https://old.reddit.com{path}",
+		}},
+		Rules: []Rule{{
+			Browser:    "reddit.desktop",
+			Conditions: []Condition{{Type: "domain", Pattern: "old.reddit.com"}},
+		}},
+	}
+
+	url := cfg.rewriteURL("https://www.reddit.com/r/linux", nil)
+	if browser, _, _ := cfg.matchRule(url); browser != "reddit.desktop" {
+		t.Errorf("matchRule(%q) = %q, want reddit.desktop", url, browser)
+	}
+}
+
+// TestValidateRewrite tests rewrite validation
+func TestValidateRewrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite Rewrite
+		wantErr bool
+	}{
+		{name: "strip only", rewrite: Rewrite{StripParams: []string{"utm_*"}}},
+		{name: "template only", rewrite: Rewrite{Template: "https://old.reddit.com{path}"}},
+		{name: "with conditions", rewrite: Rewrite{Template: "https://{host}{path}", Conditions: []Condition{{Type: "scheme", Pattern: "http"}}}},
+		{name: "nothing to do", rewrite: Rewrite{Name: "empty"}, wantErr: true},
+		{name: "unknown placeholder", rewrite: Rewrite{Template: "https://{domain}/"}, wantErr: true},
+		{name: "relative template", rewrite: Rewrite{Template: "{path}"}, wantErr: true},
+		{name: "bad param pattern", rewrite: Rewrite{StripParams: []string{"utm_["}}, wantErr: true},
+		{name: "param with equals", rewrite: Rewrite{StripParams: []string{"a=b"}}, wantErr: true},
+		{name: "invalid condition", rewrite: Rewrite{Template: "https://{host}", Conditions: []Condition{{Type: "regex", Pattern: "["}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRewrite(tt.rewrite); (err != nil) != tt.wantErr {
+				t.Errorf("validateRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfigTOML_Rewrites tests that rewrites round-trip through TOML
+func TestConfigTOML_Rewrites(t *testing.T) {
+	input := `
+[[rewrites]]
+name = "Strip tracking"
+strip_params = ["utm_*", "fbclid"]
+
+[[rewrites]]
+name = "Old Reddit"
+template = "https://old.reddit.com{path}{?query}"
+
+[[rewrites.conditions]]
+type = "domain"
+pattern = "www.reddit.com"
+`
+	var cfg Config
+	if err := toml.Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(cfg.Rewrites) != 2 {
+		t.Fatalf("got %d rewrites, want 2", len(cfg.Rewrites))
+	}
+	if got := cfg.Rewrites[0].StripParams; len(got) != 2 || got[0] != "utm_*" {
+		t.Errorf("StripParams = %v", got)
+	}
+	if got := cfg.Rewrites[1].Conditions; len(got) != 1 || got[0].Pattern != "www.reddit.com" {
+		t.Errorf("Conditions = %v", got)
+	}
+
+	data, err := toml.Marshal(&cfg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var roundTrip Config
+	if err := toml.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal() of marshaled config error = %v", err)
+	}
+	if len(roundTrip.Rewrites) != 2 || roundTrip.Rewrites[1].Template != cfg.Rewrites[1].Template {
+		t.Errorf("round trip = %+v", roundTrip.Rewrites)
+	}
+}
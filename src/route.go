@@ -0,0 +1,245 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// urlStep is one of the transformations a URL goes through before rules are
+// matched, recorded so the routing can be explained.
+type urlStep struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // the URL after this step
+}
+
+// prepareURL unwraps, expands and rewrites a URL, so rules, the picker and the
+// browser all see the result. Short links can point at wrapped links too, so
+// expanded links are unwrapped again. It returns the URL and every step taken.
+func (cfg *Config) prepareURL(url string, source *sourceApp) (string, []urlStep) {
+	var steps []urlStep
+	step := func(name, next string) {
+		steps = append(steps, urlStep{Name: name, URL: next})
+		url = next
+	}
+
+	step("unwrap", cfg.unwrapURL(url))
+	if expanded := cfg.expandShortLink(url); expanded != url {
+		step("expand short link", expanded)
+		step("unwrap", cfg.unwrapURL(url))
+	}
+	step("rewrite", cfg.rewriteURL(url, source))
+	return url, steps
+}
+
+// routeAction is what happens to a URL once it's been routed.
+type routeAction string
+
+const (
+	routeBrowser  routeAction = "browser"  // a rule opens it in a browser
+	routeAsk      routeAction = "ask"      // a rule always asks, so the picker is shown
+	routeFavorite routeAction = "favorite" // no rule matched, it opens in the favorite browser
+	routeFallback routeAction = "fallback" // no rule matched, it opens in the fallback app of its scheme
+	routePicker   routeAction = "picker"   // no rule matched, the picker is shown
+)
+
+// routeDecision is the outcome of routing a URL.
+type routeDecision struct {
+	Action    routeAction    `json:"action"`
+	Browser   string         `json:"browser,omitempty"`    // browser ID for routeBrowser, routeFavorite and routeFallback
+	Launch    *launchOptions `json:"launch,omitempty"`     // how the matched rule launches the browser, nil for the default
+	RuleIndex int            `json:"rule_index,omitempty"` // 1-based position of the matched rule, 0 if none
+	Fallbacks []string       `json:"fallbacks,omitempty"`  // installed browsers to try in order if Browser fails to start
+	Missing   string         `json:"missing,omitempty"`    // browser the rule or favorite names, used instead of Browser if it were installed
+	Reason    string         `json:"reason"`
+}
+
+// route decides what to do with a prepared URL: open it in the browser of the
+// first matching rule, ask, fall back to the favorite browser or show the picker.
+// Links with other schemes than http and https fall back to their scheme's
+// fallback app instead of the favorite browser. A browser that isn't installed
+// is replaced by the first installed one of its fallbacks, see fallbackChain.
+// installed reports whether a browser ID belongs to an installed browser.
+func (cfg *Config) route(url string, source *sourceApp, installed func(browserID string) bool) routeDecision {
+	in := newMatchInput(url)
+	in.source = source
+
+	http := handlerScheme(url) == "http"
+	var missing string
+	if rule := cfg.findRuleFor(in); rule != nil {
+		index := cfg.ruleIndex(rule)
+		if rule.AlwaysAsk {
+			// A browser chosen for the domain in the picker is used until it expires
+			if choice, ok := cfg.stickyBrowser(in.domain); ok && installed(choice.Browser) {
+				return routeDecision{
+					Action:    routeBrowser,
+					Browser:   choice.Browser,
+					RuleIndex: index,
+					Fallbacks: cfg.fallbackChain(choice.Browser, nil, http, installed),
+					Reason:    fmt.Sprintf("rule %d%s matched and always asks, but %s was chosen for %s %s", index, quotedName(rule.Name), choice.Browser, in.domain, choice.describe()),
+				}
+			}
+			return routeDecision{
+				Action:    routeAsk,
+				RuleIndex: index,
+				Reason:    fmt.Sprintf("rule %d%s matched and always asks", index, quotedName(rule.Name)),
+			}
+		}
+		if installed(rule.Browser) {
+			decision := routeDecision{
+				Action:    routeBrowser,
+				Browser:   rule.Browser,
+				RuleIndex: index,
+				Fallbacks: cfg.fallbackChain(rule.Browser, rule.Fallbacks, http, installed),
+				Reason:    fmt.Sprintf("rule %d%s matched", index, quotedName(rule.Name)),
+			}
+			if opts := rule.launchOptions(); !opts.isDefault() {
+				decision.Launch = &opts
+			}
+			return decision
+		}
+		missing = fmt.Sprintf("rule %d%s matched, but %s is not installed", index, quotedName(rule.Name), rule.Browser)
+		// Launch options are meant for the rule's browser, so fallbacks are launched normally
+		if chain := cfg.fallbackChain(rule.Browser, rule.Fallbacks, http, installed); len(chain) > 0 {
+			return routeDecision{
+				Action:    routeBrowser,
+				Browser:   chain[0],
+				RuleIndex: index,
+				Fallbacks: chain[1:],
+				Missing:   rule.Browser,
+				Reason:    fmt.Sprintf("%s, so its fallback %s is used", missing, chain[0]),
+			}
+		}
+	}
+
+	reason := missing
+	if reason == "" {
+		reason = "no rule matched"
+	}
+
+	if !http {
+		return cfg.routeScheme(handlerScheme(url), reason, installed)
+	}
+
+	if !cfg.PromptOnClick && cfg.FavoriteBrowser != "" {
+		chain := cfg.fallbackChain(cfg.FavoriteBrowser, nil, true, installed)
+		if installed(cfg.FavoriteBrowser) {
+			return routeDecision{
+				Action:    routeFavorite,
+				Browser:   cfg.FavoriteBrowser,
+				Fallbacks: chain,
+				Reason:    reason + ", so the favorite browser is used",
+			}
+		}
+		reason += fmt.Sprintf(" and the favorite browser %s is not installed", cfg.FavoriteBrowser)
+		if len(chain) > 0 {
+			return routeDecision{
+				Action:    routeFavorite,
+				Browser:   chain[0],
+				Fallbacks: chain[1:],
+				Missing:   cfg.FavoriteBrowser,
+				Reason:    fmt.Sprintf("%s, so the fallback browser %s is used", reason, chain[0]),
+			}
+		}
+	} else if cfg.PromptOnClick {
+		reason += " and prompt_on_click is on"
+	} else {
+		reason += " and there is no favorite browser"
+	}
+
+	return routeDecision{Action: routePicker, Reason: reason + ", so the picker is shown"}
+}
+
+// routeScheme falls back to the fallback app of a scheme other than http and
+// https, when no rule opened the link.
+func (cfg *Config) routeScheme(scheme, reason string, installed func(browserID string) bool) routeDecision {
+	h := cfg.schemeHandler(scheme)
+	switch {
+	case h == nil || h.Fallback == "":
+		reason += fmt.Sprintf(" and %s links have no fallback app", scheme)
+	case installed(h.Fallback):
+		return routeDecision{
+			Action:  routeFallback,
+			Browser: h.Fallback,
+			Reason:  fmt.Sprintf("%s, so the fallback app for %s links is used", reason, scheme),
+		}
+	default:
+		reason += fmt.Sprintf(" and the fallback app %s is not installed", h.Fallback)
+	}
+	return routeDecision{Action: routePicker, Reason: reason + ", so the picker is shown"}
+}
+
+// fallbackChain returns the installed browsers to try in order when browser is
+// missing or fails to start: a rule's own fallbacks, then, for http and https
+// links, the global fallback browsers. browser and duplicates are left out.
+func (cfg *Config) fallbackChain(browser string, fallbacks []string, http bool, installed func(browserID string) bool) []string {
+	candidates := fallbacks
+	if http {
+		candidates = append(append([]string(nil), fallbacks...), cfg.FallbackBrowsers...)
+	}
+	seen := map[string]bool{browser: true}
+	var chain []string
+	for _, id := range candidates {
+		if !seen[id] && installed(id) {
+			chain = append(chain, id)
+		}
+		seen[id] = true
+	}
+	return chain
+}
+
+// ruleIndex returns the 1-based position of a rule in cfg.Rules, or 0.
+func (cfg *Config) ruleIndex(rule *Rule) int {
+	for i := range cfg.Rules {
+		if &cfg.Rules[i] == rule {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// launchGroup is a browser, how to launch it and the URLs to open in it, in
+// the order they were given.
+type launchGroup struct {
+	Browser   string
+	Launch    launchOptions
+	Fallbacks []string // tried in order if Browser fails to start
+	Missing   string   // browser the URLs were meant for, if it isn't installed
+	URLs      []string
+	Rules     []int // 1-based position of the rule that routed each of URLs, 0 if none
+}
+
+// groupURLs routes each URL of a multi-URL open. URLs going to the same browser
+// with the same launch options are grouped so they can be opened in one launch;
+// the rest need the picker.
+func (cfg *Config) groupURLs(urls []string, source *sourceApp, installed func(browserID string) bool) (groups []launchGroup, pick []string) {
+	index := make(map[string]int)
+	for _, url := range urls {
+		url, _ = cfg.prepareURL(url, source)
+		decision := cfg.route(url, source, installed)
+		if decision.Browser == "" {
+			pick = append(pick, url)
+			continue
+		}
+		var opts launchOptions
+		if decision.Launch != nil {
+			opts = *decision.Launch
+		}
+		key := strings.Join(append([]string{decision.Browser, opts.key(), decision.Missing}, decision.Fallbacks...), "\x00")
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, launchGroup{
+				Browser:   decision.Browser,
+				Launch:    opts,
+				Fallbacks: decision.Fallbacks,
+				Missing:   decision.Missing,
+			})
+		}
+		groups[i].URLs = append(groups[i].URLs, url)
+		groups[i].Rules = append(groups[i].Rules, decision.RuleIndex)
+	}
+	return groups, pick
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Actions of the notification shown when a rule opens links
+const (
+	noticeActionOpenElsewhere = "open-elsewhere"
+	noticeActionEditRule      = "edit-rule"
+)
+
+// routeNotice is the notification telling the user where rules opened links.
+type routeNotice struct {
+	Title string
+	Body  string
+	Rule  int // 1-based position of the rule to offer editing, 0 if several rules matched
+}
+
+// noticeFor returns the notification for a group opened in its browser, or
+// false if none is shown: when notifications are off, no rule routed the
+// group's links, or every rule that did is quiet. name returns a browser's
+// display name.
+func (cfg *Config) noticeFor(g launchGroup, name func(browserID string) string) (routeNotice, bool) {
+	if !cfg.NotifyOnRoute {
+		return routeNotice{}, false
+	}
+
+	var rules []string
+	var notice routeNotice
+	for i, index := range g.Rules {
+		if index < 1 || index > len(cfg.Rules) || cfg.Rules[index-1].Quiet || slices.Contains(g.Rules[:i], index) {
+			continue
+		}
+		rules = append(rules, fmt.Sprintf("%d%s", index, quotedName(cfg.Rules[index-1].Name)))
+		notice.Rule = index
+	}
+	if len(rules) == 0 {
+		return routeNotice{}, false
+	}
+
+	if len(g.URLs) == 1 {
+		notice.Title = fmt.Sprintf("Opened in %s", name(g.Browser))
+		notice.Body = g.URLs[0] + "\n"
+	} else {
+		notice.Title = fmt.Sprintf("Opened %d links in %s", len(g.URLs), name(g.Browser))
+	}
+	if len(rules) == 1 {
+		notice.Body += fmt.Sprintf("Rule %s matched", rules[0])
+	} else {
+		notice.Body += fmt.Sprintf("Rules %s matched", strings.Join(rules, ", "))
+		notice.Rule = 0
+	}
+	return notice, true
+}
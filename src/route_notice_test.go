@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConfigNoticeFor tests the notification shown when rules open links
+func TestConfigNoticeFor(t *testing.T) {
+	cfg := &Config{
+		NotifyOnRoute: true,
+		Rules: []Rule{
+			{Name: "Work", Browser: "chromium.desktop"},
+			{Browser: "chromium.desktop"},
+			{Name: "Banking", Browser: "firefox.desktop", Quiet: true},
+		},
+	}
+	name := func(id string) string { return strings.TrimSuffix(id, ".desktop") }
+
+	tests := []struct {
+		name   string
+		group  launchGroup
+		wantOK bool
+		want   routeNotice
+	}{
+		{
+			name:   "one link",
+			group:  launchGroup{Browser: "chromium.desktop", Rules: []int{1}, URLs: []string{"https://corp.example/?a=1&b=2"}},
+			wantOK: true,
+			want:   routeNotice{Title: "Opened in chromium", Body: "https://corp.example/?a=1&b=2\nRule 1 (\"Work\") matched", Rule: 1},
+		},
+		{
+			name:   "several links",
+			group:  launchGroup{Browser: "chromium.desktop", Rules: []int{2, 2}, URLs: []string{"https://a.example", "https://b.example"}},
+			wantOK: true,
+			want:   routeNotice{Title: "Opened 2 links in chromium", Body: "Rule 2 matched", Rule: 2},
+		},
+		{
+			name:   "several rules",
+			group:  launchGroup{Browser: "chromium.desktop", Rules: []int{1, 2, 1}, URLs: []string{"https://a.example", "https://b.example", "https://c.example"}},
+			wantOK: true,
+			want:   routeNotice{Title: "Opened 3 links in chromium", Body: "Rules 1 (\"Work\"), 2 matched"},
+		},
+		{
+			name:   "quiet rules are left out",
+			group:  launchGroup{Browser: "chromium.desktop", Rules: []int{3, 2}, URLs: []string{"https://bank.example", "https://a.example"}},
+			wantOK: true,
+			want:   routeNotice{Title: "Opened 2 links in chromium", Body: "Rule 2 matched", Rule: 2},
+		},
+		{name: "quiet rule", group: launchGroup{Browser: "firefox.desktop", Rules: []int{3}, URLs: []string{"https://bank.example"}}},
+		{name: "favorite browser", group: launchGroup{Browser: "firefox.desktop", URLs: []string{"https://a.example"}, Rules: []int{0}}},
+		{name: "stale rule", group: launchGroup{Browser: "firefox.desktop", Rules: []int{4}, URLs: []string{"https://a.example"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cfg.noticeFor(tt.group, name)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("noticeFor() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	off := *cfg
+	off.NotifyOnRoute = false
+	if _, ok := off.noticeFor(tests[0].group, name); ok {
+		t.Error("noticeFor() with notifications off = true, want false")
+	}
+}
@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// installedBrowsers returns an installed check for the given browser IDs
+func installedBrowsers(ids ...string) func(string) bool {
+	return func(id string) bool {
+		for _, installed := range ids {
+			if id == installed {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TestConfigRoute tests every outcome of routing a URL
+func TestConfigRoute(t *testing.T) {
+	rules := []Rule{
+		{Name: "GitHub", Browser: "firefox.desktop", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		{Name: "Ask", AlwaysAsk: true, Conditions: []Condition{{Type: "domain", Pattern: "ask.example"}}},
+		{Name: "Missing", Browser: "missing.desktop", Conditions: []Condition{{Type: "domain", Pattern: "missing.example"}}},
+		{Name: "Off", Browser: "firefox.desktop", Disabled: true, Conditions: []Condition{{Type: "domain", Pattern: "off.example"}}},
+	}
+	installed := installedBrowsers("firefox.desktop", "chromium.desktop")
+
+	tests := []struct {
+		name        string
+		url         string
+		prompt      bool
+		favorite    string
+		wantAction  routeAction
+		wantBrowser string
+		wantRule    int
+	}{
+		{name: "rule", url: "https://github.com/x", prompt: true, wantAction: routeBrowser, wantBrowser: "firefox.desktop", wantRule: 1},
+		{name: "always ask", url: "https://ask.example/", wantAction: routeAsk, wantRule: 2},
+		{name: "no match shows picker", url: "https://example.com/", prompt: true, favorite: "chromium.desktop", wantAction: routePicker},
+		{name: "no match uses favorite", url: "https://example.com/", favorite: "chromium.desktop", wantAction: routeFavorite, wantBrowser: "chromium.desktop"},
+		{name: "favorite not installed", url: "https://example.com/", favorite: "gone.desktop", wantAction: routePicker},
+		{name: "no favorite", url: "https://example.com/", wantAction: routePicker},
+		{name: "rule browser missing", url: "https://missing.example/", favorite: "chromium.desktop", wantAction: routeFavorite, wantBrowser: "chromium.desktop"},
+		{name: "disabled rule", url: "https://off.example/", prompt: true, wantAction: routePicker},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Rules: rules, PromptOnClick: tt.prompt, FavoriteBrowser: tt.favorite}
+			got := cfg.route(tt.url, nil, installed)
+			if got.Action != tt.wantAction || got.Browser != tt.wantBrowser || got.RuleIndex != tt.wantRule {
+				t.Errorf("route(%q) = %+v, want action %s, browser %q, rule %d", tt.url, got, tt.wantAction, tt.wantBrowser, tt.wantRule)
+			}
+			if got.Reason == "" {
+				t.Error("route() gave no reason")
+			}
+		})
+	}
+}
+
+// TestConfigPrepareURL tests that URLs are unwrapped before they are rewritten
+func TestConfigPrepareURL(t *testing.T) {
+	cfg := &Config{Rewrites: []Rewrite{{StripParams: []string{"utm_*"}}}}
+
+	got, steps := cfg.prepareURL("https://slack-redir.net/link?url=https%3A%2F%2Fexample.com%2F%3Futm_source%3Dx%26id%3D1", nil)
+	if got != "https://example.com/?id=1" {
+		t.Errorf("prepareURL() = %q", got)
+	}
+	if len(steps) != 2 || steps[0].Name != "unwrap" || steps[0].URL != "https://example.com/?utm_source=x&id=1" || steps[1].Name != "rewrite" {
+		t.Errorf("steps = %+v", steps)
+	}
+}
+
+// TestConfigGroupURLs tests that URLs going to the same browser are grouped
+func TestConfigGroupURLs(t *testing.T) {
+	cfg := &Config{
+		PromptOnClick: true,
+		Rewrites:      []Rewrite{{StripParams: []string{"utm_*"}}},
+		Rules: []Rule{
+			{Browser: "firefox.desktop", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+			{Browser: "chromium.desktop", Conditions: []Condition{{Type: "domain", Pattern: "google.com"}}},
+			{AlwaysAsk: true, Conditions: []Condition{{Type: "domain", Pattern: "ask.example"}}},
+			{Browser: "firefox.desktop", Action: "new-private-window", Conditions: []Condition{{Type: "domain", Pattern: "bank.example"}}},
+		},
+	}
+	urls := []string{
+		"https://github.com/a?utm_source=x",
+		"https://google.com/",
+		"https://example.com/",
+		"https://bank.example/",
+		"https://github.com/b",
+		"https://ask.example/",
+	}
+
+	groups, pick := cfg.groupURLs(urls, nil, installedBrowsers("firefox.desktop", "chromium.desktop"))
+
+	wantGroups := []launchGroup{
+		{Browser: "firefox.desktop", URLs: []string{"https://github.com/a", "https://github.com/b"}, Rules: []int{1, 1}},
+		{Browser: "chromium.desktop", URLs: []string{"https://google.com/"}, Rules: []int{2}},
+		{Browser: "firefox.desktop", Launch: launchOptions{Action: "new-private-window"}, URLs: []string{"https://bank.example/"}, Rules: []int{4}},
+	}
+	if !reflect.DeepEqual(groups, wantGroups) {
+		t.Errorf("groups = %+v, want %+v", groups, wantGroups)
+	}
+	wantPick := []string{"https://example.com/", "https://ask.example/"}
+	if !reflect.DeepEqual(pick, wantPick) {
+		t.Errorf("pick = %q, want %q", pick, wantPick)
+	}
+}
+
+// TestConfigRoute_Schemes tests routing links of schemes other than http and https
+func TestConfigRoute_Schemes(t *testing.T) {
+	cfg := &Config{
+		FavoriteBrowser: "firefox.desktop",
+		Schemes: []SchemeHandler{
+			{Scheme: "mailto", Fallback: "thunderbird.desktop"},
+			{Scheme: "tel"},
+			{Scheme: "sip", Fallback: "gone.desktop"},
+		},
+		Rules: []Rule{
+			{Browser: "evolution.desktop", Conditions: []Condition{
+				{Type: "scheme", Pattern: "mailto"},
+				{Type: "keyword", Pattern: "@work.example"},
+			}},
+		},
+	}
+	installed := installedBrowsers("firefox.desktop", "thunderbird.desktop", "evolution.desktop")
+
+	tests := []struct {
+		url         string
+		wantAction  routeAction
+		wantBrowser string
+	}{
+		{url: "mailto:alice@work.example", wantAction: routeBrowser, wantBrowser: "evolution.desktop"},
+		{url: "mailto:alice@home.example", wantAction: routeFallback, wantBrowser: "thunderbird.desktop"},
+		{url: "tel:+15551234", wantAction: routePicker},
+		{url: "sip:alice@example.com", wantAction: routePicker},
+		{url: "zoommtg://zoom.us/join", wantAction: routePicker},
+		{url: "https://example.com", wantAction: routeFavorite, wantBrowser: "firefox.desktop"},
+	}
+
+	for _, tt := range tests {
+		got := cfg.route(tt.url, nil, installed)
+		if got.Action != tt.wantAction || got.Browser != tt.wantBrowser {
+			t.Errorf("route(%q) = %+v, want action %s, browser %q", tt.url, got, tt.wantAction, tt.wantBrowser)
+		}
+	}
+}
+
+// TestConfigRoute_Fallbacks tests replacing missing browsers with their fallbacks
+func TestConfigRoute_Fallbacks(t *testing.T) {
+	cfg := &Config{
+		FavoriteBrowser:  "gone.desktop",
+		FallbackBrowsers: []string{"chromium.desktop", "uninstalled.desktop", "firefox.desktop"},
+		Rules: []Rule{
+			{Name: "Work", Browser: "edge.desktop", Fallbacks: []string{"uninstalled.desktop", "epiphany.desktop"}, Action: "new-window",
+				Conditions: []Condition{{Type: "domain", Pattern: "work.example"}}},
+			{Name: "Video", Browser: "firefox.desktop", Fallbacks: []string{"chromium.desktop"},
+				Conditions: []Condition{{Type: "domain", Pattern: "video.example"}}},
+			{Name: "Mail", Browser: "evolution.desktop", Fallbacks: []string{"thunderbird.desktop"},
+				Conditions: []Condition{{Type: "scheme", Pattern: "mailto"}}},
+		},
+	}
+	installed := installedBrowsers("firefox.desktop", "chromium.desktop", "epiphany.desktop", "thunderbird.desktop")
+
+	tests := []struct {
+		name          string
+		url           string
+		wantAction    routeAction
+		wantBrowser   string
+		wantFallbacks []string
+		wantMissing   string
+	}{
+		{
+			name: "missing rule browser", url: "https://work.example", wantAction: routeBrowser,
+			wantBrowser: "epiphany.desktop", wantFallbacks: []string{"chromium.desktop", "firefox.desktop"}, wantMissing: "edge.desktop",
+		},
+		{
+			name: "installed rule browser", url: "https://video.example", wantAction: routeBrowser,
+			wantBrowser: "firefox.desktop", wantFallbacks: []string{"chromium.desktop"},
+		},
+		{
+			name: "missing favorite", url: "https://example.com", wantAction: routeFavorite,
+			wantBrowser: "chromium.desktop", wantFallbacks: []string{"firefox.desktop"}, wantMissing: "gone.desktop",
+		},
+		{
+			name: "global fallbacks are browsers, not mail clients", url: "mailto:alice@example.com", wantAction: routeBrowser,
+			wantBrowser: "thunderbird.desktop", wantMissing: "evolution.desktop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.route(tt.url, nil, installed)
+			if got.Action != tt.wantAction || got.Browser != tt.wantBrowser || got.Missing != tt.wantMissing ||
+				strings.Join(got.Fallbacks, ",") != strings.Join(tt.wantFallbacks, ",") {
+				t.Errorf("route(%q) = %+v, want action %s, browser %q, fallbacks %q, missing %q",
+					tt.url, got, tt.wantAction, tt.wantBrowser, tt.wantFallbacks, tt.wantMissing)
+			}
+			// The rule's launch options are for its own browser
+			if got.Missing != "" && got.Launch != nil {
+				t.Errorf("route(%q) launches the fallback with %+v", tt.url, *got.Launch)
+			}
+		})
+	}
+
+	// Without any installed fallback, the picker is shown
+	cfg.FallbackBrowsers = nil
+	cfg.Rules[0].Fallbacks = nil
+	if got := cfg.route("https://work.example", nil, installed); got.Action != routePicker {
+		t.Errorf("route() without fallbacks = %+v, want the picker", got)
+	}
+}
+
+// TestConfigRoute_Sticky tests that browsers chosen for always ask rules are
+// used until they expire
+func TestConfigRoute_Sticky(t *testing.T) {
+	now := time.Date(2026, 10, 17, 14, 3, 0, 0, time.UTC)
+	setClock(t, now)
+	setLoginSession(t, "boot/2")
+
+	cfg := &Config{
+		FallbackBrowsers: []string{"chromium.desktop"},
+		Rules: []Rule{
+			{Name: "Ask", AlwaysAsk: true, Conditions: []Condition{{Type: "domain_suffix", Pattern: "ask.example"}}},
+			{Name: "GitHub", Browser: "chromium.desktop", Conditions: []Condition{{Type: "domain", Pattern: "github.com"}}},
+		},
+		sticky: map[string]stickyChoice{
+			"ask.example":         {Browser: "firefox.desktop", Expires: now.Add(time.Minute)},
+			"session.ask.example": {Browser: "firefox.desktop", Session: "boot/2"},
+			"old.ask.example":     {Browser: "firefox.desktop", Expires: now},
+			"ended.ask.example":   {Browser: "firefox.desktop", Session: "boot/1"},
+			"gone.ask.example":    {Browser: "gone.desktop", Expires: now.Add(time.Minute)},
+			"github.com":          {Browser: "firefox.desktop", Expires: now.Add(time.Minute)},
+		},
+	}
+	installed := installedBrowsers("firefox.desktop", "chromium.desktop")
+
+	tests := []struct {
+		url         string
+		wantAction  routeAction
+		wantBrowser string
+	}{
+		{url: "https://ask.example/a", wantAction: routeBrowser, wantBrowser: "firefox.desktop"},
+		{url: "https://session.ask.example/", wantAction: routeBrowser, wantBrowser: "firefox.desktop"},
+		{url: "https://old.ask.example/", wantAction: routeAsk},
+		{url: "https://ended.ask.example/", wantAction: routeAsk},
+		{url: "https://gone.ask.example/", wantAction: routeAsk},
+		{url: "https://other.ask.example/", wantAction: routeAsk},
+		// Only rules that always ask are skipped
+		{url: "https://github.com/", wantAction: routeBrowser, wantBrowser: "chromium.desktop"},
+	}
+	for _, tt := range tests {
+		got := cfg.route(tt.url, nil, installed)
+		if got.Action != tt.wantAction || got.Browser != tt.wantBrowser || got.RuleIndex == 0 {
+			t.Errorf("route(%q) = %+v, want action %s, browser %q", tt.url, got, tt.wantAction, tt.wantBrowser)
+		}
+	}
+
+	got := cfg.route("https://ask.example/", nil, installed)
+	if want := []string{"chromium.desktop"}; !reflect.DeepEqual(got.Fallbacks, want) {
+		t.Errorf("sticky fallbacks = %v, want %v", got.Fallbacks, want)
+	}
+	if !strings.Contains(got.Reason, "firefox.desktop was chosen for ask.example until") {
+		t.Errorf("sticky reason = %q", got.Reason)
+	}
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clock returns the current time for schedule conditions. Tests replace it to
+// match against a fixed time.
+var clock = time.Now
+
+// schedule is a parsed schedule condition pattern such as
+// "mon-fri 09:00-17:00 Europe/Berlin". Every part is optional, but a pattern
+// must contain at least a set of days or a time range.
+type schedule struct {
+	days     [7]bool // indexed by time.Weekday
+	hasTime  bool
+	start    int    // minutes since midnight, inclusive
+	end      int    // minutes since midnight, exclusive; may be before start
+	timezone string // IANA time zone name, or "" for local time
+	loc      *time.Location
+}
+
+// dayNames maps the accepted day names to their weekday.
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// weekOrder lists the weekdays in the order they are displayed, starting on Monday.
+var weekOrder = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+// parseSchedule parses a schedule pattern made of whitespace-separated parts:
+//
+//   - days: comma-separated day names or ranges, e.g. "mon-fri", "sat,sun",
+//     "mon,wed-fri", or the shorthands "weekdays" and "weekends"
+//   - a time range "HH:MM-HH:MM"; ranges that end before they start cross
+//     midnight and belong to the day they start on
+//   - a time zone such as "Europe/Berlin" or "UTC"; local time is used otherwise
+//
+// Omitting the days matches every day, omitting the time range matches all day.
+func parseSchedule(pattern string) (*schedule, error) {
+	fields := strings.Fields(pattern)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Schedule cannot be empty")
+	}
+
+	s := &schedule{loc: time.Local}
+	var hasDays, hasZone bool
+	for _, field := range fields {
+		if days, ok := parseDays(field); ok {
+			if hasDays {
+				return nil, fmt.Errorf("Schedule can only have one set of days")
+			}
+			s.days, hasDays = days, true
+			continue
+		}
+		if field[0] >= '0' && field[0] <= '9' {
+			if s.hasTime {
+				return nil, fmt.Errorf("Schedule can only have one time range")
+			}
+			start, end, err := parseTimeRange(field)
+			if err != nil {
+				return nil, err
+			}
+			s.start, s.end, s.hasTime = start, end, true
+			continue
+		}
+		if hasZone {
+			return nil, fmt.Errorf("Unknown day or time zone: %s", field)
+		}
+		loc, err := time.LoadLocation(field)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown day or time zone: %s", field)
+		}
+		s.timezone, s.loc, hasZone = field, loc, true
+	}
+
+	if !hasDays && !s.hasTime {
+		return nil, fmt.Errorf("Schedule needs days or a time range")
+	}
+	if !hasDays {
+		for i := range s.days {
+			s.days[i] = true
+		}
+	}
+	return s, nil
+}
+
+// parseDays parses a comma-separated list of day names and day ranges.
+// ok is false if field isn't a list of days at all.
+func parseDays(field string) (days [7]bool, ok bool) {
+	for _, part := range strings.Split(strings.ToLower(field), ",") {
+		switch part {
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				days[d] = true
+			}
+			continue
+		case "weekends":
+			days[time.Saturday], days[time.Sunday] = true, true
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return days, false
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return days, false
+			}
+		}
+		// Ranges may wrap around the end of the week, e.g. "fri-mon"
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, true
+}
+
+// parseTimeRange parses "HH:MM-HH:MM" into minutes since midnight.
+// The end may be "24:00" to include the last minute of the day.
+func parseTimeRange(field string) (start, end int, err error) {
+	from, to, ok := strings.Cut(field, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("Time range must look like 09:00-17:00")
+	}
+	if start, err = parseClock(from, false); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(to, true); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("Time range cannot start and end at the same time")
+	}
+	return start, end, nil
+}
+
+// parseClock parses a 24-hour "HH:MM" time into minutes since midnight.
+func parseClock(s string, allowEndOfDay bool) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hours, errH := strconv.Atoi(h)
+	minutes, errM := strconv.Atoi(m)
+	if !ok || errH != nil || errM != nil || len(m) != 2 || len(h) == 0 || len(h) > 2 {
+		return 0, fmt.Errorf("Invalid time: %s (use HH:MM)", s)
+	}
+	if allowEndOfDay && hours == 24 && minutes == 0 {
+		return 24 * 60, nil
+	}
+	if hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("Invalid time: %s (use HH:MM)", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// contains reports whether t falls within the schedule, in the schedule's time zone.
+func (s *schedule) contains(t time.Time) bool {
+	t = t.In(s.loc)
+	day := t.Weekday()
+	if !s.hasTime {
+		return s.days[day]
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	if s.start < s.end {
+		return s.days[day] && minutes >= s.start && minutes < s.end
+	}
+	// The range crosses midnight: the evening part belongs to today, the
+	// early morning part to the day before
+	if minutes >= s.start {
+		return s.days[day]
+	}
+	return minutes < s.end && s.days[(day+6)%7]
+}
+
+// formatDays formats a set of days as a compact pattern such as "mon-fri" or
+// "mon,wed,sat-sun", starting the week on Monday. All days format as "".
+func formatDays(days [7]bool) string {
+	var parts []string
+	for i := 0; i < len(weekOrder); {
+		if !days[weekOrder[i]] {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(weekOrder) && days[weekOrder[j+1]] {
+			j++
+		}
+		if i == 0 && j == len(weekOrder)-1 {
+			return ""
+		}
+		name := shortDayName(weekOrder[i])
+		switch {
+		case j == i:
+			parts = append(parts, name)
+		case j == i+1:
+			parts = append(parts, name, shortDayName(weekOrder[j]))
+		default:
+			parts = append(parts, name+"-"+shortDayName(weekOrder[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatClock formats minutes since midnight as "HH:MM".
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// formatSchedule builds a schedule pattern from its parts, leaving out empty ones.
+func formatSchedule(days, timeRange, timezone string) string {
+	var parts []string
+	for _, p := range []string{days, timeRange, timezone} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func shortDayName(d time.Weekday) string {
+	return strings.ToLower(d.String()[:3])
+}
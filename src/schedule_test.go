@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// setClock makes schedule conditions see a fixed time for the rest of the test
+func setClock(t *testing.T, now time.Time) {
+	t.Helper()
+	orig := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = orig })
+}
+
+// TestParseSchedule tests parsing and validation of schedule patterns
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		wantErr  bool
+		wantDays string // formatDays of the parsed days
+	}{
+		{name: "weekday range with hours", pattern: "mon-fri 09:00-17:00", wantDays: "mon-fri"},
+		{name: "day list", pattern: "mon,wed,fri", wantDays: "mon,wed,fri"},
+		{name: "full day names", pattern: "Saturday,Sunday", wantDays: "sat,sun"},
+		{name: "shorthand", pattern: "weekdays", wantDays: "mon-fri"},
+		{name: "range wrapping the week", pattern: "fri-mon", wantDays: "mon,fri-sun"},
+		{name: "hours only is every day", pattern: "09:00-17:00", wantDays: ""},
+		{name: "crosses midnight", pattern: "22:00-02:00", wantDays: ""},
+		{name: "end of day", pattern: "18:00-24:00", wantDays: ""},
+		{name: "with time zone", pattern: "mon-fri 09:00-17:00 Europe/Berlin", wantDays: "mon-fri"},
+		{name: "UTC", pattern: "sat 10:00-12:00 UTC", wantDays: "sat"},
+		{name: "parts in any order", pattern: "UTC 10:00-12:00 sat", wantDays: "sat"},
+
+		{name: "empty", pattern: "", wantErr: true},
+		{name: "time zone only", pattern: "UTC", wantErr: true},
+		{name: "empty time range", pattern: "mon 09:00-09:00", wantErr: true},
+		{name: "missing end", pattern: "mon 09:00", wantErr: true},
+		{name: "invalid hour", pattern: "mon 25:00-26:00", wantErr: true},
+		{name: "invalid minutes", pattern: "mon 09:7-10:00", wantErr: true},
+		{name: "24:00 start", pattern: "mon 24:00-02:00", wantErr: true},
+		{name: "unknown day", pattern: "mon-fry 09:00-17:00", wantErr: true},
+		{name: "unknown time zone", pattern: "mon Mars/Olympus", wantErr: true},
+		{name: "two time ranges", pattern: "09:00-12:00 13:00-17:00", wantErr: true},
+		{name: "two day sets", pattern: "mon tue", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+			if err == nil && formatDays(s.days) != tt.wantDays {
+				t.Errorf("days = %q, want %q", formatDays(s.days), tt.wantDays)
+			}
+		})
+	}
+}
+
+// TestScheduleContains tests schedule matching against fixed times
+func TestScheduleContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone data not available")
+	}
+
+	// 2025-06-02 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 6, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		now     time.Time
+		want    bool
+	}{
+		{name: "inside business hours", pattern: "mon-fri 09:00-17:00 UTC", now: at(2, 10, 0), want: true},
+		{name: "start is inclusive", pattern: "mon-fri 09:00-17:00 UTC", now: at(2, 9, 0), want: true},
+		{name: "end is exclusive", pattern: "mon-fri 09:00-17:00 UTC", now: at(2, 17, 0), want: false},
+		{name: "before business hours", pattern: "mon-fri 09:00-17:00 UTC", now: at(2, 8, 59), want: false},
+		{name: "weekend", pattern: "mon-fri 09:00-17:00 UTC", now: at(7, 10, 0), want: false},
+		{name: "days only", pattern: "sat,sun UTC", now: at(8, 23, 59), want: true},
+		{name: "end of day", pattern: "18:00-24:00 UTC", now: at(2, 23, 59), want: true},
+
+		// Friday 22:00 until Saturday 02:00
+		{name: "night shift evening", pattern: "fri 22:00-02:00 UTC", now: at(6, 23, 0), want: true},
+		{name: "night shift after midnight", pattern: "fri 22:00-02:00 UTC", now: at(7, 1, 30), want: true},
+		{name: "night shift ends", pattern: "fri 22:00-02:00 UTC", now: at(7, 2, 0), want: false},
+		{name: "night shift belongs to start day", pattern: "fri 22:00-02:00 UTC", now: at(6, 1, 0), want: false},
+		{name: "night shift wrong evening", pattern: "fri 22:00-02:00 UTC", now: at(7, 23, 0), want: false},
+		{name: "sunday night into monday", pattern: "sun 22:00-02:00 UTC", now: at(2, 1, 0), want: true},
+
+		// 08:30 UTC is 10:30 in Berlin during summer time
+		{name: "time zone applied", pattern: "mon 10:00-11:00 Europe/Berlin", now: at(2, 8, 30), want: true},
+		{name: "time zone changes the day", pattern: "tue 00:00-01:00 Europe/Berlin", now: at(2, 22, 30), want: true},
+		{name: "input time zone is ignored", pattern: "mon 10:00-11:00 UTC", now: at(2, 10, 30).In(berlin), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.pattern)
+			if err != nil {
+				t.Fatalf("parseSchedule(%q) error = %v", tt.pattern, err)
+			}
+			if got := s.contains(tt.now); got != tt.want {
+				t.Errorf("contains(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormatDays tests formatting day sets into compact patterns
+func TestFormatDays(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"mon,tue,wed,thu,fri", "mon-fri"},
+		{"mon,tue", "mon,tue"},
+		{"sun,mon,tue,wed,thu,fri,sat", ""},
+		{"mon,wed,thu,fri,sun", "mon,wed-fri,sun"},
+	}
+
+	for _, tt := range tests {
+		days, ok := parseDays(tt.pattern)
+		if !ok {
+			t.Fatalf("parseDays(%q) failed", tt.pattern)
+		}
+		if got := formatDays(days); got != tt.want {
+			t.Errorf("formatDays(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestRuleMatchesConditions_Schedule tests schedule conditions inside rules using the clock
+func TestRuleMatchesConditions_Schedule(t *testing.T) {
+	cfg := &Config{
+		Rules: []Rule{
+			{
+				Name:    "Work Slack",
+				Logic:   "all",
+				Browser: "work.desktop",
+				Conditions: []Condition{
+					{Type: "domain", Pattern: "app.slack.com"},
+					{Type: "schedule", Pattern: "mon-fri 09:00-17:00 UTC"},
+				},
+			},
+			{
+				Name:       "Personal Slack",
+				Browser:    "personal.desktop",
+				Conditions: []Condition{{Type: "domain", Pattern: "app.slack.com"}},
+			},
+		},
+	}
+
+	setClock(t, time.Date(2025, 6, 3, 11, 0, 0, 0, time.UTC)) // Tuesday
+	if browser, _, _ := cfg.matchRule("https://app.slack.com/client"); browser != "work.desktop" {
+		t.Errorf("during work hours got %q, want work.desktop", browser)
+	}
+
+	setClock(t, time.Date(2025, 6, 3, 19, 0, 0, 0, time.UTC)) // Tuesday evening
+	if browser, _, _ := cfg.matchRule("https://app.slack.com/client"); browser != "personal.desktop" {
+		t.Errorf("after work hours got %q, want personal.desktop", browser)
+	}
+
+	// Negated schedules match outside the given hours
+	rule := Rule{Conditions: []Condition{{Type: "schedule", Pattern: "mon-fri 09:00-17:00 UTC", Negate: true}}}
+	if !rule.matchesConditions("https://example.com") {
+		t.Error("expected negated schedule to match outside work hours")
+	}
+}
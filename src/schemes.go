@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SchemeHandler makes Switchyard route a URI scheme besides http and https,
+// e.g. mailto, tel or zoommtg. Rules match these links with the scheme
+// condition and can open them in any app that handles the scheme.
+type SchemeHandler struct {
+	Scheme   string `toml:"scheme"`             // lowercase, without the colon
+	Fallback string `toml:"fallback,omitempty"` // app used when no rule matches, the picker is shown if empty
+}
+
+// suggestedSchemes are offered in settings, as schemes people commonly want routed.
+var suggestedSchemes = []string{"mailto", "tel", "sms", "magnet", "zoommtg", "slack", "msteams", "sip"}
+
+// urlScheme returns the lowercase scheme of a URL, or "" if it has none.
+func urlScheme(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// isWebScheme reports whether links with the scheme are opened in browsers.
+func isWebScheme(scheme string) bool {
+	return scheme == "http" || scheme == "https"
+}
+
+// handlerScheme returns the scheme whose handlers can open a URL. Browsers
+// are looked up through http, and URLs without a scheme are web URLs.
+func handlerScheme(rawURL string) string {
+	scheme := urlScheme(rawURL)
+	if scheme == "" || isWebScheme(scheme) {
+		return "http"
+	}
+	return scheme
+}
+
+// normalizeScheme lowercases a scheme and strips a trailing colon, returning an
+// error if it isn't a valid URI scheme or is one Switchyard always routes.
+func normalizeScheme(scheme string) (string, error) {
+	scheme = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(scheme), ":"))
+	if scheme == "" {
+		return "", fmt.Errorf("Scheme cannot be empty")
+	}
+	for i, r := range scheme {
+		letter := r >= 'a' && r <= 'z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return "", fmt.Errorf("Invalid scheme %q: must start with a letter, followed by letters, digits, +, - or .", scheme)
+		}
+	}
+	if isWebScheme(scheme) {
+		return "", fmt.Errorf("%s links are always routed", scheme)
+	}
+	return scheme, nil
+}
+
+// schemeHandler returns the settings for a scheme, or nil if it isn't routed.
+func (cfg *Config) schemeHandler(scheme string) *SchemeHandler {
+	for i := range cfg.Schemes {
+		if cfg.Schemes[i].Scheme == scheme {
+			return &cfg.Schemes[i]
+		}
+	}
+	return nil
+}
+
+// schemeNames returns the routed schemes besides http and https.
+func (cfg *Config) schemeNames() []string {
+	names := make([]string, 0, len(cfg.Schemes))
+	for _, s := range cfg.Schemes {
+		names = append(names, s.Scheme)
+	}
+	return names
+}
+
+// urlSchemes returns the distinct handler schemes of URLs, see handlerScheme.
+func urlSchemes(urls []string) []string {
+	var schemes []string
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		if scheme := handlerScheme(u); !seen[scheme] {
+			seen[scheme] = true
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// schemeMimeType returns the MIME type apps declare to handle a URI scheme.
+func schemeMimeType(scheme string) string {
+	return "x-scheme-handler/" + scheme
+}
+
+// defaultSchemeHandler returns the desktop file ID of the app the system opens
+// links with the scheme in, or "" if there is none.
+func defaultSchemeHandler(scheme string) string {
+	output, err := hostCommand("xdg-mime", "query", "default", schemeMimeType(scheme)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// isSchemeRegistered reports whether the system opens links with the scheme in Switchyard.
+func isSchemeRegistered(scheme string) bool {
+	return defaultSchemeHandler(scheme) == getAppID()+".desktop"
+}
+
+// registerScheme makes the system open links with the scheme in Switchyard.
+// The app that opened them before becomes the fallback, unless one is set,
+// and is restored by unregisterScheme.
+func (cfg *Config) registerScheme(scheme string) error {
+	h := cfg.schemeHandler(scheme)
+	if h == nil {
+		return fmt.Errorf("%s is not a routed scheme", scheme)
+	}
+	self := getAppID() + ".desktop"
+	if previous := defaultSchemeHandler(scheme); h.Fallback == "" && previous != "" && previous != self {
+		h.Fallback = previous
+	}
+	return hostCommand("xdg-mime", "default", self, schemeMimeType(scheme)).Run()
+}
+
+// unregisterScheme hands links with the scheme back to the fallback app, or
+// else to the first of the candidates. The system has no way to unset a
+// handler, so it fails if there is no other app to hand them to.
+func (cfg *Config) unregisterScheme(scheme string, candidates []string) error {
+	next := ""
+	if h := cfg.schemeHandler(scheme); h != nil {
+		next = h.Fallback
+	}
+	if next == "" && len(candidates) > 0 {
+		next = candidates[0]
+	}
+	if next == "" {
+		return fmt.Errorf("no other app opens %s links", scheme)
+	}
+	return hostCommand("xdg-mime", "default", next, schemeMimeType(scheme)).Run()
+}
+
+// hasOpaqueScheme reports whether a URL has a scheme without "//", like
+// mailto:user@example.com or magnet:?xt=..., as opposed to a bare host:port.
+func hasOpaqueScheme(rawURL string) bool {
+	if strings.Contains(rawURL, "://") {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme != "" && !looksLikeHostPort(u)
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+// TestNormalizeScheme tests cleaning up schemes entered in settings
+func TestNormalizeScheme(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "mailto", want: "mailto"},
+		{input: " MailTo: ", want: "mailto"},
+		{input: "web+mastodon", want: "web+mastodon"},
+		{input: "ms-teams.v2", want: "ms-teams.v2"},
+		{input: "", wantErr: true},
+		{input: ":", wantErr: true},
+		{input: "1password", wantErr: true},
+		{input: "my app", wantErr: true},
+		{input: "https", wantErr: true},
+		{input: "HTTP:", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := normalizeScheme(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeScheme(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeScheme(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHandlerScheme tests which scheme's apps can open a URL
+func TestHandlerScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://example.com", want: "http"},
+		{url: "http://example.com", want: "http"},
+		{url: "HTTPS://example.com", want: "http"},
+		{url: "example.com", want: "http"},
+		{url: "mailto:user@example.com", want: "mailto"},
+		{url: "MailTo:user@example.com", want: "mailto"},
+		{url: "zoommtg://zoom.us/join?confno=1", want: "zoommtg"},
+		{url: "magnet:?xt=urn:btih:abc", want: "magnet"},
+	}
+
+	for _, tt := range tests {
+		if got := handlerScheme(tt.url); got != tt.want {
+			t.Errorf("handlerScheme(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	got := urlSchemes([]string{"https://a.example", "mailto:a@example.com", "http://b.example", "mailto:b@example.com"})
+	if len(got) != 2 || got[0] != "http" || got[1] != "mailto" {
+		t.Errorf("urlSchemes() = %q, want [http mailto]", got)
+	}
+}
+
+// TestHasOpaqueScheme tests telling schemes like mailto: apart from host:port
+func TestHasOpaqueScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "mailto:user@example.com", want: true},
+		{url: "tel:+15551234", want: true},
+		{url: "magnet:?xt=urn:btih:abc", want: true},
+		{url: "https://example.com", want: false},
+		{url: "example.com", want: false},
+		{url: "localhost:8080", want: false},
+		{url: "example.com:443/path", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := hasOpaqueScheme(tt.url); got != tt.want {
+			t.Errorf("hasOpaqueScheme(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+// TestDesktopFileSchemes tests that the desktop file offers Switchyard for
+// the schemes suggested in settings, so desktops list it as a handler
+func TestDesktopFileSchemes(t *testing.T) {
+	data, err := os.ReadFile("../data/io.github.alyraffauf.Switchyard.desktop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := parseDesktopEntry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mimeTypes := entry.listValue(desktopEntryGroup, "MimeType")
+	for _, scheme := range append([]string{"http", "https"}, suggestedSchemes...) {
+		if !slices.Contains(mimeTypes, schemeMimeType(scheme)) {
+			t.Errorf("MimeType is missing %s", schemeMimeType(scheme))
+		}
+	}
+
+	// Links must be opened by running Exec, so the app that opened them is
+	// Switchyard's parent process, see detectSourceApp
+	if entry.boolValue(desktopEntryGroup, "DBusActivatable") {
+		t.Error("DBusActivatable is set")
+	}
+}
@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	shortLinkTimeout  = 3 * time.Second     // for the whole expansion, across all hops
+	shortLinkMaxHops  = 5                   // redirects followed before giving up
+	shortLinkCacheTTL = 30 * 24 * time.Hour // short links rarely change, but can be reused
+	shortLinkCacheMax = 1000                // entries kept in the cache file
+)
+
+// defaultShortLinkDomains are the shorteners expanded when short link expansion
+// is turned on, until the user edits the list.
+var defaultShortLinkDomains = []string{
+	"bit.ly", "t.co", "lnkd.in", "tinyurl.com", "ow.ly", "buff.ly",
+	"is.gd", "rb.gy", "t.ly", "shorturl.at", "cutt.ly", "trib.al",
+}
+
+// shortLinkResolver expands short links by following their redirects with HEAD
+// requests, falling back to GET for servers that don't support HEAD. Redirects
+// are only followed while they stay on a shortener domain, so the final
+// destination itself is never contacted.
+type shortLinkResolver struct {
+	domains   []string
+	client    *http.Client
+	timeout   time.Duration
+	maxHops   int
+	cachePath string // empty disables the cache
+}
+
+// shortLinkCacheEntry is a resolved short link in the on-disk cache.
+type shortLinkCacheEntry struct {
+	Target   string    `json:"target"`
+	Resolved time.Time `json:"resolved"`
+}
+
+// shortLinkCacheMu serializes access to the cache file within this process.
+var shortLinkCacheMu sync.Mutex
+
+func newShortLinkResolver(domains []string) *shortLinkResolver {
+	return &shortLinkResolver{
+		domains: domains,
+		client: &http.Client{
+			// Redirects are followed by hand, one hop at a time
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		timeout:   shortLinkTimeout,
+		maxHops:   shortLinkMaxHops,
+		cachePath: shortLinkCachePath(),
+	}
+}
+
+// shortLinkCachePath returns where resolved short links are cached.
+func shortLinkCachePath() string {
+	return filepath.Join(cacheDir(), "short-links.json")
+}
+
+// expandShortLink expands the URL if it's a short link and expansion is turned on.
+// If expansion fails or times out, the original URL is returned.
+func (cfg *Config) expandShortLink(rawURL string) string {
+	if !cfg.ExpandShortLinks {
+		return rawURL
+	}
+	target, err := newShortLinkResolver(cfg.ShortLinkDomains).expand(rawURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to expand short link %s: %v\n", rawURL, err)
+		return rawURL
+	}
+	return target
+}
+
+// isShortLink reports whether the URL is on one of the resolver's shortener domains.
+func (r *shortLinkResolver) isShortLink(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := u.Hostname()
+	for _, domain := range r.domains {
+		if domain != "" && matchDomainSuffix(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand follows the redirects of a short link and returns its destination.
+// URLs that aren't short links are returned unchanged.
+func (r *shortLinkResolver) expand(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !r.isShortLink(u) {
+		return rawURL, nil
+	}
+
+	if target, ok := r.cached(rawURL); ok {
+		return target, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	current := u
+	for hop := 0; ; hop++ {
+		if !r.isShortLink(current) {
+			break
+		}
+		if hop == r.maxHops {
+			return "", fmt.Errorf("more than %d redirects", r.maxHops)
+		}
+
+		next, err := r.nextHop(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if next == nil {
+			break // not a redirect, this is the destination
+		}
+		current = next
+	}
+
+	target := current.String()
+	r.store(rawURL, target)
+	return target, nil
+}
+
+// nextHop requests u and returns where it redirects to, or nil if it doesn't.
+func (r *shortLinkResolver) nextHop(ctx context.Context, u *url.URL) (*url.URL, error) {
+	resp, err := r.request(ctx, http.MethodHead, u)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		// Some shorteners only answer GET
+		resp, err = r.request(ctx, http.MethodGet, u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return nil, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, fmt.Errorf("redirect without a location from %s", u.Host)
+	}
+	next, err := u.Parse(location) // resolves relative redirects
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect from %s: %w", u.Host, err)
+	}
+	return next, nil
+}
+
+// request sends a single request without reading the response body.
+func (r *shortLinkResolver) request(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// cached returns the cached destination of a short link, if it hasn't expired.
+func (r *shortLinkResolver) cached(shortURL string) (string, bool) {
+	if r.cachePath == "" {
+		return "", false
+	}
+	shortLinkCacheMu.Lock()
+	defer shortLinkCacheMu.Unlock()
+
+	entry, ok := readShortLinkCache(r.cachePath)[shortURL]
+	if !ok || clock().Sub(entry.Resolved) > shortLinkCacheTTL {
+		return "", false
+	}
+	return entry.Target, true
+}
+
+// store saves a resolved short link to the cache, dropping the oldest entries
+// once the cache is full. Failing to write the cache isn't an error.
+func (r *shortLinkResolver) store(shortURL, target string) {
+	if r.cachePath == "" {
+		return
+	}
+	shortLinkCacheMu.Lock()
+	defer shortLinkCacheMu.Unlock()
+
+	cache := readShortLinkCache(r.cachePath)
+	cache[shortURL] = shortLinkCacheEntry{Target: target, Resolved: clock()}
+
+	if len(cache) > shortLinkCacheMax {
+		keys := make([]string, 0, len(cache))
+		for k := range cache {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return cache[keys[i]].Resolved.Before(cache[keys[j]].Resolved)
+		})
+		for _, k := range keys[:len(cache)-shortLinkCacheMax] {
+			delete(cache, k)
+		}
+	}
+
+	if err := writeShortLinkCache(r.cachePath, cache); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write short link cache: %v\n", err)
+	}
+}
+
+// readShortLinkCache reads the cache file. A missing or corrupt cache is empty.
+func readShortLinkCache(path string) map[string]shortLinkCacheEntry {
+	cache := make(map[string]shortLinkCacheEntry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return make(map[string]shortLinkCacheEntry)
+	}
+	return cache
+}
+
+// writeShortLinkCache replaces the cache file atomically, so concurrent
+// Switchyard processes never read a partial file.
+func writeShortLinkCache(path string, cache map[string]shortLinkCacheEntry) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".short-links-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// clearShortLinkCache deletes all cached short links.
+func clearShortLinkCache() error {
+	shortLinkCacheMu.Lock()
+	defer shortLinkCacheMu.Unlock()
+	if err := os.Remove(shortLinkCachePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// parseDomainList splits a comma- or space-separated list of domains.
+func parseDomainList(s string) []string {
+	var domains []string
+	for _, d := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		domains = append(domains, strings.ToLower(strings.TrimPrefix(d, ".")))
+	}
+	return domains
+}
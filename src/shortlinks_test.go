@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shortener is a fake link shortener that records the requests it receives
+type shortener struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string // "METHOD /path"
+}
+
+func newShortener(t *testing.T, handler http.HandlerFunc) *shortener {
+	t.Helper()
+	s := &shortener{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *shortener) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *shortener) requestCount() int {
+	return len(s.received())
+}
+
+// testResolver returns a resolver that treats the test server as a shortener
+// and caches into a temporary directory
+func testResolver(t *testing.T) *shortLinkResolver {
+	t.Helper()
+	r := newShortLinkResolver([]string{"127.0.0.1"})
+	r.cachePath = filepath.Join(t.TempDir(), "short-links.json")
+	return r
+}
+
+func redirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// TestShortLinkResolver_Expand tests following redirects from a shortener
+func TestShortLinkResolver_Expand(t *testing.T) {
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chain":
+			redirect(w, "/hop") // relative redirects stay on the shortener
+		case "/hop":
+			redirect(w, "https://example.com/final?id=1")
+		case "/head-not-allowed":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			redirect(w, "https://example.com/from-get")
+		case "/not-a-redirect":
+			w.WriteHeader(http.StatusOK)
+		case "/loop":
+			redirect(w, "/loop")
+		case "/no-location":
+			w.WriteHeader(http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{name: "redirect chain", url: srv.URL + "/chain", want: "https://example.com/final?id=1"},
+		{name: "GET fallback", url: srv.URL + "/head-not-allowed", want: "https://example.com/from-get"},
+		{name: "not a redirect", url: srv.URL + "/not-a-redirect", want: srv.URL + "/not-a-redirect"},
+		{name: "redirect loop", url: srv.URL + "/loop", wantErr: true},
+		{name: "redirect without location", url: srv.URL + "/no-location", wantErr: true},
+		{name: "not a shortener", url: "https://example.com/page", want: "https://example.com/page"},
+		{name: "not http", url: "mailto:someone@127.0.0.1", want: "mailto:someone@127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testResolver(t).expand(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expand(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestShortLinkResolver_HeadFirst tests that HEAD is tried before GET
+func TestShortLinkResolver_HeadFirst(t *testing.T) {
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		redirect(w, "https://example.com/")
+	})
+
+	if _, err := testResolver(t).expand(srv.URL + "/x"); err != nil {
+		t.Fatalf("expand() error = %v", err)
+	}
+	if got := srv.received(); len(got) != 1 || got[0] != "HEAD /x" {
+		t.Errorf("requests = %v, want [HEAD /x]", got)
+	}
+}
+
+// TestShortLinkResolver_HopLimit tests that long redirect chains are abandoned
+func TestShortLinkResolver_HopLimit(t *testing.T) {
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		redirect(w, "/next")
+	})
+
+	r := testResolver(t)
+	r.maxHops = 3
+	if _, err := r.expand(srv.URL + "/start"); err == nil {
+		t.Fatal("expected an error when exceeding the hop limit")
+	}
+	if n := srv.requestCount(); n != 3 {
+		t.Errorf("followed %d redirects, want 3", n)
+	}
+}
+
+// TestShortLinkResolver_Timeout tests that slow shorteners are abandoned
+func TestShortLinkResolver_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		redirect(w, "https://example.com/")
+	})
+	defer close(release) // before srv.Close, which waits for the handler
+
+	r := testResolver(t)
+	r.timeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := r.expand(srv.URL + "/slow"); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expand() took %v, want it to give up after the timeout", elapsed)
+	}
+}
+
+// TestShortLinkResolver_Cache tests that resolved links are cached on disk
+func TestShortLinkResolver_Cache(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	setClock(t, now)
+
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		redirect(w, "https://example.com/cached")
+	})
+
+	r := testResolver(t)
+	for i := 0; i < 2; i++ {
+		got, err := r.expand(srv.URL + "/abc")
+		if err != nil || got != "https://example.com/cached" {
+			t.Fatalf("expand() = %q, %v", got, err)
+		}
+	}
+	if n := srv.requestCount(); n != 1 {
+		t.Errorf("server received %d requests, want 1", n)
+	}
+
+	// A new resolver reads the same cache file
+	other := newShortLinkResolver([]string{"127.0.0.1"})
+	other.cachePath = r.cachePath
+	if got, _ := other.expand(srv.URL + "/abc"); got != "https://example.com/cached" || srv.requestCount() != 1 {
+		t.Errorf("cache not shared between resolvers: got %q after %d requests", got, srv.requestCount())
+	}
+
+	// Expired entries are resolved again
+	setClock(t, now.Add(shortLinkCacheTTL+time.Hour))
+	if _, err := r.expand(srv.URL + "/abc"); err != nil {
+		t.Fatalf("expand() error = %v", err)
+	}
+	if n := srv.requestCount(); n != 2 {
+		t.Errorf("server received %d requests after expiry, want 2", n)
+	}
+}
+
+// TestShortLinkResolver_FailuresNotCached tests that errors aren't cached
+func TestShortLinkResolver_FailuresNotCached(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusFound) // no Location
+			return
+		}
+		redirect(w, "https://example.com/")
+	})
+
+	r := testResolver(t)
+	if _, err := r.expand(srv.URL + "/x"); err == nil {
+		t.Fatal("expected an error")
+	}
+	fail.Store(false)
+	if got, err := r.expand(srv.URL + "/x"); err != nil || got != "https://example.com/" {
+		t.Errorf("expand() = %q, %v after the shortener recovered", got, err)
+	}
+}
+
+// TestConfigExpandShortLink tests the opt-in and the fallback to the original URL
+func TestConfigExpandShortLink(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	srv := newShortener(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		redirect(w, "https://example.com/expanded")
+	})
+
+	cfg := &Config{ShortLinkDomains: []string{"127.0.0.1"}}
+	if got := cfg.expandShortLink(srv.URL + "/ok"); got != srv.URL+"/ok" {
+		t.Errorf("expanded %q while disabled", got)
+	}
+	if n := srv.requestCount(); n != 0 {
+		t.Errorf("server received %d requests while disabled", n)
+	}
+
+	cfg.ExpandShortLinks = true
+	if got := cfg.expandShortLink(srv.URL + "/ok"); got != "https://example.com/expanded" {
+		t.Errorf("expandShortLink() = %q", got)
+	}
+	if got := cfg.expandShortLink(srv.URL + "/broken"); got != srv.URL+"/broken" {
+		t.Errorf("expandShortLink() = %q, want the original URL on failure", got)
+	}
+}
+
+// TestParseDomainList tests splitting the shortener domains setting
+func TestParseDomainList(t *testing.T) {
+	got := parseDomainList(" bit.ly, T.co ,,.go.example  lnkd.in")
+	want := []string{"bit.ly", "t.co", "go.example", "lnkd.in"}
+	if len(got) != len(want) {
+		t.Fatalf("parseDomainList() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseDomainList()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
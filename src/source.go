@@ -0,0 +1,266 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot is where process information is read from. Tests point it at a fake tree.
+var procRoot = "/proc"
+
+// maxSourceDepth limits how far up the process tree detectSourceApp walks.
+const maxSourceDepth = 16
+
+// sourceHintPrefix marks the open hint used to forward the source app to an
+// already running instance.
+const sourceHintPrefix = "switchyard-source:"
+
+// sourceApp describes the application that asked Switchyard to open a URL.
+type sourceApp struct {
+	Exe       string `json:"exe,omitempty"`        // executable name, e.g. "thunderbird"
+	DesktopID string `json:"desktop_id,omitempty"` // desktop file ID without ".desktop"
+	FlatpakID string `json:"flatpak_id,omitempty"`
+	Terminal  bool   `json:"terminal,omitempty"` // opened from a shell in a terminal
+}
+
+// wrapperProcesses are launchers and shells between the real source app and
+// Switchyard. They are skipped while walking up the process tree.
+var wrapperProcesses = map[string]bool{
+	"xdg-open": true, "gio": true, "gio-launch-desktop": true, "gvfs-open": true,
+	"gnome-open": true, "kde-open": true, "kde-open5": true, "kde-open6": true,
+	"exo-open": true, "sensible-browser": true, "x-www-browser": true, "www-browser": true,
+	"flatpak-spawn": true, "env": true, "sudo": true, "nohup": true, "setsid": true,
+	"sh": true, "bash": true, "dash": true, "zsh": true, "fish": true, "ksh": true,
+	"tcsh": true, "csh": true, "nu": true, "xonsh": true,
+	"switchyard": true,
+}
+
+// sessionProcesses end the walk: past them, the URL wasn't opened by an app the
+// user would recognise, e.g. D-Bus activation, the desktop portal or a
+// terminal multiplexer.
+var sessionProcesses = map[string]bool{
+	"systemd": true, "init": true, "dbus-daemon": true, "dbus-broker": true,
+	"xdg-desktop-portal": true, "bwrap": true, "flatpak-portal": true,
+	"tmux": true, "screen": true, "zellij": true, "sshd": true,
+}
+
+// terminalEmulators are matched by "terminal" source_app conditions even when
+// they open a link themselves, e.g. with Ctrl+click.
+var terminalEmulators = map[string]bool{
+	"gnome-terminal-server": true, "kgx": true, "ptyxis": true, "ptyxis-agent": true,
+	"konsole": true, "xfce4-terminal": true, "mate-terminal": true, "lxterminal": true,
+	"qterminal": true, "tilix": true, "terminator": true, "blackbox": true,
+	"alacritty": true, "kitty": true, "foot": true, "wezterm-gui": true, "ghostty": true,
+	"xterm": true, "urxvt": true, "st": true,
+}
+
+// interpreters run scripts. Their executable says nothing about the app, so
+// the command name, which the kernel takes from the script, is used instead.
+var interpreters = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "fish": true,
+	"python": true, "perl": true, "ruby": true, "node": true, "gjs": true, "java": true,
+}
+
+// procInfo is what detectSourceApp needs to know about a single process.
+type procInfo struct {
+	ppid int
+	comm string
+	exe  string // basename of the executable, may be empty without permission
+	tty  bool   // has a controlling terminal
+}
+
+// detectSourceApp walks up the process tree from pid, skipping launchers such
+// as xdg-open and shells, and returns the first real application it finds.
+// It returns nil when the source can't be determined.
+func detectSourceApp(pid int) *sourceApp {
+	terminal := false
+	for depth := 0; depth < maxSourceDepth && pid > 1; depth++ {
+		info, ok := readProcInfo(pid)
+		if !ok {
+			break
+		}
+		name := info.name()
+
+		if sessionProcesses[name] {
+			break
+		}
+		if wrapperProcesses[name] {
+			// A launcher or shell with a terminal means the link was opened from the command line
+			terminal = terminal || info.tty
+			pid = info.ppid
+			continue
+		}
+
+		src := &sourceApp{Exe: name, Terminal: terminal || terminalEmulators[name]}
+		env := readProcEnviron(pid)
+		src.FlatpakID = env["FLATPAK_ID"]
+		if src.FlatpakID == "" {
+			src.FlatpakID = readFlatpakAppID(pid)
+		}
+		if desktop := env["GIO_LAUNCHED_DESKTOP_FILE"]; desktop != "" {
+			src.DesktopID = strings.TrimSuffix(filepath.Base(desktop), ".desktop")
+		} else if desktop := env["BAMF_DESKTOP_FILE_HINT"]; desktop != "" {
+			src.DesktopID = strings.TrimSuffix(filepath.Base(desktop), ".desktop")
+		}
+		return src
+	}
+
+	if terminal {
+		return &sourceApp{Terminal: true}
+	}
+	return nil
+}
+
+// name returns the process's executable name, or its command name for scripts
+// and when the executable can't be read.
+func (p procInfo) name() string {
+	if p.exe == "" || interpreters[strings.TrimRight(p.exe, "0123456789.")] {
+		return p.comm
+	}
+	return p.exe
+}
+
+// readProcInfo reads the parent, command name, executable and terminal of a process.
+func readProcInfo(pid int) (procInfo, bool) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return procInfo{}, false
+	}
+
+	// The command name is in parentheses and may itself contain spaces and
+	// parentheses, so split on the last closing one:
+	// "pid (comm) state ppid pgrp session tty_nr ..."
+	stat := string(data)
+	open := strings.IndexByte(stat, '(')
+	closing := strings.LastIndexByte(stat, ')')
+	if open == -1 || closing < open {
+		return procInfo{}, false
+	}
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 5 {
+		return procInfo{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procInfo{}, false
+	}
+
+	info := procInfo{
+		ppid: ppid,
+		comm: stat[open+1 : closing],
+		tty:  fields[4] != "0",
+	}
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		info.exe = path.Base(strings.TrimSuffix(exe, " (deleted)"))
+	}
+	return info, true
+}
+
+// readProcEnviron reads the environment of a process. It's empty when the
+// process belongs to another user.
+func readProcEnviron(pid int) map[string]string {
+	env := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return env
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if key, value, ok := strings.Cut(string(entry), "="); ok {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// readFlatpakAppID reads the app ID from a sandboxed process's .flatpak-info file.
+func readFlatpakAppID(pid int) string {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(pid), "root", ".flatpak-info"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && section == "[Application]" && strings.TrimSpace(key) == "name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// matches reports whether the pattern names this source: its executable, desktop
+// file ID (with or without ".desktop"), Flatpak app ID, or "terminal".
+// Patterns are case-insensitive and may contain * and ? wildcards.
+func (s *sourceApp) matches(pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, ".desktop"))
+	if pattern == "terminal" {
+		return s.Terminal
+	}
+	for _, id := range []string{s.Exe, s.DesktopID, s.FlatpakID} {
+		if id == "" {
+			continue
+		}
+		if matched, _ := path.Match(pattern, strings.ToLower(id)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionPattern returns the most specific identifier for the source, for
+// creating source_app conditions from it.
+func (s *sourceApp) conditionPattern() string {
+	switch {
+	case s.Terminal:
+		return "terminal"
+	case s.FlatpakID != "":
+		return s.FlatpakID
+	case s.DesktopID != "":
+		return s.DesktopID
+	default:
+		return s.Exe
+	}
+}
+
+// encodeSourceHint encodes the source app as an open hint for the primary instance.
+// A nil source is encoded too, so the primary doesn't fall back to its own parent.
+func encodeSourceHint(s *sourceApp) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return sourceHintPrefix + string(data)
+}
+
+// decodeSourceHint decodes a source app forwarded with encodeSourceHint.
+// ok is false if the hint doesn't carry a source.
+func decodeSourceHint(hint string) (src *sourceApp, ok bool) {
+	data, found := strings.CutPrefix(hint, sourceHintPrefix)
+	if !found {
+		return nil, false
+	}
+	if data == "" || data == "null" {
+		return nil, true
+	}
+	src = &sourceApp{}
+	if err := json.Unmarshal([]byte(data), src); err != nil {
+		return nil, true
+	}
+	return src, true
+}
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProc describes a process in a fake /proc tree
+type fakeProc struct {
+	pid     int
+	ppid    int
+	comm    string
+	exe     string // full executable path, empty if unreadable
+	tty     bool
+	environ []string
+	flatpak string // app ID written to root/.flatpak-info
+}
+
+// setProcRoot builds a fake /proc tree and points procRoot at it for the rest of the test
+func setProcRoot(t *testing.T, procs []fakeProc) {
+	t.Helper()
+	root := t.TempDir()
+	for _, p := range procs {
+		dir := filepath.Join(root, strconv.Itoa(p.pid))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		tty := "0"
+		if p.tty {
+			tty = "34816"
+		}
+		stat := strconv.Itoa(p.pid) + " (" + p.comm + ") S " + strconv.Itoa(p.ppid) + " 1 1 " + tty + " -1 4194560"
+		writeTestFile(t, filepath.Join(dir, "stat"), stat)
+		writeTestFile(t, filepath.Join(dir, "environ"), strings.Join(p.environ, "\x00"))
+		if p.exe != "" {
+			if err := os.Symlink(p.exe, filepath.Join(dir, "exe")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p.flatpak != "" {
+			os.MkdirAll(filepath.Join(dir, "root"), 0755)
+			writeTestFile(t, filepath.Join(dir, "root", ".flatpak-info"), "[Application]\nname="+p.flatpak+"\nruntime=runtime/org.gnome.Platform\n")
+		}
+	}
+
+	orig := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = orig })
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDetectSourceApp tests walking up fake process trees to find the source app
+func TestDetectSourceApp(t *testing.T) {
+	systemd := fakeProc{pid: 2, ppid: 1, comm: "systemd", exe: "/usr/lib/systemd/systemd"}
+
+	tests := []struct {
+		name  string
+		procs []fakeProc
+		start int
+		want  *sourceApp
+	}{
+		{
+			name: "direct child of app",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "thunderbird", exe: "/usr/lib64/thunderbird/thunderbird",
+					environ: []string{"GIO_LAUNCHED_DESKTOP_FILE=/usr/share/applications/org.mozilla.Thunderbird.desktop"}},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "thunderbird", DesktopID: "org.mozilla.Thunderbird"},
+		},
+		{
+			name: "through xdg-open script",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "slack", exe: "/usr/lib/slack/slack"},
+				{pid: 200, ppid: 100, comm: "xdg-open", exe: "/usr/bin/dash"},
+			},
+			start: 200,
+			want:  &sourceApp{Exe: "slack"},
+		},
+		{
+			name: "flatpak app through flatpak-spawn",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "bwrap", exe: "/usr/bin/bwrap"},
+				{pid: 110, ppid: 100, comm: "Discord", exe: "/app/discord/Discord",
+					environ: []string{"FLATPAK_ID=com.discordapp.Discord"}},
+				{pid: 120, ppid: 110, comm: "flatpak-spawn", exe: "/usr/bin/flatpak-spawn"},
+			},
+			start: 120,
+			want:  &sourceApp{Exe: "Discord", FlatpakID: "com.discordapp.Discord"},
+		},
+		{
+			name: "flatpak info when environment is unreadable",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "signal-desktop", exe: "/app/Signal/signal-desktop", flatpak: "org.signal.Signal"},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "signal-desktop", FlatpakID: "org.signal.Signal"},
+		},
+		{
+			name: "terminal shell",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "gnome-terminal-", exe: "/usr/libexec/gnome-terminal-server"},
+				{pid: 110, ppid: 100, comm: "bash", exe: "/usr/bin/bash", tty: true},
+				{pid: 120, ppid: 110, comm: "xdg-open", exe: "/usr/bin/bash", tty: true},
+			},
+			start: 120,
+			want:  &sourceApp{Exe: "gnome-terminal-server", Terminal: true},
+		},
+		{
+			name: "terminal inside tmux",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "tmux: server", exe: "/usr/bin/tmux"},
+				{pid: 110, ppid: 100, comm: "zsh", exe: "/usr/bin/zsh", tty: true},
+			},
+			start: 110,
+			want:  &sourceApp{Terminal: true},
+		},
+		{
+			name: "terminal emulator opening a link itself",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "kitty", exe: "/usr/bin/kitty"},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "kitty", Terminal: true},
+		},
+		{
+			name: "python script uses command name",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "my-notes", exe: "/usr/bin/python3.12"},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "my-notes"},
+		},
+		{
+			name: "unreadable executable uses command name",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "element-desktop"},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "element-desktop"},
+		},
+		{
+			name: "command name with spaces and parentheses",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "Web Content (x)"},
+			},
+			start: 100,
+			want:  &sourceApp{Exe: "Web Content (x)"},
+		},
+		{
+			name: "activated through D-Bus",
+			procs: []fakeProc{
+				systemd,
+				{pid: 100, ppid: 2, comm: "dbus-broker", exe: "/usr/bin/dbus-broker"},
+			},
+			start: 100,
+			want:  nil,
+		},
+		{
+			name:  "missing process",
+			procs: []fakeProc{systemd},
+			start: 999,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setProcRoot(t, tt.procs)
+			got := detectSourceApp(tt.start)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("detectSourceApp() = %+v, want %+v", got, tt.want)
+			}
+			if got != nil && *got != *tt.want {
+				t.Errorf("detectSourceApp() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+// TestDetectSourceApp_Loop tests that a corrupt process tree doesn't walk forever
+func TestDetectSourceApp_Loop(t *testing.T) {
+	setProcRoot(t, []fakeProc{
+		{pid: 100, ppid: 200, comm: "sh", exe: "/usr/bin/sh"},
+		{pid: 200, ppid: 100, comm: "sh", exe: "/usr/bin/sh"},
+	})
+	if got := detectSourceApp(100); got != nil {
+		t.Errorf("detectSourceApp() = %+v, want nil", got)
+	}
+}
+
+// TestSourceAppMatches tests matching source_app patterns against a source
+func TestSourceAppMatches(t *testing.T) {
+	src := &sourceApp{Exe: "thunderbird", DesktopID: "org.mozilla.Thunderbird", FlatpakID: "org.mozilla.Thunderbird"}
+	term := &sourceApp{Exe: "gnome-terminal-server", Terminal: true}
+
+	tests := []struct {
+		name    string
+		source  *sourceApp
+		pattern string
+		want    bool
+	}{
+		{name: "executable", source: src, pattern: "thunderbird", want: true},
+		{name: "desktop ID", source: src, pattern: "org.mozilla.Thunderbird", want: true},
+		{name: "desktop file name", source: src, pattern: "org.mozilla.Thunderbird.desktop", want: true},
+		{name: "case insensitive", source: src, pattern: "ORG.MOZILLA.THUNDERBIRD", want: true},
+		{name: "wildcard", source: src, pattern: "org.mozilla.*", want: true},
+		{name: "other app", source: src, pattern: "slack", want: false},
+		{name: "not a terminal", source: src, pattern: "terminal", want: false},
+		{name: "terminal", source: term, pattern: "terminal", want: true},
+		{name: "terminal emulator by name", source: term, pattern: "gnome-terminal-server", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.source.matches(tt.pattern); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSourceHint tests forwarding the source app to a running instance
+func TestSourceHint(t *testing.T) {
+	src := &sourceApp{Exe: "slack", Terminal: false}
+	got, ok := decodeSourceHint(encodeSourceHint(src))
+	if !ok || got == nil || *got != *src {
+		t.Errorf("round trip = %+v, %v, want %+v", got, ok, src)
+	}
+
+	got, ok = decodeSourceHint(encodeSourceHint(nil))
+	if !ok || got != nil {
+		t.Errorf("nil round trip = %+v, %v, want nil, true", got, ok)
+	}
+
+	if _, ok := decodeSourceHint(""); ok {
+		t.Error("expected empty hint not to carry a source")
+	}
+}
+
+// TestConfigMatchRuleFrom_SourceApp tests routing by the app that opened the link
+func TestConfigMatchRuleFrom_SourceApp(t *testing.T) {
+	cfg := &Config{
+		Rules: []Rule{
+			{
+				Name:       "From Slack",
+				Browser:    "work.desktop",
+				Conditions: []Condition{{Type: "source_app", Pattern: "slack"}},
+			},
+			{
+				Name:       "From terminal",
+				Browser:    "dev.desktop",
+				Conditions: []Condition{{Type: "source_app", Pattern: "terminal"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		source *sourceApp
+		want   string
+	}{
+		{name: "slack", source: &sourceApp{Exe: "slack"}, want: "work.desktop"},
+		{name: "terminal", source: &sourceApp{Exe: "kgx", Terminal: true}, want: "dev.desktop"},
+		{name: "other app", source: &sourceApp{Exe: "thunderbird"}, want: ""},
+		{name: "unknown source", source: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _ := cfg.matchRuleFrom("https://example.com", tt.source)
+			if got != tt.want {
+				t.Errorf("matchRuleFrom() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
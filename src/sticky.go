@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStickyMinutes = 30 // minutes a sticky choice lasts, unless sticky_minutes is set
+
+// stickyChoice is a browser chosen in the picker for a domain whose links an
+// always ask rule sends there, used instead of asking again until it expires.
+type stickyChoice struct {
+	Browser string    `json:"browser"`
+	Expires time.Time `json:"expires,omitzero"`  // zero for choices that last the session
+	Session string    `json:"session,omitempty"` // login session a choice without expiry lasts for
+}
+
+// stickyMu serializes access to the sticky choices file within this process.
+var stickyMu sync.Mutex
+
+// stickyPath returns where sticky choices are kept.
+func stickyPath() string {
+	return filepath.Join(stateDir(), "sticky.json")
+}
+
+// loginSession identifies the current login session, so choices made "for
+// this session" end at logout or reboot. Tests replace it.
+var loginSession = func() string {
+	boot, _ := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	return strings.TrimSpace(string(boot)) + "/" + sessionID()
+}
+
+// unsetAuditSession is the audit session ID of processes outside of any
+// session, (uint32)-1.
+const unsetAuditSession = "4294967295"
+
+// sessionID returns the ID of the login session Switchyard runs in. Started
+// over D-Bus or by a systemd user service, it's outside of the session, with
+// neither XDG_SESSION_ID nor an audit session, so it's the user's graphical
+// session then.
+func sessionID() string {
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		return id
+	}
+	// logind uses the audit session ID as the session's ID where there is one
+	audit, err := os.ReadFile(filepath.Join(procRoot, "self", "sessionid"))
+	if id := strings.TrimSpace(string(audit)); err == nil && id != "" && id != unsetAuditSession {
+		return id
+	}
+	return displaySession()
+}
+
+// active reports whether the choice still applies.
+func (c stickyChoice) active(now time.Time, session string) bool {
+	if c.Expires.IsZero() {
+		return c.Session != "" && c.Session == session
+	}
+	return now.Before(c.Expires)
+}
+
+// describe says how long the choice lasts, e.g. "until 14:33" or "for this
+// session". Choices lasting beyond a day include the date.
+func (c stickyChoice) describe() string {
+	switch {
+	case c.Expires.IsZero():
+		return "for this session"
+	case c.Expires.Sub(clock()) >= 24*time.Hour:
+		return "until " + c.Expires.Local().Format("Jan 2, 15:04")
+	default:
+		return "until " + c.Expires.Local().Format("15:04")
+	}
+}
+
+// newStickyChoice returns a choice of browserID lasting minutes, or the
+// session if minutes is 0.
+func newStickyChoice(browserID string, minutes int) stickyChoice {
+	if minutes <= 0 {
+		return stickyChoice{Browser: browserID, Session: loginSession()}
+	}
+	return stickyChoice{Browser: browserID, Expires: clock().Add(time.Duration(minutes) * time.Minute)}
+}
+
+// stickyDomains returns the domains of URLs an always ask rule sends to the
+// picker, which a sticky choice can be made for.
+func (cfg *Config) stickyDomains(urls []string, source *sourceApp) []string {
+	var domains []string
+	for i, rule := range cfg.pickerRules(urls, source) {
+		domain := strings.ToLower(extractDomain(urls[i]))
+		if rule > 0 && domain != "" && !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// stickyBrowser returns the browser chosen for a domain, if the choice is
+// still active. cfg.sticky is only loaded where links are routed.
+func (cfg *Config) stickyBrowser(domain string) (stickyChoice, bool) {
+	choice, ok := cfg.sticky[domain]
+	if !ok || !choice.active(clock(), loginSession()) {
+		return stickyChoice{}, false
+	}
+	return choice, true
+}
+
+// loadStickyChoices returns the active sticky choices by domain, removing
+// expired ones from the file.
+func loadStickyChoices() map[string]stickyChoice {
+	stickyMu.Lock()
+	defer stickyMu.Unlock()
+
+	path := stickyPath()
+	choices := readStickyChoices(path)
+	if pruneStickyChoices(choices) {
+		if err := writeStickyChoices(path, choices); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to write sticky choices: %v\n", err)
+		}
+	}
+	return choices
+}
+
+// pruneStickyChoices removes inactive choices, reporting whether any were.
+func pruneStickyChoices(choices map[string]stickyChoice) bool {
+	now, session := clock(), loginSession()
+	pruned := false
+	for domain, c := range choices {
+		if !c.active(now, session) {
+			delete(choices, domain)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// addStickyChoices saves choice for each of domains, replacing earlier ones.
+func addStickyChoices(domains []string, choice stickyChoice) error {
+	stickyMu.Lock()
+	defer stickyMu.Unlock()
+
+	path := stickyPath()
+	choices := readStickyChoices(path)
+	pruneStickyChoices(choices)
+	for _, domain := range domains {
+		choices[domain] = choice
+	}
+	return writeStickyChoices(path, choices)
+}
+
+// clearStickyChoices removes the choices for domains, or all of them if none
+// are given. It returns how many were removed.
+func clearStickyChoices(domains ...string) (int, error) {
+	stickyMu.Lock()
+	defer stickyMu.Unlock()
+
+	path := stickyPath()
+	choices := readStickyChoices(path)
+	pruneStickyChoices(choices)
+	before := len(choices)
+	if len(domains) == 0 {
+		clear(choices)
+	}
+	for _, domain := range domains {
+		delete(choices, strings.ToLower(domain))
+	}
+	if err := writeStickyChoices(path, choices); err != nil {
+		return 0, err
+	}
+	return before - len(choices), nil
+}
+
+// sortedStickyDomains returns the domains of choices in alphabetical order.
+func sortedStickyDomains(choices map[string]stickyChoice) []string {
+	domains := make([]string, 0, len(choices))
+	for domain := range choices {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// readStickyChoices reads the sticky choices file. A missing or corrupt file
+// has no choices.
+func readStickyChoices(path string) map[string]stickyChoice {
+	choices := make(map[string]stickyChoice)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return choices
+	}
+	if err := json.Unmarshal(data, &choices); err != nil {
+		return make(map[string]stickyChoice)
+	}
+	return choices
+}
+
+// writeStickyChoices replaces the sticky choices file atomically, so
+// concurrent Switchyard processes never read a partial file. Without any
+// choices left, the file is removed.
+func writeStickyChoices(path string, choices map[string]stickyChoice) error {
+	if len(choices) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(choices)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sticky-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
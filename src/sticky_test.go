@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setLoginSession replaces the login session for the duration of a test
+func setLoginSession(t *testing.T, session string) {
+	t.Helper()
+	orig := loginSession
+	loginSession = func() string { return session }
+	t.Cleanup(func() { loginSession = orig })
+}
+
+// TestSessionID tests finding the login session without XDG_SESSION_ID, as
+// when Switchyard is started over D-Bus
+func TestSessionID(t *testing.T) {
+	origDisplay := displaySession
+	displaySession = func() string { return "3" }
+	t.Cleanup(func() { displaySession = origDisplay })
+
+	tests := []struct {
+		name  string
+		env   string
+		audit string // contents of /proc/self/sessionid, none if empty
+		want  string
+	}{
+		{name: "environment", env: "2", audit: "5", want: "2"},
+		{name: "audit session", audit: "5\n", want: "5"},
+		{name: "unset audit session", audit: unsetAuditSession, want: "3"},
+		{name: "no audit session", want: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_SESSION_ID", tt.env)
+			setProcRoot(t, nil)
+			if tt.audit != "" {
+				os.MkdirAll(filepath.Join(procRoot, "self"), 0755)
+				writeTestFile(t, filepath.Join(procRoot, "self", "sessionid"), tt.audit)
+			}
+			if got := sessionID(); got != tt.want {
+				t.Errorf("sessionID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStickyChoices tests saving, expiring and clearing sticky choices
+func TestStickyChoices(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	start := time.Date(2026, 10, 17, 14, 0, 0, 0, time.UTC)
+	setClock(t, start)
+	setLoginSession(t, "boot/2")
+
+	if err := addStickyChoices([]string{"a.example", "b.example"}, newStickyChoice("firefox.desktop", 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := addStickyChoices([]string{"c.example"}, newStickyChoice("chromium.desktop", 0)); err != nil {
+		t.Fatal(err)
+	}
+	// A later choice for the same domain replaces the earlier one
+	setClock(t, start.Add(20*time.Minute))
+	if err := addStickyChoices([]string{"b.example"}, newStickyChoice("epiphany.desktop", 30)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]stickyChoice{
+		"a.example": {Browser: "firefox.desktop", Expires: start.Add(30 * time.Minute)},
+		"b.example": {Browser: "epiphany.desktop", Expires: start.Add(50 * time.Minute)},
+		"c.example": {Browser: "chromium.desktop", Session: "boot/2"},
+	}
+	if got := loadStickyChoices(); !stickyChoicesEqual(got, want) {
+		t.Errorf("loadStickyChoices() = %+v, want %+v", got, want)
+	}
+
+	// Expired choices are removed from the file
+	setClock(t, start.Add(40*time.Minute))
+	delete(want, "a.example")
+	if got := loadStickyChoices(); !stickyChoicesEqual(got, want) {
+		t.Errorf("loadStickyChoices() after 40 minutes = %+v, want %+v", got, want)
+	}
+	if got := readStickyChoices(stickyPath()); !stickyChoicesEqual(got, want) {
+		t.Errorf("file after 40 minutes = %+v, want %+v", got, want)
+	}
+
+	// Session choices end with the session
+	setLoginSession(t, "boot/3")
+	delete(want, "c.example")
+	if got := loadStickyChoices(); !stickyChoicesEqual(got, want) {
+		t.Errorf("loadStickyChoices() in a new session = %+v, want %+v", got, want)
+	}
+
+	if removed, err := clearStickyChoices("B.example", "missing.example"); err != nil || removed != 1 {
+		t.Errorf("clearStickyChoices() = %d, %v, want 1", removed, err)
+	}
+	if _, err := os.Stat(stickyPath()); !os.IsNotExist(err) {
+		t.Errorf("sticky file kept without any choices: %v", err)
+	}
+	if removed, err := clearStickyChoices(); err != nil || removed != 0 {
+		t.Errorf("clearStickyChoices() without choices = %d, %v, want 0", removed, err)
+	}
+}
+
+// stickyChoicesEqual compares choices, ignoring the time zones of expiry times
+func stickyChoicesEqual(got, want map[string]stickyChoice) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for domain, w := range want {
+		g, ok := got[domain]
+		if !ok || g.Browser != w.Browser || g.Session != w.Session || !g.Expires.Equal(w.Expires) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestReadStickyChoices tests that a broken file has no choices
+func TestReadStickyChoices(t *testing.T) {
+	path := t.TempDir() + "/sticky.json"
+	if err := os.WriteFile(path, []byte(`{"a.example":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := readStickyChoices(path); len(got) != 0 {
+		t.Errorf("readStickyChoices() of a broken file = %+v", got)
+	}
+}
+
+// TestStickyChoiceDescribe tests describing how long a choice lasts
+func TestStickyChoiceDescribe(t *testing.T) {
+	now := time.Date(2026, 10, 17, 14, 3, 0, 0, time.Local)
+	setClock(t, now)
+
+	tests := []struct {
+		choice stickyChoice
+		want   string
+	}{
+		{choice: stickyChoice{Session: "boot/2"}, want: "for this session"},
+		{choice: stickyChoice{Expires: now.Add(30 * time.Minute)}, want: "until 14:33"},
+		{choice: stickyChoice{Expires: now.Add(25 * time.Hour)}, want: "until Oct 18, 15:03"},
+	}
+	for _, tt := range tests {
+		if got := tt.choice.describe(); got != tt.want {
+			t.Errorf("describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// TestConfigStickyDomains tests which links the picker offers sticky choices for
+func TestConfigStickyDomains(t *testing.T) {
+	cfg := &Config{Rules: []Rule{
+		{AlwaysAsk: true, Conditions: []Condition{{Type: "domain_suffix", Pattern: "ask.example"}}},
+		{AlwaysAsk: true, Conditions: []Condition{{Type: "scheme", Pattern: "mailto"}}},
+	}}
+	urls := []string{"https://Docs.Ask.example/a", "https://other.example/", "https://docs.ask.example/b", "mailto:bob@ask.example", "https://ask.example:8443/"}
+	want := []string{"docs.ask.example", "ask.example"}
+	if got := cfg.stickyDomains(urls, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("stickyDomains() = %v, want %v", got, want)
+	}
+}
@@ -84,46 +84,36 @@ func simpleDialogWithToolbar(title string, width, height int, header *adw.Header
 
 // conditionTypeToIndex converts a condition type string to combo row index.
 func conditionTypeToIndex(condType string) uint {
-	switch condType {
-	case "domain":
-		return 0
-	case "keyword":
-		return 1
-	case "glob":
-		return 2
-	case "regex":
-		return 3
-	default:
-		return 0
+	for i, ct := range conditionTypes {
+		if ct.Type == condType {
+			return uint(i)
+		}
 	}
+	return 0
 }
 
 // indexToConditionType converts a combo row index to condition type string.
 func indexToConditionType(index uint) string {
-	switch index {
-	case 0:
-		return "domain"
-	case 1:
-		return "keyword"
-	case 2:
-		return "glob"
-	case 3:
-		return "regex"
-	default:
-		return "domain"
+	if int(index) < len(conditionTypes) {
+		return conditionTypes[index].Type
 	}
+	return "domain"
 }
 
 // conditionTypeComboRow creates a standardized combo row for selecting condition types.
 func conditionTypeComboRow(title string, initialType string) *adw.ComboRow {
 	typeRow := adw.NewComboRow()
 	typeRow.SetTitle(title)
-	typeRow.SetModel(gtk.NewStringList([]string{"Exact Domain", "URL Contains", "Wildcard", "Regex"}))
+	typeRow.SetModel(gtk.NewStringList(getConditionTypeLabels()))
 	typeRow.SetSelected(conditionTypeToIndex(initialType))
 	return typeRow
 }
 
 // getConditionTypeLabels returns the display labels for condition types in order.
 func getConditionTypeLabels() []string {
-	return []string{"Exact Domain", "URL Contains", "Wildcard", "Regex"}
+	labels := make([]string, len(conditionTypes))
+	for i, ct := range conditionTypes {
+		labels[i] = ct.Label
+	}
+	return labels
 }
@@ -3,6 +3,8 @@
 package main
 
 import (
+	"path/filepath"
+
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
@@ -27,7 +29,12 @@ func loadBrowserIcon(browser *Browser, size int) *gtk.Image {
 		iconName = "web-browser-symbolic"
 	}
 
-	image := gtk.NewImageFromIconName(iconName)
+	var image *gtk.Image
+	if filepath.IsAbs(iconName) {
+		image = gtk.NewImageFromFile(iconName) // custom targets can use an icon file
+	} else {
+		image = gtk.NewImageFromIconName(iconName)
+	}
 	image.SetPixelSize(size)
 	return image
 }
@@ -63,3 +70,14 @@ func findBrowserByID(browsers []*Browser, id string) *Browser {
 	}
 	return nil
 }
+
+// targetName returns a function naming browsers by ID, falling back to the ID
+// for browsers that aren't installed.
+func targetName(browsers []*Browser) func(id string) string {
+	return func(id string) string {
+		if b := findBrowserByID(browsers, id); b != nil {
+			return b.Name
+		}
+		return id
+	}
+}
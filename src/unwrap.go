@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxUnwrapDepth limits how many wrappers are removed from a single URL, so
+// links wrapped in each other (e.g. SafeLinks around Proofpoint) are fully
+// unwrapped without looping forever on malicious input.
+const maxUnwrapDepth = 8
+
+// unwrapper decodes the destination of one kind of redirect or link-protection
+// wrapper, entirely offline.
+type unwrapper struct {
+	ID     string // used in the disabled_unwrappers config
+	Name   string
+	unwrap func(u *url.URL, rawURL string) (string, bool)
+}
+
+// unwrappers lists every supported wrapper, in the order they appear in settings.
+var unwrappers = []unwrapper{
+	{ID: "safelinks", Name: "Microsoft Outlook Safe Links", unwrap: unwrapSafeLinks},
+	{ID: "teams", Name: "Microsoft Teams", unwrap: unwrapTeams},
+	{ID: "proofpoint", Name: "Proofpoint URL Defense", unwrap: unwrapProofpoint},
+	{ID: "google", Name: "Google Search and Mail Redirects", unwrap: unwrapGoogle},
+	{ID: "facebook", Name: "Facebook, Messenger and Instagram", unwrap: unwrapFacebook},
+	{ID: "slack", Name: "Slack", unwrap: unwrapSlack},
+	{ID: "youtube", Name: "YouTube", unwrap: unwrapYouTube},
+}
+
+// unwrapURL removes redirect wrappers from a URL using the enabled unwrappers.
+func (cfg *Config) unwrapURL(rawURL string) string {
+	return unwrapURL(rawURL, cfg.DisabledUnwrappers)
+}
+
+// unwrapURL repeatedly removes redirect wrappers from a URL until none of the
+// unwrappers apply. Unwrappers whose IDs are in disabled are skipped.
+func unwrapURL(rawURL string, disabled []string) string {
+	skip := make(map[string]bool, len(disabled))
+	for _, id := range disabled {
+		skip[id] = true
+	}
+
+	for depth := 0; depth < maxUnwrapDepth; depth++ {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return rawURL
+		}
+
+		unwrapped := false
+		for _, uw := range unwrappers {
+			if skip[uw.ID] {
+				continue
+			}
+			if target, ok := uw.unwrap(u, rawURL); ok && isUnwrappedURL(target) {
+				rawURL = target
+				unwrapped = true
+				break
+			}
+		}
+		if !unwrapped {
+			return rawURL
+		}
+	}
+	return rawURL
+}
+
+// isUnwrappedURL reports whether a decoded destination is an absolute web URL.
+// Anything else, such as javascript: URLs, is left wrapped.
+func isUnwrappedURL(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// isUnwrapperEnabled reports whether an unwrapper is enabled in the config
+func (cfg *Config) isUnwrapperEnabled(id string) bool {
+	for _, disabled := range cfg.DisabledUnwrappers {
+		if disabled == id {
+			return false
+		}
+	}
+	return true
+}
+
+// setUnwrapperEnabled enables or disables an unwrapper in the config
+func (cfg *Config) setUnwrapperEnabled(id string, enabled bool) {
+	var disabled []string
+	for _, d := range cfg.DisabledUnwrappers {
+		if d != id {
+			disabled = append(disabled, d)
+		}
+	}
+	if !enabled {
+		disabled = append(disabled, id)
+	}
+	cfg.DisabledUnwrappers = disabled
+}
+
+// queryTarget returns a query parameter of u if it's non-empty.
+func queryTarget(u *url.URL, param string) (string, bool) {
+	target := u.Query().Get(param)
+	return target, target != ""
+}
+
+// unwrapSafeLinks decodes Outlook Safe Links, e.g.
+// https://nam12.safelinks.protection.outlook.com/?url=https%3A%2F%2Fexample.com&data=...
+func unwrapSafeLinks(u *url.URL, _ string) (string, bool) {
+	if !matchDomainSuffix(u.Hostname(), "safelinks.protection.outlook.com") &&
+		!matchDomainSuffix(u.Hostname(), "safelinks.protection.office365.us") {
+		return "", false
+	}
+	return queryTarget(u, "url")
+}
+
+// unwrapTeams decodes the Safe Links page Microsoft Teams opens links through, e.g.
+// https://statics.teams.cdn.office.net/evergreen-assets/safelinks/1/atp-safelinks.html?url=...
+func unwrapTeams(u *url.URL, _ string) (string, bool) {
+	if !matchDomainSuffix(u.Hostname(), "teams.cdn.office.net") || !strings.Contains(u.Path, "safelinks") {
+		return "", false
+	}
+	return queryTarget(u, "url")
+}
+
+// proofpointV3Pattern extracts the wrapped URL and the base64url-encoded
+// characters it leaves out of a Proofpoint v3 URL.
+var proofpointV3Pattern = regexp.MustCompile(`/v3/__(.+?)__;([^!]*)!`)
+
+// proofpointRunLengths maps the character after "**" in a v3 URL to the number
+// of characters that token stands for.
+const proofpointRunLengths = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// unwrapProofpoint decodes Proofpoint URL Defense links in all three formats:
+//
+//   - v1: https://urldefense.proofpoint.com/v1/url?u=<url>&k=...
+//   - v2: https://urldefense.proofpoint.com/v2/url?u=<url with - for % and _ for />&d=...
+//   - v3: https://urldefense.com/v3/__<url>__;<base64url>!!...
+func unwrapProofpoint(u *url.URL, rawURL string) (string, bool) {
+	host := u.Hostname()
+	if !matchDomainSuffix(host, "urldefense.proofpoint.com") &&
+		!matchDomainSuffix(host, "urldefense.com") &&
+		!matchDomainSuffix(host, "urldefense.us") {
+		return "", false
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, "/v1/"):
+		return queryTarget(u, "u")
+	case strings.HasPrefix(u.Path, "/v2/"):
+		encoded, ok := queryTarget(u, "u")
+		if !ok {
+			return "", false
+		}
+		encoded = strings.NewReplacer("-", "%", "_", "/").Replace(encoded)
+		target, err := url.PathUnescape(encoded)
+		return target, err == nil
+	case strings.HasPrefix(u.Path, "/v3/"):
+		return decodeProofpointV3(rawURL)
+	}
+	return "", false
+}
+
+// decodeProofpointV3 decodes a v3 URL. Characters Proofpoint considers unsafe
+// are replaced with "*" in the wrapped URL and stored in the base64url-encoded
+// part: "*" stands for the next character, "**X" for a run of them whose
+// length is given by X.
+func decodeProofpointV3(rawURL string) (string, bool) {
+	m := proofpointV3Pattern.FindStringSubmatch(rawURL)
+	if m == nil {
+		return "", false
+	}
+	wrapped, err := url.PathUnescape(m[1])
+	if err != nil {
+		return "", false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(m[2], "="))
+	if err != nil {
+		return "", false
+	}
+
+	replacements := []rune(string(decoded))
+	take := func(n int) (string, bool) {
+		if n > len(replacements) {
+			return "", false
+		}
+		s := string(replacements[:n])
+		replacements = replacements[n:]
+		return s, true
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(wrapped); i++ {
+		if wrapped[i] != '*' {
+			b.WriteByte(wrapped[i])
+			continue
+		}
+		n := 1
+		if i+2 < len(wrapped) && wrapped[i+1] == '*' {
+			run := strings.IndexByte(proofpointRunLengths, wrapped[i+2])
+			if run == -1 {
+				return "", false
+			}
+			n = run + 2
+			i += 2
+		}
+		s, ok := take(n)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s)
+	}
+	return b.String(), true
+}
+
+// unwrapGoogle decodes Google redirects on any Google domain, e.g.
+// https://www.google.com/url?q=https://example.com&sa=D (Gmail, Docs) or
+// https://www.google.co.uk/url?url=https://example.com&ved=... (search results)
+func unwrapGoogle(u *url.URL, _ string) (string, bool) {
+	if u.Path != "/url" || !strings.HasPrefix(registrableDomain(u.Hostname()), "google.") {
+		return "", false
+	}
+	if target, ok := queryTarget(u, "url"); ok {
+		return target, true
+	}
+	return queryTarget(u, "q")
+}
+
+// unwrapFacebook decodes Facebook, Messenger and Instagram link shims, e.g.
+// https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com&h=...
+func unwrapFacebook(u *url.URL, _ string) (string, bool) {
+	switch u.Hostname() {
+	case "l.facebook.com", "lm.facebook.com", "l.messenger.com":
+		if u.Path != "/l.php" {
+			return "", false
+		}
+	case "l.instagram.com":
+	default:
+		return "", false
+	}
+	return queryTarget(u, "u")
+}
+
+// unwrapSlack decodes Slack's redirect, e.g. https://slack-redir.net/link?url=https%3A%2F%2Fexample.com
+func unwrapSlack(u *url.URL, _ string) (string, bool) {
+	if u.Hostname() != "slack-redir.net" || u.Path != "/link" {
+		return "", false
+	}
+	return queryTarget(u, "url")
+}
+
+// unwrapYouTube decodes links from video descriptions and comments, e.g.
+// https://www.youtube.com/redirect?event=video_description&q=https%3A%2F%2Fexample.com
+func unwrapYouTube(u *url.URL, _ string) (string, bool) {
+	if !matchDomainSuffix(u.Hostname(), "youtube.com") || u.Path != "/redirect" {
+		return "", false
+	}
+	return queryTarget(u, "q")
+}
@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+// TestUnwrapURL tests decoding every supported wrapper format
+func TestUnwrapURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		// Outlook Safe Links
+		{
+			name: "safelinks",
+			url:  "https://nam12.safelinks.protection.outlook.com/?url=https%3A%2F%2Fexample.com%2Fdoc%3Fid%3D1&data=05%7C01%7Cuser%40example.com&reserved=0",
+			want: "https://example.com/doc?id=1",
+		},
+		{
+			name: "safelinks government cloud",
+			url:  "https://gcc02.safelinks.protection.office365.us/?url=https%3A%2F%2Fexample.gov%2F&data=x",
+			want: "https://example.gov/",
+		},
+		{
+			name: "safelinks without url",
+			url:  "https://nam12.safelinks.protection.outlook.com/?data=x",
+			want: "https://nam12.safelinks.protection.outlook.com/?data=x",
+		},
+
+		// Microsoft Teams
+		{
+			name: "teams",
+			url:  "https://statics.teams.cdn.office.net/evergreen-assets/safelinks/1/atp-safelinks.html?url=https%3A%2F%2Fexample.com%2Fwiki&locale=en-us",
+			want: "https://example.com/wiki",
+		},
+
+		// Proofpoint
+		{
+			name: "proofpoint v1",
+			url:  "https://urldefense.proofpoint.com/v1/url?u=http://www.example.com/page&k=abc%3D%0A&r=def",
+			want: "http://www.example.com/page",
+		},
+		{
+			name: "proofpoint v2",
+			url:  "https://urldefense.proofpoint.com/v2/url?u=https-3A__media.mitre.org_news_dailynews_index.html&d=DwMFaQ&c=abc&r=def&m=ghi&s=jkl&e=",
+			want: "https://media.mitre.org/news/dailynews/index.html",
+		},
+		{
+			name: "proofpoint v2 with query",
+			url:  "https://urldefense.proofpoint.com/v2/url?u=https-3A__example.com_search-3Fq-3Dgo-26lang-3Den&d=x&e=",
+			want: "https://example.com/search?q=go&lang=en",
+		},
+		{
+			name: "proofpoint v3 single replacement",
+			url:  "https://urldefense.com/v3/__https://google.com:443/search?q=a*test&gs=ps__;Kw!-612Flbf0JvQ3kNJkRi5Jg!Ue6tQudNKaShHg93trcdjqDP8se2ySE65jyCIe2K1D_uNjZ1Lnf6YLQERujngZv9UWf66ujQIQ$",
+			want: "https://google.com:443/search?q=a+test&gs=ps",
+		},
+		{
+			// "**A" is a run of two characters: "++"
+			name: "proofpoint v3 run",
+			url:  "https://urldefense.com/v3/__https://example.com/a**Ab__;Kys!!abc$",
+			want: "https://example.com/a++b",
+		},
+		{
+			// "*" and "**B" consume the replacement characters in order: "#" then "&&&"
+			name: "proofpoint v3 mixed",
+			url:  "https://urldefense.com/v3/__https://example.com/x?a=1**Bb=2*frag__;JiYmIw!!abc$",
+			want: "https://example.com/x?a=1&&&b=2#frag",
+		},
+		{
+			name: "proofpoint v3 without replacements",
+			url:  "https://urldefense.com/v3/__https://example.com/plain__;!!abc$",
+			want: "https://example.com/plain",
+		},
+		{
+			name: "proofpoint v3 missing replacement characters",
+			url:  "https://urldefense.com/v3/__https://example.com/a**Zb__;Kw!!abc$",
+			want: "https://urldefense.com/v3/__https://example.com/a**Zb__;Kw!!abc$",
+		},
+		{
+			name: "proofpoint v3 on urldefense.us",
+			url:  "https://urldefense.us/v3/__https://example.mil/__;!!abc$",
+			want: "https://example.mil/",
+		},
+
+		// Google
+		{
+			name: "google q parameter",
+			url:  "https://www.google.com/url?q=https://example.com/page&sa=D&source=editors&ust=1",
+			want: "https://example.com/page",
+		},
+		{
+			name: "google url parameter",
+			url:  "https://www.google.co.uk/url?sa=t&rct=j&url=https%3A%2F%2Fexample.co.uk%2F&ved=abc",
+			want: "https://example.co.uk/",
+		},
+		{
+			name: "google search is not a redirect",
+			url:  "https://www.google.com/search?q=https://example.com",
+			want: "https://www.google.com/search?q=https://example.com",
+		},
+		{
+			name: "not google",
+			url:  "https://google.evil.com/url?q=https://example.com",
+			want: "https://google.evil.com/url?q=https://example.com",
+		},
+
+		// Facebook
+		{
+			name: "facebook",
+			url:  "https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F%3Fref%3Dfb&h=AT0abc",
+			want: "https://example.com/?ref=fb",
+		},
+		{
+			name: "facebook mobile",
+			url:  "https://lm.facebook.com/l.php?u=https%3A%2F%2Fexample.com%2F&h=x",
+			want: "https://example.com/",
+		},
+		{
+			name: "messenger",
+			url:  "https://l.messenger.com/l.php?u=https%3A%2F%2Fexample.com%2F&h=x",
+			want: "https://example.com/",
+		},
+		{
+			name: "instagram",
+			url:  "https://l.instagram.com/?u=https%3A%2F%2Fexample.com%2F&e=x",
+			want: "https://example.com/",
+		},
+
+		// Slack
+		{
+			name: "slack",
+			url:  "https://slack-redir.net/link?url=https%3A%2F%2Fexample.com%2Fdocs",
+			want: "https://example.com/docs",
+		},
+
+		// YouTube
+		{
+			name: "youtube",
+			url:  "https://www.youtube.com/redirect?event=video_description&redir_token=abc&q=https%3A%2F%2Fexample.com%2F&v=xyz",
+			want: "https://example.com/",
+		},
+
+		// Nesting and safety
+		{
+			name: "nested wrappers",
+			url:  "https://nam12.safelinks.protection.outlook.com/?url=" + url.QueryEscape("https://urldefense.com/v3/__https://example.com/a*b__;Kw!!abc$") + "&data=x",
+			want: "https://example.com/a+b",
+		},
+		{
+			name: "javascript target is not unwrapped",
+			url:  "https://slack-redir.net/link?url=javascript%3Aalert(1)",
+			want: "https://slack-redir.net/link?url=javascript%3Aalert(1)",
+		},
+		{
+			name: "relative target is not unwrapped",
+			url:  "https://www.google.com/url?q=/search",
+			want: "https://www.google.com/url?q=/search",
+		},
+		{
+			name: "plain url",
+			url:  "https://example.com/?url=https://other.example",
+			want: "https://example.com/?url=https://other.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unwrapURL(tt.url, nil); got != tt.want {
+				t.Errorf("unwrapURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnwrapURL_Disabled tests that disabled unwrappers are skipped
+func TestUnwrapURL_Disabled(t *testing.T) {
+	wrapped := "https://slack-redir.net/link?url=https%3A%2F%2Fexample.com"
+
+	if got := unwrapURL(wrapped, []string{"slack"}); got != wrapped {
+		t.Errorf("disabled unwrapper changed URL to %q", got)
+	}
+	if got := unwrapURL(wrapped, []string{"google"}); got != "https://example.com" {
+		t.Errorf("unrelated disabled unwrapper: got %q", got)
+	}
+}
+
+// TestUnwrapURL_DepthLimit tests that deeply nested wrappers stop unwrapping
+func TestUnwrapURL_DepthLimit(t *testing.T) {
+	target := "https://example.com/"
+	wrapped := target
+	for i := 0; i < maxUnwrapDepth+2; i++ {
+		wrapped = "https://slack-redir.net/link?url=" + url.QueryEscape(wrapped)
+	}
+
+	got := unwrapURL(wrapped, nil)
+	if got == target {
+		t.Error("expected unwrapping to stop at the depth limit")
+	}
+	if u, err := url.Parse(got); err != nil || u.Host != "slack-redir.net" {
+		t.Errorf("unwrapURL() = %q, want a partially unwrapped slack link", got)
+	}
+}
+
+// TestSetUnwrapperEnabled tests toggling unwrappers in the config
+func TestSetUnwrapperEnabled(t *testing.T) {
+	cfg := &Config{}
+	if !cfg.isUnwrapperEnabled("google") {
+		t.Fatal("expected unwrappers to be enabled by default")
+	}
+
+	cfg.setUnwrapperEnabled("google", false)
+	cfg.setUnwrapperEnabled("google", false)
+	if cfg.isUnwrapperEnabled("google") || len(cfg.DisabledUnwrappers) != 1 {
+		t.Errorf("DisabledUnwrappers = %v, want [google]", cfg.DisabledUnwrappers)
+	}
+
+	cfg.setUnwrapperEnabled("google", true)
+	if !cfg.isUnwrapperEnabled("google") || len(cfg.DisabledUnwrappers) != 0 {
+		t.Errorf("DisabledUnwrappers = %v, want []", cfg.DisabledUnwrappers)
+	}
+}
+
+// TestUnwrappers_UniqueIDs tests that every unwrapper can be toggled separately
+func TestUnwrappers_UniqueIDs(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, uw := range unwrappers {
+		if uw.ID == "" || uw.Name == "" || uw.unwrap == nil {
+			t.Errorf("incomplete unwrapper: %+v", uw)
+		}
+		if seen[uw.ID] {
+			t.Errorf("duplicate unwrapper ID %q", uw.ID)
+		}
+		seen[uw.ID] = true
+	}
+}
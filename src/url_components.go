@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// urlComponents holds the parsed parts of a URL that structured conditions match against.
+type urlComponents struct {
+	Scheme   string
+	Host     string
+	Port     string // explicit port, or the scheme's default port when omitted
+	Path     string
+	RawPath  string // Path as written in the URL, with escapes like %20
+	Query    url.Values
+	Fragment string
+}
+
+// defaultPorts maps schemes to the port used when a URL doesn't specify one.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// parseURLComponents splits a URL into its components using net/url.
+// Bare URLs without a scheme (e.g. "example.com/path") are parsed as if they
+// had one, so the host and path end up in the right place.
+func parseURLComponents(rawURL string) urlComponents {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme == "" && u.Host == "") || looksLikeHostPort(u) {
+		u, err = url.Parse("//" + rawURL)
+		if err != nil {
+			return urlComponents{Query: url.Values{}}
+		}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[scheme]
+	}
+
+	return urlComponents{
+		Scheme:   scheme,
+		Host:     strings.ToLower(u.Hostname()),
+		Port:     port,
+		Path:     u.Path,
+		RawPath:  u.EscapedPath(),
+		Query:    u.Query(),
+		Fragment: u.Fragment,
+	}
+}
+
+// looksLikeHostPort reports whether net/url mistook a bare "host:port" for an opaque URI,
+// e.g. "localhost:8080/app" parses as scheme "localhost" with opaque "8080/app".
+func looksLikeHostPort(u *url.URL) bool {
+	return u.Opaque != "" && u.Opaque[0] >= '0' && u.Opaque[0] <= '9'
+}
+
+// matchComponent matches a pattern against a single parsed component of the URL.
+func matchComponent(c *urlComponents, pattern, patternType string) bool {
+	switch patternType {
+	case "scheme":
+		return strings.EqualFold(c.Scheme, strings.TrimSuffix(pattern, ":"))
+	case "domain_suffix":
+		return matchDomainSuffix(c.Host, pattern)
+	case "host":
+		return matchHost(c.Host, pattern)
+	case "port":
+		return c.Port != "" && c.Port == strings.TrimLeft(pattern, "0")
+	case "path_prefix":
+		// Prefixes may be written with escapes, since paths can't contain spaces
+		return matchPathPrefix(c.Path, pattern) || matchPathPrefix(c.RawPath, pattern)
+	case "path_glob":
+		matched, _ := path.Match(pattern, c.Path)
+		return matched
+	case "query":
+		return matchQuery(c.Query, pattern)
+	case "fragment":
+		return c.Fragment == strings.TrimPrefix(pattern, "#")
+	case "extension":
+		return matchExtension(c.Path, pattern)
+	default:
+		return false
+	}
+}
+
+// matchHost matches a hostname against a pattern that may contain * and ? wildcards.
+// Hostnames never contain slashes, so path.Match gives us plain glob semantics.
+func matchHost(host, pattern string) bool {
+	matched, _ := path.Match(strings.ToLower(pattern), host)
+	return matched
+}
+
+// matchPathPrefix reports whether urlPath starts with prefix on a segment boundary,
+// so "/docs" matches "/docs" and "/docs/intro" but not "/docsearch".
+func matchPathPrefix(urlPath, prefix string) bool {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return false
+	}
+	if len(urlPath) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	return urlPath[len(prefix)] == '/'
+}
+
+// matchQuery matches "name" (parameter present) or "name=value" (any value of the
+// parameter equals value) against the URL's query parameters.
+func matchQuery(query url.Values, pattern string) bool {
+	name, value, hasValue := strings.Cut(pattern, "=")
+	values, ok := query[name]
+	if !ok {
+		return false
+	}
+	if !hasValue {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExtension matches the file extension of the last path segment, with or without a leading dot.
+func matchExtension(urlPath, pattern string) bool {
+	ext := path.Ext(urlPath)
+	if ext == "" {
+		return false
+	}
+	return strings.EqualFold(ext[1:], strings.TrimPrefix(pattern, "."))
+}
+
+// parsePort converts a port string to a number, returning 0 if it isn't one.
+func parsePort(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// isValidPort reports whether s is a decimal port number between 1 and 65535.
+func isValidPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 1 && n <= 65535 && !strings.HasPrefix(s, "+")
+}
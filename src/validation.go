@@ -4,24 +4,19 @@ package main
 
 import (
 	"fmt"
+	"net/url"
+	"path"
 	"regexp"
 	"strings"
 )
 
 // validateConditions checks if all conditions have non-empty patterns and valid types
 func validateConditions(conditions []Condition) bool {
-	validTypes := map[string]bool{
-		"domain":  true,
-		"keyword": true,
-		"glob":    true,
-		"regex":   true,
-	}
-
 	for _, c := range conditions {
 		if c.Pattern == "" {
 			return false
 		}
-		if !validTypes[c.Type] {
+		if !isKnownConditionType(c.Type) {
 			return false
 		}
 		// For regex type, validate the pattern compiles
@@ -72,6 +67,19 @@ func validateDomainPattern(pattern string) error {
 	return nil
 }
 
+// validateDomainSuffixPattern checks a pattern that also matches subdomains.
+// Public suffixes like "com" or "github.io" are rejected, since they would
+// match unrelated sites. An exact domain may be one, e.g. "github.io" is a site.
+func validateDomainSuffixPattern(pattern string) error {
+	if err := validateDomainPattern(pattern); err != nil {
+		return err
+	}
+	if isPublicSuffix(pattern) {
+		return fmt.Errorf("%s is a public suffix, not a domain", pattern)
+	}
+	return nil
+}
+
 // validateGlobPattern checks if a glob (wildcard) pattern is valid.
 // Glob patterns can contain * wildcards for matching multiple characters.
 func validateGlobPattern(pattern string) error {
@@ -108,6 +116,141 @@ func validateGlobPattern(pattern string) error {
 	return nil
 }
 
+// validateSchemePattern checks if a URL scheme is valid per RFC 3986:
+// a letter followed by letters, digits, "+", "-" or ".".
+func validateSchemePattern(pattern string) error {
+	pattern = strings.TrimSuffix(pattern, ":")
+	if pattern == "" {
+		return fmt.Errorf("Scheme cannot be empty")
+	}
+	for i, ch := range pattern {
+		isLetter := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+		if i == 0 && !isLetter {
+			return fmt.Errorf("Scheme must start with a letter")
+		}
+		if !isLetter && !(ch >= '0' && ch <= '9') && ch != '+' && ch != '-' && ch != '.' {
+			return fmt.Errorf("Scheme contains invalid character: %c", ch)
+		}
+	}
+	return nil
+}
+
+// validateHostPattern checks if a host pattern is valid.
+// Host patterns are hostnames that may contain * and ? wildcards.
+func validateHostPattern(pattern string) error {
+	if strings.Contains(pattern, " ") {
+		return fmt.Errorf("Host cannot contain spaces")
+	}
+	for _, ch := range pattern {
+		if !((ch >= 'a' && ch <= 'z') ||
+			(ch >= 'A' && ch <= 'Z') ||
+			(ch >= '0' && ch <= '9') ||
+			ch == '.' || ch == '-' || ch == '_' || ch == '*' || ch == '?') {
+			return fmt.Errorf("Host contains invalid character: %c", ch)
+		}
+	}
+	if strings.HasPrefix(pattern, ".") || strings.HasSuffix(pattern, ".") {
+		return fmt.Errorf("Host cannot start or end with a dot")
+	}
+	return nil
+}
+
+// validatePortPattern checks if a port is a number between 1 and 65535.
+func validatePortPattern(pattern string) error {
+	if !isValidPort(pattern) {
+		return fmt.Errorf("Port must be a number between 1 and 65535")
+	}
+	return nil
+}
+
+// validatePathPattern checks if a path prefix is valid.
+// Paths must be absolute and cannot contain spaces, queries or fragments.
+func validatePathPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("Path must start with /")
+	}
+	if strings.ContainsAny(pattern, " ?#") {
+		return fmt.Errorf("Path cannot contain spaces, ? or #")
+	}
+	return nil
+}
+
+// validatePathGlobPattern checks if a path wildcard pattern is valid.
+// * matches within a single path segment, as in shell globs.
+func validatePathGlobPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("Path pattern must start with /")
+	}
+	if strings.ContainsAny(pattern, " #") {
+		return fmt.Errorf("Path pattern cannot contain spaces or #")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("Invalid path pattern: %w", err)
+	}
+	return nil
+}
+
+// validateQueryPattern checks if a query parameter pattern is valid.
+// Patterns are either "name" (parameter present) or "name=value".
+func validateQueryPattern(pattern string) error {
+	name, _, _ := strings.Cut(pattern, "=")
+	if name == "" {
+		return fmt.Errorf("Query parameter name cannot be empty")
+	}
+	if strings.ContainsAny(pattern, "&# ") {
+		return fmt.Errorf("Query parameter cannot contain &, # or spaces")
+	}
+	return nil
+}
+
+// validateFragmentPattern checks if a fragment pattern is valid.
+func validateFragmentPattern(pattern string) error {
+	if strings.TrimPrefix(pattern, "#") == "" {
+		return fmt.Errorf("Fragment cannot be empty")
+	}
+	if strings.Contains(pattern, " ") {
+		return fmt.Errorf("Fragment cannot contain spaces")
+	}
+	return nil
+}
+
+// validateExtensionPattern checks if a file extension is valid, e.g. "pdf" or ".pdf".
+func validateExtensionPattern(pattern string) error {
+	ext := strings.TrimPrefix(pattern, ".")
+	if ext == "" {
+		return fmt.Errorf("Extension cannot be empty")
+	}
+	for _, ch := range ext {
+		if !((ch >= 'a' && ch <= 'z') ||
+			(ch >= 'A' && ch <= 'Z') ||
+			(ch >= '0' && ch <= '9')) {
+			return fmt.Errorf("Extension contains invalid character: %c", ch)
+		}
+	}
+	return nil
+}
+
+// validateSchedulePattern checks if a schedule such as "mon-fri 09:00-17:00" is valid.
+// Time ranges may cross midnight, but can't be empty.
+func validateSchedulePattern(pattern string) error {
+	_, err := parseSchedule(pattern)
+	return err
+}
+
+// validateSourceAppPattern checks if a source app pattern is valid: an executable
+// name, desktop file ID or Flatpak app ID, with optional * and ? wildcards.
+func validateSourceAppPattern(pattern string) error {
+	for _, ch := range pattern {
+		if !((ch >= 'a' && ch <= 'z') ||
+			(ch >= 'A' && ch <= 'Z') ||
+			(ch >= '0' && ch <= '9') ||
+			ch == '.' || ch == '-' || ch == '_' || ch == '+' || ch == '*' || ch == '?') {
+			return fmt.Errorf("App contains invalid character: %c", ch)
+		}
+	}
+	return nil
+}
+
 // validateConditionPattern checks if a condition's pattern is valid for its type.
 // Returns an error with a descriptive message if invalid, nil if valid.
 func validateConditionPattern(condType, pattern string) error {
@@ -118,6 +261,8 @@ func validateConditionPattern(condType, pattern string) error {
 	switch condType {
 	case "domain":
 		return validateDomainPattern(pattern)
+	case "domain_suffix":
+		return validateDomainSuffixPattern(pattern)
 	case "glob":
 		return validateGlobPattern(pattern)
 	case "regex":
@@ -127,6 +272,28 @@ func validateConditionPattern(condType, pattern string) error {
 	case "keyword":
 		// Keywords can be any non-empty string
 		return nil
+	case "scheme":
+		return validateSchemePattern(pattern)
+	case "host":
+		return validateHostPattern(pattern)
+	case "port":
+		return validatePortPattern(pattern)
+	case "path_prefix":
+		return validatePathPattern(pattern)
+	case "path_glob":
+		return validatePathGlobPattern(pattern)
+	case "query":
+		return validateQueryPattern(pattern)
+	case "fragment":
+		return validateFragmentPattern(pattern)
+	case "extension":
+		return validateExtensionPattern(pattern)
+	case "schedule":
+		return validateSchedulePattern(pattern)
+	case "source_app":
+		return validateSourceAppPattern(pattern)
+	case "mail_to", "mail_cc":
+		return validateMailAddressPattern(pattern)
 	}
 
 	return nil
@@ -149,3 +316,192 @@ func areAllConditionsValid(conditions []Condition) bool {
 	}
 	return true
 }
+
+// isConditionGroupValid checks if a condition group and all of its nested groups
+// are valid. Groups must contain at least one condition or non-empty group.
+func isConditionGroupValid(g ConditionGroup) bool {
+	if len(g.Conditions) == 0 && len(g.Groups) == 0 {
+		return false
+	}
+	for _, c := range g.Conditions {
+		if !isConditionValid(c) {
+			return false
+		}
+	}
+	for _, sub := range g.Groups {
+		if !isConditionGroupValid(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRewriteTemplate checks that a rewrite template only uses known
+// placeholders and produces an absolute URL.
+func validateRewriteTemplate(template string) error {
+	example, _ := url.Parse("https://example.com:8080/path?q=1#top")
+	expanded, err := expandRewriteTemplate(template, example)
+	if err != nil {
+		return err
+	}
+	if u, err := url.Parse(expanded); err != nil || u.Scheme == "" {
+		return fmt.Errorf("Template must produce a full URL, like https://{host}{path}")
+	}
+	return nil
+}
+
+// validateRewrite checks if a rewrite is valid. It must strip parameters or
+// have a template, and its conditions, if any, must be valid.
+func validateRewrite(rw Rewrite) error {
+	if len(rw.StripParams) == 0 && rw.Template == "" {
+		return fmt.Errorf("Rewrite must remove query parameters or have a template")
+	}
+	for _, pattern := range rw.StripParams {
+		if pattern == "" || strings.ContainsAny(pattern, "&=# ") {
+			return fmt.Errorf("Invalid query parameter name: %q", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid query parameter pattern: %q", pattern)
+		}
+	}
+	if rw.Template != "" {
+		if err := validateRewriteTemplate(rw.Template); err != nil {
+			return err
+		}
+	}
+	if group := rw.conditionGroup(); !group.isEmpty() && !isConditionGroupValid(group) {
+		return fmt.Errorf("Rewrite has invalid conditions")
+	}
+	return nil
+}
+
+// validateCondition checks that a condition has a known type and a valid pattern.
+func validateCondition(c Condition) error {
+	if !isKnownConditionType(c.Type) {
+		return fmt.Errorf("Unknown condition type %q", c.Type)
+	}
+	if err := validateConditionPattern(c.Type, c.Pattern); err != nil {
+		return fmt.Errorf("%s: %w", getTypeLabel(c.Type), err)
+	}
+	return nil
+}
+
+// validateConditionGroup is like isConditionGroupValid, but returns the first
+// problem found.
+func validateConditionGroup(g ConditionGroup) error {
+	if len(g.Conditions) == 0 && len(g.Groups) == 0 {
+		return fmt.Errorf("Condition group cannot be empty")
+	}
+	if g.Logic != "" && g.Logic != "all" && g.Logic != "any" {
+		return fmt.Errorf("Logic must be \"all\" or \"any\", not %q", g.Logic)
+	}
+	for _, c := range g.Conditions {
+		if err := validateCondition(c); err != nil {
+			return err
+		}
+	}
+	for _, sub := range g.Groups {
+		if err := validateConditionGroup(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRule checks if a rule is valid. It needs valid conditions and a
+// browser, unless it always asks, and valid launch options.
+func validateRule(rule Rule) error {
+	root := rule.rootGroup()
+	if root.isEmpty() {
+		return fmt.Errorf("Rule must have at least one condition")
+	}
+	if err := validateConditionGroup(root); err != nil {
+		return err
+	}
+	if rule.Browser == "" && !rule.AlwaysAsk {
+		return fmt.Errorf("Rule must have a browser")
+	}
+	if err := validateFallbacks(rule.Fallbacks); err != nil {
+		return err
+	}
+	return validateLaunchOptions(rule.launchOptions())
+}
+
+// validateFallbacks checks if a list of fallback browsers has no empty or
+// repeated IDs.
+func validateFallbacks(fallbacks []string) error {
+	seen := make(map[string]bool)
+	for _, id := range fallbacks {
+		if id == "" {
+			return fmt.Errorf("Fallback browser can't be empty")
+		}
+		if seen[id] {
+			return fmt.Errorf("Fallback browser %s is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// validateRememberPosition checks the remember_position setting.
+func validateRememberPosition(position string) error {
+	switch position {
+	case "", rememberAtTop, rememberAtBottom:
+		return nil
+	}
+	return fmt.Errorf("Must be %q or %q, not %q", rememberAtTop, rememberAtBottom, position)
+}
+
+// validateConfig checks every rule, rewrite, custom target and scheme, the
+// fallback browsers and where remembered rules go in the config, and returns
+// all problems found, each naming what it's about.
+func validateConfig(cfg *Config) []error {
+	var problems []error
+	for i, rule := range cfg.Rules {
+		if err := validateRule(rule); err != nil {
+			problems = append(problems, fmt.Errorf("rule %d%s: %w", i+1, quotedName(rule.Name), err))
+		}
+	}
+	for i, rw := range cfg.Rewrites {
+		if err := validateRewrite(rw); err != nil {
+			problems = append(problems, fmt.Errorf("rewrite %d%s: %w", i+1, quotedName(rw.Name), err))
+		}
+	}
+	if err := validateFallbacks(cfg.FallbackBrowsers); err != nil {
+		problems = append(problems, fmt.Errorf("fallback_browsers: %w", err))
+	}
+	if err := validateRememberPosition(cfg.RememberPosition); err != nil {
+		problems = append(problems, fmt.Errorf("remember_position: %w", err))
+	}
+	targetIDs := make(map[string]bool)
+	for _, t := range cfg.Targets {
+		if err := validateCustomTarget(t); err != nil {
+			problems = append(problems, fmt.Errorf("target %q: %w", t.ID, err))
+		} else if targetIDs[t.ID] {
+			problems = append(problems, fmt.Errorf("target %q is listed more than once", t.ID))
+		}
+		targetIDs[t.ID] = true
+	}
+	seen := make(map[string]bool)
+	for _, h := range cfg.Schemes {
+		scheme, err := normalizeScheme(h.Scheme)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Errorf("scheme %q: %w", h.Scheme, err))
+		case scheme != h.Scheme:
+			problems = append(problems, fmt.Errorf("scheme %q: write it as %q", h.Scheme, scheme))
+		case seen[scheme]:
+			problems = append(problems, fmt.Errorf("scheme %q is listed more than once", h.Scheme))
+		}
+		seen[scheme] = true
+	}
+	return problems
+}
+
+// quotedName formats an optional name for error messages.
+func quotedName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%q)", name)
+}
@@ -303,6 +303,55 @@ func TestValidateConditionPattern(t *testing.T) {
 			pattern:  "",
 			wantErr:  true,
 		},
+		// Domain and subdomains type
+		{name: "valid domain suffix", condType: "domain_suffix", pattern: "example.com", wantErr: false},
+		{name: "domain suffix is public suffix", condType: "domain_suffix", pattern: "co.uk", wantErr: true},
+		{name: "domain suffix is tld", condType: "domain_suffix", pattern: "com", wantErr: true},
+		{name: "domain suffix is private public suffix", condType: "domain_suffix", pattern: "github.io", wantErr: true},
+		{name: "exact domain may be a public suffix", condType: "domain", pattern: "github.io", wantErr: false},
+		{name: "exact domain blogspot", condType: "domain", pattern: "blogspot.com", wantErr: false},
+		{name: "domain suffix wildcard", condType: "domain_suffix", pattern: "*.example.com", wantErr: true},
+		// URL component types
+		{name: "valid scheme", condType: "scheme", pattern: "https", wantErr: false},
+		{name: "valid scheme with plus", condType: "scheme", pattern: "git+ssh", wantErr: false},
+		{name: "scheme starting with digit", condType: "scheme", pattern: "1http", wantErr: true},
+		{name: "scheme with slash", condType: "scheme", pattern: "https://", wantErr: true},
+		{name: "valid host", condType: "host", pattern: "docs.google.com", wantErr: false},
+		{name: "valid host wildcard", condType: "host", pattern: "*.google.com", wantErr: false},
+		{name: "host with path", condType: "host", pattern: "google.com/docs", wantErr: true},
+		{name: "valid port", condType: "port", pattern: "8080", wantErr: false},
+		{name: "port zero", condType: "port", pattern: "0", wantErr: true},
+		{name: "port too large", condType: "port", pattern: "65536", wantErr: true},
+		{name: "port not a number", condType: "port", pattern: "http", wantErr: true},
+		{name: "valid path prefix", condType: "path_prefix", pattern: "/docs", wantErr: false},
+		{name: "relative path prefix", condType: "path_prefix", pattern: "docs", wantErr: true},
+		{name: "path prefix with query", condType: "path_prefix", pattern: "/docs?x=1", wantErr: true},
+		{name: "valid path glob", condType: "path_glob", pattern: "/*/pull/*", wantErr: false},
+		{name: "path glob bad class", condType: "path_glob", pattern: "/[a-", wantErr: true},
+		{name: "valid query presence", condType: "query", pattern: "debug", wantErr: false},
+		{name: "valid query value", condType: "query", pattern: "org=me", wantErr: false},
+		{name: "query without name", condType: "query", pattern: "=me", wantErr: true},
+		{name: "query with ampersand", condType: "query", pattern: "a=1&b=2", wantErr: true},
+		{name: "valid fragment", condType: "fragment", pattern: "#section", wantErr: false},
+		{name: "fragment only hash", condType: "fragment", pattern: "#", wantErr: true},
+		{name: "valid extension", condType: "extension", pattern: "pdf", wantErr: false},
+		{name: "valid extension with dot", condType: "extension", pattern: ".tar", wantErr: false},
+		{name: "extension with path", condType: "extension", pattern: "tar.gz", wantErr: true},
+		{name: "valid schedule", condType: "schedule", pattern: "mon-fri 09:00-17:00", wantErr: false},
+		{name: "schedule crossing midnight", condType: "schedule", pattern: "fri 22:00-02:00", wantErr: false},
+		{name: "empty schedule range", condType: "schedule", pattern: "mon 09:00-09:00", wantErr: true},
+		{name: "schedule unknown day", condType: "schedule", pattern: "funday", wantErr: true},
+		{name: "valid source app", condType: "source_app", pattern: "org.mozilla.Thunderbird", wantErr: false},
+		{name: "source app wildcard", condType: "source_app", pattern: "org.mozilla.*", wantErr: false},
+		{name: "source app with slash", condType: "source_app", pattern: "/usr/bin/slack", wantErr: true},
+		{name: "valid mail address", condType: "mail_to", pattern: "alice@example.com", wantErr: false},
+		{name: "valid mail domain", condType: "mail_to", pattern: "@example.com", wantErr: false},
+		{name: "valid mail domain without at", condType: "mail_cc", pattern: "example.com", wantErr: false},
+		{name: "mail address at a public suffix", condType: "mail_to", pattern: "alice@github.io", wantErr: false},
+		{name: "mail domain is public suffix", condType: "mail_to", pattern: "@co.uk", wantErr: true},
+		{name: "mail address without domain", condType: "mail_to", pattern: "alice@", wantErr: true},
+		{name: "mail address list", condType: "mail_to", pattern: "a@example.com,b@example.com", wantErr: true},
+		{name: "valid mail subject", condType: "mail_subject", pattern: "Invoice #42", wantErr: false},
 	}
 
 	for _, tt := range tests {
@@ -523,3 +572,101 @@ func TestValidateConditions(t *testing.T) {
 		})
 	}
 }
+
+// TestIsConditionGroupValid tests validation of nested condition groups
+func TestIsConditionGroupValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		group ConditionGroup
+		want  bool
+	}{
+		{
+			name:  "flat valid conditions",
+			group: ConditionGroup{Conditions: []Condition{{Type: "domain", Pattern: "example.com"}}},
+			want:  true,
+		},
+		{
+			name:  "empty group",
+			group: ConditionGroup{},
+			want:  false,
+		},
+		{
+			name: "valid nested group",
+			group: ConditionGroup{
+				Conditions: []Condition{{Type: "domain", Pattern: "github.com"}},
+				Groups: []ConditionGroup{
+					{Negate: true, Conditions: []Condition{{Type: "path_prefix", Pattern: "/personal"}}},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "only nested group",
+			group: ConditionGroup{
+				Groups: []ConditionGroup{{Conditions: []Condition{{Type: "keyword", Pattern: "x"}}}},
+			},
+			want: true,
+		},
+		{
+			name: "empty nested group",
+			group: ConditionGroup{
+				Conditions: []Condition{{Type: "domain", Pattern: "github.com"}},
+				Groups:     []ConditionGroup{{Negate: true}},
+			},
+			want: false,
+		},
+		{
+			name: "invalid condition in nested group",
+			group: ConditionGroup{
+				Groups: []ConditionGroup{{Conditions: []Condition{{Type: "regex", Pattern: "[bad"}}}},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConditionGroupValid(tt.group); got != tt.want {
+				t.Errorf("isConditionGroupValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateRule tests validation of whole rules
+func TestValidateRule(t *testing.T) {
+	github := []Condition{{Type: "domain", Pattern: "github.com"}}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "valid", rule: Rule{Browser: "firefox.desktop", Conditions: github}},
+		{name: "always ask without browser", rule: Rule{AlwaysAsk: true, Conditions: github}},
+		{name: "only groups", rule: Rule{Browser: "firefox.desktop", Groups: []ConditionGroup{{Conditions: github}}}},
+		{name: "no browser", rule: Rule{Conditions: github}, wantErr: true},
+		{name: "no conditions", rule: Rule{Browser: "firefox.desktop"}, wantErr: true},
+		{name: "unknown type", rule: Rule{Browser: "firefox.desktop", Conditions: []Condition{{Type: "color", Pattern: "red"}}}, wantErr: true},
+		{name: "invalid pattern", rule: Rule{Browser: "firefox.desktop", Conditions: []Condition{{Type: "port", Pattern: "http"}}}, wantErr: true},
+		{name: "invalid logic", rule: Rule{Browser: "firefox.desktop", Logic: "some", Conditions: github}, wantErr: true},
+		{name: "launch options", rule: Rule{Browser: "firefox.desktop", Action: "new-private-window", Args: []string{"--kiosk"}, Env: map[string]string{"MOZ_ENABLE_WAYLAND": "1"}, Conditions: github}},
+		{name: "invalid env name", rule: Rule{Browser: "firefox.desktop", Env: map[string]string{"MY-VAR": "1"}, Conditions: github}, wantErr: true},
+		{name: "fallbacks", rule: Rule{Browser: "firefox.desktop", Fallbacks: []string{"chromium.desktop", "custom:mpv"}, Conditions: github}},
+		{name: "empty fallback", rule: Rule{Browser: "firefox.desktop", Fallbacks: []string{""}, Conditions: github}, wantErr: true},
+		{name: "repeated fallback", rule: Rule{Browser: "firefox.desktop", Fallbacks: []string{"chromium.desktop", "chromium.desktop"}, Conditions: github}, wantErr: true},
+		{
+			name:    "invalid nested condition",
+			rule:    Rule{Browser: "firefox.desktop", Conditions: github, Groups: []ConditionGroup{{Conditions: []Condition{{Type: "regex", Pattern: "["}}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRule(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("validateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// historyPageLimit is how many of the newest matching entries the History page
+// lists, so a long history doesn't slow down the settings window.
+const historyPageLimit = 200
+
+// createHistoryPage shows the routed links recorded when history is turned
+// on, with search, and lets rules be created from them.
+func createHistoryPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.Widgetter {
+	// Use AdwToolbarView for proper page architecture
+	toolbarView := adw.NewToolbarView()
+
+	// Header for this page
+	header := adw.NewHeaderBar()
+	header.SetShowEndTitleButtons(true)
+	titleLabel := gtk.NewLabel("History")
+	titleLabel.AddCSSClass("title")
+	header.SetTitleWidget(titleLabel)
+	toolbarView.AddTopBar(header)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+
+	content := gtk.NewBox(gtk.OrientationVertical, 24)
+	content.SetMarginStart(24)
+	content.SetMarginEnd(24)
+	content.SetMarginTop(24)
+	content.SetMarginBottom(24)
+
+	clamp := adw.NewClamp()
+	clamp.SetMaximumSize(600)
+	clamp.SetChild(content)
+	scrolled.SetChild(clamp)
+
+	// Settings section
+	settingsGroup := adw.NewPreferencesGroup()
+	settingsGroup.SetTitle("Recording")
+	settingsGroup.SetDescription("Routed links are only kept on this computer, in " + historyPath())
+
+	enabledRow := adw.NewSwitchRow()
+	enabledRow.SetTitle("Keep history")
+	enabledRow.SetSubtitle("Record where each link was opened and which rule matched")
+	enabledRow.SetActive(cfg.History)
+	settingsGroup.Add(enabledRow)
+
+	hostOnlyRow := adw.NewSwitchRow()
+	hostOnlyRow.SetTitle("Only record sites")
+	hostOnlyRow.SetSubtitle("Keep the scheme and host instead of the whole link")
+	hostOnlyRow.SetActive(cfg.HistoryHostOnly)
+	settingsGroup.Add(hostOnlyRow)
+
+	daysRow := adw.NewSpinRowWithRange(1, 365, 1)
+	daysRow.SetTitle("Days to keep")
+	daysRow.SetValue(float64(cfg.HistoryDays))
+	settingsGroup.Add(daysRow)
+
+	maxRow := adw.NewSpinRowWithRange(10, 100000, 100)
+	maxRow.SetTitle("Maximum entries")
+	maxRow.SetValue(float64(cfg.HistoryMaxEntries))
+	settingsGroup.Add(maxRow)
+
+	updateSensitivity := func() {
+		hostOnlyRow.SetSensitive(cfg.History)
+		daysRow.SetSensitive(cfg.History)
+		maxRow.SetSensitive(cfg.History)
+	}
+	updateSensitivity()
+	content.Append(settingsGroup)
+
+	// Entries section
+	entriesGroup := adw.NewPreferencesGroup()
+	entriesGroup.SetTitle("Recent Links")
+
+	clearBtn := gtk.NewButtonFromIconName("user-trash-symbolic")
+	clearBtn.SetTooltipText("Clear History")
+	clearBtn.AddCSSClass("flat")
+	clearBtn.SetVAlign(gtk.AlignCenter)
+	entriesGroup.SetHeaderSuffix(clearBtn)
+
+	searchEntry := gtk.NewSearchEntry()
+	searchEntry.SetPlaceholderText("Search links, browsers and rules")
+	searchEntry.SetMarginBottom(12)
+	entriesGroup.Add(searchEntry)
+
+	entriesList := gtk.NewListBox()
+	entriesList.SetSelectionMode(gtk.SelectionNone)
+	entriesList.AddCSSClass("boxed-list")
+	entriesGroup.Add(entriesList)
+
+	emptyState := adw.NewStatusPage()
+	emptyState.SetIconName("document-open-recent-symbolic")
+	emptyState.SetTitle("No History")
+	emptyState.AddCSSClass("compact")
+	entriesGroup.Add(emptyState)
+	content.Append(entriesGroup)
+
+	name := func(id string) string {
+		if browser := findBrowserByID(browsers, id); browser != nil {
+			return browser.Name
+		}
+		return id
+	}
+
+	entries := loadHistory()
+	var rows []*adw.ActionRow
+
+	rebuild := func() {
+		for _, row := range rows {
+			entriesList.Remove(row)
+		}
+		rows = nil
+
+		found := searchHistory(entries, searchEntry.Text(), name)
+		switch {
+		case len(entries) == 0 && !cfg.History:
+			emptyState.SetDescription("Turn on history to see where links were opened")
+		case len(entries) == 0:
+			emptyState.SetDescription("Links will show up here once they're opened")
+		default:
+			emptyState.SetDescription("No links match your search")
+		}
+		emptyState.SetVisible(len(found) == 0)
+		entriesList.SetVisible(len(found) > 0)
+		clearBtn.SetSensitive(len(entries) > 0)
+
+		if len(found) > historyPageLimit {
+			found = found[:historyPageLimit]
+		}
+		for _, entry := range found {
+			entry := entry // capture
+			row := adw.NewActionRow()
+			row.SetUseMarkup(false)
+			row.SetTitle(entry.URL)
+			row.SetTitleLines(1)
+			row.SetTooltipText(entry.URL)
+			row.SetSubtitle(formatHistorySubtitle(entry, name(entry.Browser)))
+
+			if browser := findBrowserByID(browsers, entry.Browser); browser != nil {
+				row.AddPrefix(loadBrowserIcon(browser, 24))
+			} else {
+				icon := gtk.NewImageFromIconName("web-browser-symbolic")
+				icon.SetPixelSize(24)
+				row.AddPrefix(icon)
+			}
+
+			createRuleBtn := gtk.NewButtonFromIconName("list-add-symbolic")
+			createRuleBtn.SetTooltipText("Create Rule from Entry")
+			createRuleBtn.AddCSSClass("flat")
+			createRuleBtn.SetVAlign(gtk.AlignCenter)
+			// Links that can't be parsed have nothing to base a rule on
+			createRuleBtn.SetSensitive(entry.ruleTemplate() != nil)
+			createRuleBtn.ConnectClicked(func() {
+				showAddRuleDialog(win, cfg, browsers, entry.ruleTemplate(), func() {})
+			})
+			row.AddSuffix(createRuleBtn)
+
+			entriesList.Append(row)
+			rows = append(rows, row)
+		}
+	}
+	rebuild()
+
+	searchEntry.ConnectSearchChanged(rebuild)
+
+	clearBtn.ConnectClicked(func() {
+		dialog := adw.NewAlertDialog("Clear History?", "All recorded links will be deleted.")
+		dialog.AddResponse("cancel", "Cancel")
+		dialog.AddResponse("clear", "Clear")
+		dialog.SetResponseAppearance("clear", adw.ResponseDestructive)
+		dialog.SetDefaultResponse("cancel")
+		dialog.SetCloseResponse("cancel")
+		dialog.ConnectResponse(func(response string) {
+			if response != "clear" {
+				return
+			}
+			if err := clearHistory(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to clear history: %v\n", err)
+				return
+			}
+			entries = nil
+			rebuild()
+		})
+		dialog.Present(win)
+	})
+
+	enabledRow.Connect("notify::active", func() {
+		cfg.History = enabledRow.Active()
+		updateSensitivity()
+		saveConfigWithFlag(cfg)
+		rebuild()
+	})
+
+	hostOnlyRow.Connect("notify::active", func() {
+		cfg.HistoryHostOnly = hostOnlyRow.Active()
+		saveConfigWithFlag(cfg)
+	})
+
+	daysRow.Connect("notify::value", func() {
+		cfg.HistoryDays = int(daysRow.Value())
+		saveConfigWithFlag(cfg)
+	})
+
+	maxRow.Connect("notify::value", func() {
+		cfg.HistoryMaxEntries = int(maxRow.Value())
+		saveConfigWithFlag(cfg)
+	})
+
+	toolbarView.SetContent(scrolled)
+	return toolbarView
+}
@@ -5,6 +5,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
@@ -16,8 +18,18 @@ import (
 	"github.com/diamondburned/gotk4/pkg/pango"
 )
 
-// showPickerWindow displays the browser picker window
-func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
+// pickerLink is one of several links shown in the picker, waiting to be opened.
+type pickerLink struct {
+	url   string
+	row   *adw.ActionRow
+	check *gtk.CheckButton
+}
+
+// showPickerWindow displays the browser picker window. With several URLs, they
+// are listed so each can be opened in a different browser, or all in one.
+// source is the app that opened the URLs, shown so rules can be created for it,
+// or nil if unknown.
+func showPickerWindow(app *adw.Application, urls []string, browsers []*Browser, source *sourceApp) {
 	cfg := loadConfig()
 
 	// Filter hidden_browsers from the list
@@ -44,6 +56,9 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 		}
 	}
 
+	// Profiles are offered in each browser's right-click menu
+	profiles := detectProfiles(filteredBrowsers)
+
 	win := adw.NewWindow()
 	win.SetTitle("Switchyard")
 	win.SetApplication(&app.Application)
@@ -53,13 +68,173 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 
 	// Create URL entry early so it can be referenced in button handlers
 	urlEntry := gtk.NewEntry()
-	urlEntry.SetText(url)
+	urlEntry.SetText(urls[0])
 	urlEntry.SetEditable(true)
 	urlEntry.SetCanFocus(true)
 	urlEntry.SetAlignment(0.5)
 	urlEntry.SetMaxWidthChars(50)
 	urlEntry.SetWidthChars(40)
 
+	// With several links, list them so they can be opened a few at a time
+	var links []*pickerLink
+	var linkList *gtk.ListBox
+	linkCount := gtk.NewLabel("")
+	linkCount.AddCSSClass("dim-label")
+	updateLinkCount := func() {
+		linkCount.SetText(fmt.Sprintf("%d links", len(links)))
+	}
+	if len(urls) > 1 {
+		linkList = gtk.NewListBox()
+		linkList.SetSelectionMode(gtk.SelectionNone)
+		linkList.AddCSSClass("boxed-list")
+		for _, u := range urls {
+			link := &pickerLink{url: u, row: adw.NewActionRow(), check: gtk.NewCheckButton()}
+			link.check.SetActive(true)
+			link.check.SetVAlign(gtk.AlignCenter)
+			link.row.SetUseMarkup(false)
+			link.row.SetTitle(u)
+			link.row.SetTitleLines(1)
+			link.row.SetTooltipText(u)
+			link.row.AddPrefix(link.check)
+			link.row.SetActivatableWidget(link.check)
+			linkList.Append(link.row)
+			links = append(links, link)
+		}
+		updateLinkCount()
+	}
+
+	// selectedURLs returns the URLs a browser should open: the entry's text, or
+	// the checked links when there are several
+	selectedURLs := func() []string {
+		if linkList == nil {
+			return []string{urlEntry.Text()}
+		}
+		var selected []string
+		for _, link := range links {
+			if link.check.Active() {
+				selected = append(selected, link.url)
+			}
+		}
+		return selected
+	}
+
+	// With a single link, the chosen browser can be remembered as a new rule
+	rememberCheck := gtk.NewCheckButtonWithLabel("Remember for this site")
+	rememberScopes := []rememberScope{rememberHost, rememberDomain, rememberPrefix}
+	scopeDropdown := gtk.NewDropDown(gtk.NewStringList([]string{"Exact host", "Whole domain", "URL prefix"}), nil)
+	scopeDropdown.SetTooltipText("Which links the new rule opens in the chosen browser")
+	scopeDropdown.SetSensitive(false)
+	rememberCheck.ConnectToggled(func() {
+		scopeDropdown.SetSensitive(rememberCheck.Active())
+	})
+
+	// Links without a host, like mailto:, or with an IPv6 address can't be
+	// remembered
+	updateRememberable := func() {
+		ok := rememberable(urlEntry.Text())
+		rememberCheck.SetSensitive(ok)
+		if !ok {
+			rememberCheck.SetActive(false)
+		}
+	}
+	updateRememberable()
+	urlEntry.ConnectChanged(updateRememberable)
+
+	// rememberChoice adds a rule opening links like the entry's in browserID.
+	// The config is read again so changes made elsewhere since the picker
+	// opened aren't lost, and nothing is saved if it can't be read.
+	rememberChoice := func(browserID string) {
+		rule, err := rememberRule(urlEntry.Text(), rememberScopes[scopeDropdown.Selected()], browserID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to remember the browser: %v\n", err)
+			sendNotification(app, "Couldn't remember the browser", err.Error())
+			return
+		}
+		current, err := readConfig(configPath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to remember the browser: %v\n", err)
+			sendNotification(app, "Couldn't remember the browser", "The config couldn't be read: "+err.Error())
+			return
+		}
+		current.addRememberedRule(rule)
+		saveConfigWithFlag(current)
+	}
+
+	// Links an always ask rule sent here can skip the picker for a while
+	stickyMinutes := cfg.StickyMinutes
+	if stickyMinutes <= 0 {
+		stickyMinutes = defaultStickyMinutes
+	}
+	stickyDomains := cfg.stickyDomains(urls, source)
+	stickyDropdown := gtk.NewDropDown(gtk.NewStringList([]string{
+		"Just this once",
+		fmt.Sprintf("For %d minutes", stickyMinutes),
+		"For this session",
+	}), nil)
+	stickyDropdown.SetTooltipText("How long the chosen browser is used without asking")
+
+	// rememberSticky keeps browserID for the domains of urls that an always
+	// ask rule sent to the picker, if a duration was chosen
+	rememberSticky := func(urls []string, browserID string) {
+		minutes := 0
+		switch stickyDropdown.Selected() {
+		case 0:
+			return
+		case 1:
+			minutes = stickyMinutes
+		}
+		domains := cfg.stickyDomains(urls, source)
+		if len(domains) == 0 {
+			return
+		}
+		if err := addStickyChoices(domains, newStickyChoice(browserID, minutes)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Failed to save sticky choice: %v\n", err)
+		}
+	}
+
+	// openSelected launches the selected URLs in a browser and closes the picker
+	// once every link has been opened. Links left over are selected for the next
+	// browser. If the browser fails to start, the picker stays open to choose
+	// another.
+	openSelected := func(browserID string, launch func(urls []string) error) {
+		selected := selectedURLs()
+		if len(selected) == 0 {
+			return
+		}
+		if err := launch(selected); err != nil {
+			fmt.Fprintf(os.Stderr, "Error launching browser: %v\n", err)
+			sendNotification(app, "Couldn't open the browser", err.Error()+". Choose another browser.")
+			return
+		}
+		cfg.recordHistory(cfg.historyEntries(selected, cfg.pickerRules(selected, source), browserID, true))
+		rememberSticky(selected, browserID)
+		if linkList == nil {
+			if rememberCheck.Active() {
+				rememberChoice(browserID)
+			}
+			win.Close()
+			return
+		}
+
+		remaining := links[:0]
+		for _, link := range links {
+			if link.check.Active() {
+				linkList.Remove(link.row)
+			} else {
+				remaining = append(remaining, link)
+			}
+		}
+		links = remaining
+		if len(links) == 0 {
+			win.Close()
+			return
+		}
+		for _, link := range links {
+			link.check.SetActive(true)
+		}
+		updateLinkCount()
+	}
+
 	// Content box with margins
 	contentBox := gtk.NewBox(gtk.OrientationVertical, 0)
 	contentBox.SetMarginStart(12)
@@ -137,17 +312,14 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 		btn.SetChild(btnBox)
 
 		btn.ConnectClicked(func() {
-			currentURL := urlEntry.Text()
-			launchBrowser(b, currentURL)
-			win.Close()
+			openSelected(b.ID, func(urls []string) error { return launchBrowserURLs(b, urls) })
 		})
 
 		// Add right-click handler for desktop file actions
 		gesture := gtk.NewGestureClick()
 		gesture.SetButton(gdk.BUTTON_SECONDARY)
 		gesture.ConnectPressed(func(nPress int, x, y float64) {
-			currentURL := urlEntry.Text()
-			showBrowserActionsMenu(btn, b, currentURL)
+			showBrowserActionsMenu(btn, b, profiles)
 		})
 		btn.AddController(gesture)
 
@@ -158,9 +330,8 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 	flowBox.ConnectChildActivated(func(child *gtk.FlowBoxChild) {
 		idx := child.Index()
 		if idx >= 0 && idx < len(filteredBrowsers) {
-			currentURL := urlEntry.Text()
-			launchBrowser(filteredBrowsers[idx], currentURL)
-			win.Close()
+			b := filteredBrowsers[idx]
+			openSelected(b.ID, func(urls []string) error { return launchBrowserURLs(b, urls) })
 		}
 	})
 
@@ -172,6 +343,71 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 	contentBox.Append(flowBox)
 	mainBox.Append(contentBox)
 
+	if linkList == nil {
+		rememberBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		rememberBox.SetHAlign(gtk.AlignCenter)
+		rememberBox.SetMarginTop(8)
+		rememberBox.Append(rememberCheck)
+		rememberBox.Append(scopeDropdown)
+		mainBox.Append(rememberBox)
+	}
+
+	if len(stickyDomains) > 0 {
+		stickyBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		stickyBox.SetHAlign(gtk.AlignCenter)
+		stickyBox.SetMarginTop(8)
+
+		target := "these sites"
+		if len(stickyDomains) == 1 {
+			target = stickyDomains[0]
+		}
+		stickyLabel := gtk.NewLabel("Use the chosen browser for " + target)
+		stickyLabel.SetEllipsize(pango.EllipsizeEnd)
+		stickyBox.Append(stickyLabel)
+		stickyBox.Append(stickyDropdown)
+		mainBox.Append(stickyBox)
+	}
+
+	if linkList != nil {
+		scrolled := gtk.NewScrolledWindow()
+		scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+		scrolled.SetPropagateNaturalHeight(true)
+		scrolled.SetMaxContentHeight(200)
+		scrolled.SetMarginStart(12)
+		scrolled.SetMarginEnd(12)
+		scrolled.SetMarginTop(8)
+		scrolled.SetChild(linkList)
+		mainBox.Append(scrolled)
+	}
+
+	// Show where the link came from, with a shortcut to route it next time
+	if source != nil {
+		sourceBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		sourceBox.SetHAlign(gtk.AlignCenter)
+		sourceBox.SetMarginTop(8)
+
+		sourceName := sourceDisplayName(source)
+		sourceLabel := gtk.NewLabel("Opened from " + sourceName)
+		sourceLabel.AddCSSClass("dim-label")
+		sourceLabel.SetEllipsize(pango.EllipsizeEnd)
+		sourceBox.Append(sourceLabel)
+
+		createRuleBtn := gtk.NewButtonWithLabel("Create Rule…")
+		createRuleBtn.AddCSSClass("flat")
+		createRuleBtn.SetTooltipText("Add a rule for links opened from " + sourceName)
+		createRuleBtn.ConnectClicked(func() {
+			template := &Rule{
+				Name:       "Opened from " + sourceName,
+				Logic:      "all",
+				Conditions: []Condition{{Type: "source_app", Pattern: source.conditionPattern()}},
+			}
+			showAddRuleDialog(win, cfg, browsers, template, func() {})
+		})
+		sourceBox.Append(createRuleBtn)
+
+		mainBox.Append(sourceBox)
+	}
+
 	// Bottom bar with hamburger menu, URL, and close button
 	bottomBar := gtk.NewBox(gtk.OrientationHorizontal, 12)
 	bottomBar.SetMarginStart(8)
@@ -206,8 +442,12 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 	leftSpacer.SetHExpand(true)
 	bottomBar.Append(leftSpacer)
 
-	// Append the URL entry we created earlier
-	bottomBar.Append(urlEntry)
+	// Append the URL entry we created earlier, or how many links are left
+	if linkList == nil {
+		bottomBar.Append(urlEntry)
+	} else {
+		bottomBar.Append(linkCount)
+	}
 
 	// Spacer after URL (to center it)
 	rightSpacer := gtk.NewBox(gtk.OrientationHorizontal, 0)
@@ -234,9 +474,8 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 		if keyval >= gdk.KEY_1 && keyval <= gdk.KEY_9 && state&gdk.ControlMask != 0 {
 			idx := int(keyval - gdk.KEY_1)
 			if idx < len(filteredBrowsers) {
-				currentURL := urlEntry.Text()
-				launchBrowser(filteredBrowsers[idx], currentURL)
-				win.Close()
+				b := filteredBrowsers[idx]
+				openSelected(b.ID, func(urls []string) error { return launchBrowserURLs(b, urls) })
 				return true
 			}
 		}
@@ -293,15 +532,16 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 			return
 		}
 
-		// Parse "browserID:actionID" from the parameter
+		// Parse "browserID:actionID" from the parameter. Browser IDs may
+		// contain colons, like custom:mpv, but action IDs can't.
 		actionSpec := param.String()
-		parts := strings.Split(actionSpec, ":")
-		if len(parts) != 2 {
+		sep := strings.LastIndex(actionSpec, ":")
+		if sep == -1 {
 			return
 		}
 
-		browserID := parts[0]
-		actionID := parts[1]
+		browserID := actionSpec[:sep]
+		actionID := actionSpec[sep+1:]
 
 		// Find the browser
 		var selectedBrowser *Browser
@@ -317,28 +557,39 @@ func showPickerWindow(app *adw.Application, url string, browsers []*Browser) {
 		}
 
 		// Find the action and launch it
-		actions := ListDesktopActions(selectedBrowser.AppInfo)
+		actions := selectedBrowser.desktopActions()
 		for _, action := range actions {
 			if action.ID == actionID {
-				launchBrowserAction(selectedBrowser, action, url)
-				win.Close()
+				openSelected(selectedBrowser.ID, func(urls []string) error {
+					return launchBrowserWith(selectedBrowser, urls, launchOptions{Action: action.ID})
+				})
 				return
 			}
 		}
 	})
 	actionGroup.AddAction(launchActionAction)
 
+	// Action to launch a browser profile, the parameter is its target ID
+	launchProfileAction := gio.NewSimpleAction("launch-profile", glib.NewVariantType("s"))
+	launchProfileAction.ConnectActivate(func(param *glib.Variant) {
+		if param == nil {
+			return
+		}
+		if profile := findBrowserByID(profiles, param.String()); profile != nil {
+			openSelected(profile.ID, func(urls []string) error { return launchBrowserURLs(profile, urls) })
+		}
+	})
+	actionGroup.AddAction(launchProfileAction)
+
 	win.InsertActionGroup("win", actionGroup)
 
 	win.Present()
 }
 
-// showBrowserActionsMenu shows a context menu with desktop file actions
-func showBrowserActionsMenu(btn *gtk.Button, browser *Browser, url string) {
-	actions := ListDesktopActions(browser.AppInfo)
-	if len(actions) == 0 {
-		return
-	}
+// showBrowserActionsMenu shows a context menu with desktop file actions and
+// the browser's profiles, out of all the detected profiles
+func showBrowserActionsMenu(btn *gtk.Button, browser *Browser, profiles []*Browser) {
+	actions := browser.desktopActions()
 
 	// Build menu model
 	menu := gio.NewMenu()
@@ -346,7 +597,30 @@ func showBrowserActionsMenu(btn *gtk.Button, browser *Browser, url string) {
 	// Add desktop file actions
 	for _, action := range actions {
 		// Use the action ID as a unique identifier for the action
-		menu.Append(action.Name, fmt.Sprintf("win.launch-action::%s:%s", browser.ID, action.ID))
+		item := gio.NewMenuItem(action.Name, fmt.Sprintf("win.launch-action::%s:%s", browser.ID, action.ID))
+		if action.Icon != "" {
+			if filepath.IsAbs(action.Icon) {
+				item.SetIcon(gio.NewFileIcon(gio.NewFileForPath(action.Icon)))
+			} else {
+				item.SetIcon(gio.NewThemedIcon(action.Icon))
+			}
+		}
+		menu.AppendItem(item)
+	}
+
+	// Add profiles in their own section
+	profileSection := gio.NewMenu()
+	for _, p := range profiles {
+		if strings.HasPrefix(p.ID, browser.ID+"#") {
+			profileSection.Append(p.Profile, "win.launch-profile::"+p.ID)
+		}
+	}
+	if profileSection.NItems() > 0 {
+		menu.AppendSection("Profiles", profileSection)
+	}
+
+	if menu.NItems() == 0 {
+		return
 	}
 
 	// Create and show popover
@@ -368,3 +642,25 @@ func showShortcutsDialog(parent *adw.Window) {
 
 	dialog.Present(parent)
 }
+
+// sourceDisplayName returns a human-readable name for the app that opened a link,
+// using its desktop file when one is known.
+func sourceDisplayName(source *sourceApp) string {
+	ids := map[string]bool{}
+	for _, id := range []string{source.DesktopID, source.FlatpakID} {
+		if id != "" {
+			ids[id+".desktop"] = true
+		}
+	}
+	if len(ids) > 0 {
+		for _, info := range gio.AppInfoGetAll() {
+			if ids[info.ID()] {
+				return info.Name()
+			}
+		}
+	}
+	if source.Exe != "" {
+		return source.Exe
+	}
+	return "a terminal"
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// createSchemesPage lists the schemes routed besides http and https, with
+// switches to register Switchyard as their handler.
+func createSchemesPage(cfg *Config) gtk.Widgetter {
+	// Use AdwToolbarView for proper page architecture
+	toolbarView := adw.NewToolbarView()
+
+	// Header for this page
+	header := adw.NewHeaderBar()
+	header.SetShowEndTitleButtons(true)
+	titleLabel := gtk.NewLabel("Schemes")
+	titleLabel.AddCSSClass("title")
+	header.SetTitleWidget(titleLabel)
+	toolbarView.AddTopBar(header)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+
+	content := gtk.NewBox(gtk.OrientationVertical, 24)
+	content.SetMarginStart(24)
+	content.SetMarginEnd(24)
+	content.SetMarginTop(24)
+	content.SetMarginBottom(24)
+
+	clamp := adw.NewClamp()
+	clamp.SetMaximumSize(600)
+	clamp.SetChild(content)
+	scrolled.SetChild(clamp)
+
+	schemesGroup := adw.NewPreferencesGroup()
+	schemesGroup.SetTitle("Routed Schemes")
+	schemesGroup.SetDescription("Switchyard always routes http and https links. Add other schemes, like mailto or tel, to route their links with rules using the Scheme condition.")
+	content.Append(schemesGroup)
+
+	suggestionsGroup := adw.NewPreferencesGroup()
+	suggestionsGroup.SetTitle("Suggestions")
+	content.Append(suggestionsGroup)
+
+	addRow := adw.NewEntryRow()
+	addRow.SetTitle("Add Scheme")
+	addRow.SetShowApplyButton(true)
+
+	var schemeRows []*adw.ExpanderRow
+	var suggestionRows []*adw.ActionRow
+	var rebuild func()
+
+	addScheme := func(input string) {
+		scheme, err := normalizeScheme(input)
+		if err != nil {
+			addRow.AddCSSClass("error")
+			addRow.SetTooltipText(err.Error())
+			return
+		}
+		addRow.RemoveCSSClass("error")
+		addRow.SetTooltipText("")
+		if cfg.schemeHandler(scheme) == nil {
+			cfg.Schemes = append(cfg.Schemes, SchemeHandler{Scheme: scheme})
+			saveConfigWithFlag(cfg)
+		}
+		addRow.SetText("")
+		rebuild()
+	}
+	addRow.ConnectApply(func() {
+		addScheme(addRow.Text())
+	})
+
+	createSchemeRow := func(scheme string) *adw.ExpanderRow {
+		handlers := detectHandlers(scheme)
+
+		row := adw.NewExpanderRow()
+		row.SetTitle(scheme + ":")
+
+		registered := isSchemeRegistered(scheme)
+		updateSubtitle := func() {
+			if registered {
+				row.SetSubtitle("Opened with Switchyard")
+			} else {
+				row.SetSubtitle("Not opened with Switchyard")
+			}
+		}
+		updateSubtitle()
+
+		registerRow := adw.NewSwitchRow()
+		registerRow.SetTitle("Open with Switchyard")
+		registerRow.SetSubtitle(fmt.Sprintf("Make Switchyard the default app for %s links", scheme))
+		registerRow.SetActive(registered)
+		row.AddRow(registerRow)
+
+		// Fallback app dropdown
+		names := make([]string, len(handlers)+1)
+		names[0] = "None"
+		for i, b := range handlers {
+			names[i+1] = b.Name
+		}
+		fallbackRow := adw.NewComboRow()
+		fallbackRow.SetTitle("Fallback app")
+		fallbackRow.SetSubtitle("Opens links no rule matches, instead of the picker")
+		fallbackRow.SetModel(gtk.NewStringList(names))
+		selectFallback := func() {
+			selected := uint(0)
+			if h := cfg.schemeHandler(scheme); h != nil {
+				for i, b := range handlers {
+					if b.ID == h.Fallback {
+						selected = uint(i + 1)
+						break
+					}
+				}
+			}
+			fallbackRow.SetSelected(selected)
+		}
+		selectFallback()
+		row.AddRow(fallbackRow)
+
+		removeRow := adw.NewActionRow()
+		removeRow.SetTitle("Remove Scheme")
+		removeRow.SetActivatable(true)
+		removeRow.AddCSSClass("error")
+		removeRow.AddSuffix(gtk.NewImageFromIconName("edit-delete-symbolic"))
+		row.AddRow(removeRow)
+
+		candidates := func() []string {
+			var ids []string
+			for _, b := range handlers {
+				ids = append(ids, b.ID)
+			}
+			return ids
+		}
+
+		registerRow.Connect("notify::active", func() {
+			if registerRow.Active() == registered {
+				return
+			}
+			var err error
+			if registerRow.Active() {
+				err = cfg.registerScheme(scheme)
+			} else {
+				err = cfg.unregisterScheme(scheme, candidates())
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to change the default app for %s links: %v\n", scheme, err)
+				registerRow.SetActive(registered)
+				return
+			}
+			registered = registerRow.Active()
+			saveConfigWithFlag(cfg) // registering may have set the fallback app
+			selectFallback()
+			updateSubtitle()
+		})
+
+		fallbackRow.Connect("notify::selected", func() {
+			h := cfg.schemeHandler(scheme)
+			if h == nil {
+				return
+			}
+			idx := fallbackRow.Selected()
+			if idx == 0 {
+				h.Fallback = ""
+			} else if int(idx) <= len(handlers) {
+				h.Fallback = handlers[idx-1].ID
+			}
+			saveConfigWithFlag(cfg)
+		})
+
+		removeRow.ConnectActivated(func() {
+			if registered {
+				if err := cfg.unregisterScheme(scheme, candidates()); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to unregister %s links: %v\n", scheme, err)
+				}
+			}
+			for i, h := range cfg.Schemes {
+				if h.Scheme == scheme {
+					cfg.Schemes = append(cfg.Schemes[:i], cfg.Schemes[i+1:]...)
+					break
+				}
+			}
+			saveConfigWithFlag(cfg)
+			rebuild()
+		})
+
+		return row
+	}
+
+	rebuild = func() {
+		for _, row := range schemeRows {
+			schemesGroup.Remove(row)
+		}
+		for _, row := range suggestionRows {
+			suggestionsGroup.Remove(row)
+		}
+		schemeRows, suggestionRows = nil, nil
+		if addRow.Parent() != nil {
+			schemesGroup.Remove(addRow)
+		}
+
+		for _, h := range cfg.Schemes {
+			row := createSchemeRow(h.Scheme)
+			schemesGroup.Add(row)
+			schemeRows = append(schemeRows, row)
+		}
+		schemesGroup.Add(addRow)
+
+		for _, scheme := range suggestedSchemes {
+			if cfg.schemeHandler(scheme) != nil {
+				continue
+			}
+			scheme := scheme // capture
+			row := adw.NewActionRow()
+			row.SetTitle(scheme + ":")
+			row.SetActivatable(true)
+			row.AddSuffix(gtk.NewImageFromIconName("list-add-symbolic"))
+			row.ConnectActivated(func() {
+				addScheme(scheme)
+			})
+			suggestionsGroup.Add(row)
+			suggestionRows = append(suggestionRows, row)
+		}
+		suggestionsGroup.SetVisible(len(suggestionRows) > 0)
+	}
+	rebuild()
+
+	toolbarView.SetContent(scrolled)
+	return toolbarView
+}
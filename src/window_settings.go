@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
@@ -14,6 +15,18 @@ import (
 )
 
 func showSettingsWindow(app *adw.Application) {
+	openSettingsWindow(app, 0)
+}
+
+// showRuleEditor opens the settings window on the Rules page, editing the rule
+// at a 1-based position, e.g. from the notification of a routed link.
+func showRuleEditor(app *adw.Application, ruleIndex int) {
+	openSettingsWindow(app, ruleIndex)
+}
+
+// openSettingsWindow shows the settings window, on the Rules page with a rule's
+// editor open if editRule is its 1-based position, or on Appearance if 0.
+func openSettingsWindow(app *adw.Application, editRule int) {
 	win := adw.NewWindow()
 	win.SetTitle("Switchyard")
 	win.SetApplication(&app.Application)
@@ -24,7 +37,7 @@ func showSettingsWindow(app *adw.Application) {
 	win.SetSizeRequest(700, 500)
 
 	cfg := loadConfig()
-	browsers := detectBrowsers()
+	browsers := cfg.withCustomTargets(detectBrowsers())
 
 	// Setup app-level actions
 	setupAppActions(app, win)
@@ -36,11 +49,14 @@ func showSettingsWindow(app *adw.Application) {
 	splitView.SetMaxSidebarWidth(200)
 
 	// Sidebar
-	sidebarPage := adw.NewNavigationPage(createSidebar(win, cfg, browsers, splitView), "Switchyard")
+	sidebarPage := adw.NewNavigationPage(createSidebar(win, cfg, browsers, splitView, editRule > 0), "Switchyard")
 	splitView.SetSidebar(sidebarPage)
 
 	// Initial content - show Appearance page by default
 	contentPage := adw.NewNavigationPage(createAppearancePage(win, cfg), "Appearance")
+	if editRule > 0 {
+		contentPage = adw.NewNavigationPage(createRulesPage(win, cfg, ruleTargets(cfg), editRule), "Rules")
+	}
 	splitView.SetContent(contentPage)
 
 	win.SetContent(splitView)
@@ -84,7 +100,7 @@ func setupAppActions(app *adw.Application, win *adw.Window) {
 	app.SetAccelsForAction("app.quit", []string{"<Ctrl>q"})
 }
 
-func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView *adw.NavigationSplitView) gtk.Widgetter {
+func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView *adw.NavigationSplitView, showRules bool) gtk.Widgetter {
 	// Use AdwToolbarView for proper sidebar architecture
 	toolbarView := adw.NewToolbarView()
 
@@ -142,6 +158,24 @@ func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView
 	rulesRow.AddPrefix(gtk.NewImageFromIconName("view-list-symbolic"))
 	listBox.Append(rulesRow)
 
+	// Rewrites row
+	rewritesRow := adw.NewActionRow()
+	rewritesRow.SetTitle("Rewrites")
+	rewritesRow.AddPrefix(gtk.NewImageFromIconName("edit-find-replace-symbolic"))
+	listBox.Append(rewritesRow)
+
+	// Schemes row
+	schemesRow := adw.NewActionRow()
+	schemesRow.SetTitle("Schemes")
+	schemesRow.AddPrefix(gtk.NewImageFromIconName("mail-send-symbolic"))
+	listBox.Append(schemesRow)
+
+	// History row
+	historyRow := adw.NewActionRow()
+	historyRow.SetTitle("History")
+	historyRow.AddPrefix(gtk.NewImageFromIconName("document-open-recent-symbolic"))
+	listBox.Append(historyRow)
+
 	// Advanced row
 	advancedRow := adw.NewActionRow()
 	advancedRow.SetTitle("Advanced")
@@ -152,7 +186,11 @@ func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView
 	toolbarView.SetContent(scrolled)
 
 	// Select first item by default
-	listBox.SelectRow(listBox.RowAtIndex(0))
+	if showRules {
+		listBox.SelectRow(listBox.RowAtIndex(2))
+	} else {
+		listBox.SelectRow(listBox.RowAtIndex(0))
+	}
 
 	// Handle navigation - need to connect to both activated and selected
 	navigateToPage := func(index int) {
@@ -167,9 +205,18 @@ func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView
 			page = createBehaviorPage(win, cfg, browsers)
 			title = "Behavior"
 		case 2: // Rules
-			page = createRulesPage(win, cfg, browsers)
+			page = createRulesPage(win, cfg, ruleTargets(cfg), 0)
 			title = "Rules"
-		case 3: // Advanced
+		case 3: // Rewrites
+			page = createRewritesPage(win, cfg)
+			title = "Rewrites"
+		case 4: // Schemes
+			page = createSchemesPage(cfg)
+			title = "Schemes"
+		case 5: // History
+			page = createHistoryPage(win, cfg, ruleTargets(cfg))
+			title = "History"
+		case 6: // Advanced
 			page = createAdvancedPage(win, cfg)
 			title = "Advanced"
 		}
@@ -194,7 +241,7 @@ func createSidebar(win *adw.Window, cfg *Config, browsers []*Browser, splitView
 }
 
 func createAppearancePage(win *adw.Window, cfg *Config) gtk.Widgetter {
-	browsers := detectBrowsers()
+	browsers := cfg.withCustomTargets(detectBrowsers())
 
 	// Use AdwToolbarView for proper page architecture
 	toolbarView := adw.NewToolbarView()
@@ -320,6 +367,12 @@ func createBehaviorPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.W
 	promptRow.SetActive(cfg.PromptOnClick)
 	behaviorGroup.Add(promptRow)
 
+	notifyRow := adw.NewSwitchRow()
+	notifyRow.SetTitle("Notify when a rule opens links")
+	notifyRow.SetSubtitle("Show where links went, with actions to open them elsewhere or edit the rule")
+	notifyRow.SetActive(cfg.NotifyOnRoute)
+	behaviorGroup.Add(notifyRow)
+
 	// Favorite browser dropdown
 	browserNames := make([]string, len(browsers)+1)
 	browserNames[0] = "None"
@@ -344,6 +397,22 @@ func createBehaviorPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.W
 	defaultRow.SetSelected(selectedIndex)
 
 	behaviorGroup.Add(defaultRow)
+
+	fallbacksRow := createFallbacksRow("Fallback browsers", "Tried in order when a browser is missing or fails to start",
+		cfg.FallbackBrowsers, browsers, func(ids []string) {
+			cfg.FallbackBrowsers = ids
+			saveConfigWithFlag(cfg)
+		})
+	behaviorGroup.Add(fallbacksRow)
+
+	rememberRow := adw.NewComboRow()
+	rememberRow.SetTitle("Remembered sites go")
+	rememberRow.SetSubtitle("Where rules for sites remembered in the picker are added")
+	rememberRow.SetModel(gtk.NewStringList([]string{"Top of the rules", "Bottom of the rules"}))
+	if cfg.RememberPosition == rememberAtBottom {
+		rememberRow.SetSelected(1)
+	}
+	behaviorGroup.Add(rememberRow)
 	content.Append(behaviorGroup)
 
 	// Connect change handlers
@@ -357,6 +426,11 @@ func createBehaviorPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.W
 		saveConfigWithFlag(cfg)
 	})
 
+	notifyRow.Connect("notify::active", func() {
+		cfg.NotifyOnRoute = notifyRow.Active()
+		saveConfigWithFlag(cfg)
+	})
+
 	defaultRow.Connect("notify::selected", func() {
 		idx := defaultRow.Selected()
 		if idx == 0 {
@@ -367,11 +441,155 @@ func createBehaviorPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.W
 		saveConfigWithFlag(cfg)
 	})
 
+	rememberRow.Connect("notify::selected", func() {
+		cfg.RememberPosition = rememberAtTop
+		if rememberRow.Selected() == 1 {
+			cfg.RememberPosition = rememberAtBottom
+		}
+		saveConfigWithFlag(cfg)
+	})
+
+	// Browsers chosen for always ask rules, used without asking until they expire
+	stickyGroup := adw.NewPreferencesGroup()
+	stickyGroup.SetTitle("Sticky Choices")
+	stickyGroup.SetDescription("When a rule always asks, the picker can keep using the chosen browser for the site for a while")
+
+	clearStickyBtn := gtk.NewButtonWithLabel("Clear All")
+	clearStickyBtn.AddCSSClass("flat")
+	clearStickyBtn.SetVAlign(gtk.AlignCenter)
+	stickyGroup.SetHeaderSuffix(clearStickyBtn)
+
+	stickyMinutesRow := adw.NewSpinRowWithRange(1, 1440, 5)
+	stickyMinutesRow.SetTitle("Minutes to keep a choice")
+	stickyMinutesRow.SetValue(float64(cfg.StickyMinutes))
+	stickyGroup.Add(stickyMinutesRow)
+	content.Append(stickyGroup)
+
+	var stickyRows []*adw.ActionRow
+	var rebuildSticky func()
+	rebuildSticky = func() {
+		for _, row := range stickyRows {
+			stickyGroup.Remove(row)
+		}
+		stickyRows = nil
+
+		choices := loadStickyChoices()
+		clearStickyBtn.SetSensitive(len(choices) > 0)
+		for _, domain := range sortedStickyDomains(choices) {
+			domain := domain // capture
+			choice := choices[domain]
+			browserName := choice.Browser
+			if browser := findBrowserByID(browsers, choice.Browser); browser != nil {
+				browserName = browser.Name
+			}
+
+			row := adw.NewActionRow()
+			row.SetUseMarkup(false)
+			row.SetTitle(domain)
+			row.SetSubtitle(browserName + " " + choice.describe())
+
+			removeBtn := gtk.NewButtonFromIconName("edit-delete-symbolic")
+			removeBtn.SetTooltipText("Ask Again")
+			removeBtn.AddCSSClass("flat")
+			removeBtn.SetVAlign(gtk.AlignCenter)
+			removeBtn.ConnectClicked(func() {
+				if _, err := clearStickyChoices(domain); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to clear sticky choice: %v\n", err)
+				}
+				rebuildSticky()
+			})
+			row.AddSuffix(removeBtn)
+
+			stickyGroup.Add(row)
+			stickyRows = append(stickyRows, row)
+		}
+	}
+	rebuildSticky()
+
+	clearStickyBtn.ConnectClicked(func() {
+		if _, err := clearStickyChoices(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clear sticky choices: %v\n", err)
+		}
+		rebuildSticky()
+	})
+
+	stickyMinutesRow.Connect("notify::value", func() {
+		cfg.StickyMinutes = int(stickyMinutesRow.Value())
+		saveConfigWithFlag(cfg)
+	})
+
+	// Link unwrapping section
+	unwrapGroup := adw.NewPreferencesGroup()
+	unwrapGroup.SetTitle("Link Unwrapping")
+	unwrapGroup.SetDescription("Find the real destination of wrapped links before matching rules. Links are decoded on your computer without contacting any server.")
+
+	for _, uw := range unwrappers {
+		id := uw.ID // capture
+		row := adw.NewSwitchRow()
+		row.SetTitle(uw.Name)
+		row.SetActive(cfg.isUnwrapperEnabled(id))
+		row.Connect("notify::active", func() {
+			cfg.setUnwrapperEnabled(id, row.Active())
+			saveConfigWithFlag(cfg)
+		})
+		unwrapGroup.Add(row)
+	}
+	content.Append(unwrapGroup)
+
+	// Short link expansion
+	shortLinkGroup := adw.NewPreferencesGroup()
+	shortLinkGroup.SetTitle("Short Links")
+	shortLinkGroup.SetDescription("Follow the redirects of short links before matching rules. This contacts the link shortener each time a new short link is opened.")
+
+	expandRow := adw.NewSwitchRow()
+	expandRow.SetTitle("Expand Short Links")
+	expandRow.SetActive(cfg.ExpandShortLinks)
+	shortLinkGroup.Add(expandRow)
+
+	domainsRow := adw.NewEntryRow()
+	domainsRow.SetTitle("Shortener Domains")
+	domainsRow.SetText(strings.Join(cfg.ShortLinkDomains, ", "))
+	domainsRow.SetTooltipText("Comma-separated domains, subdomains are included")
+	domainsRow.SetShowApplyButton(true)
+	domainsRow.SetSensitive(cfg.ExpandShortLinks)
+	domainsRow.ConnectApply(func() {
+		cfg.ShortLinkDomains = parseDomainList(domainsRow.Text())
+		saveConfigWithFlag(cfg)
+	})
+	shortLinkGroup.Add(domainsRow)
+
+	clearCacheRow := adw.NewActionRow()
+	clearCacheRow.SetTitle("Clear Cache")
+	clearCacheRow.SetSubtitle("Forget where short links already opened lead")
+	clearCacheRow.SetActivatable(true)
+	clearCacheRow.AddSuffix(gtk.NewImageFromIconName("user-trash-symbolic"))
+	clearCacheRow.ConnectActivated(func() {
+		if err := clearShortLinkCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to clear short link cache: %v\n", err)
+		}
+	})
+	shortLinkGroup.Add(clearCacheRow)
+
+	expandRow.Connect("notify::active", func() {
+		cfg.ExpandShortLinks = expandRow.Active()
+		domainsRow.SetSensitive(cfg.ExpandShortLinks)
+		saveConfigWithFlag(cfg)
+	})
+	content.Append(shortLinkGroup)
+
 	toolbarView.SetContent(scrolled)
 	return toolbarView
 }
 
-func createRulesPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.Widgetter {
+// ruleTargets returns the browsers and apps rules can open links in. Rules can
+// open links of routed schemes in apps that aren't browsers.
+func ruleTargets(cfg *Config) []*Browser {
+	return cfg.withCustomTargets(detectTargets(cfg.schemeNames()))
+}
+
+// createRulesPage builds the Rules page. If editRule is the 1-based position
+// of a rule, its editor is opened once the window is shown.
+func createRulesPage(win *adw.Window, cfg *Config, browsers []*Browser, editRule int) gtk.Widgetter {
 	// Use AdwToolbarView for proper page architecture
 	toolbarView := adw.NewToolbarView()
 
@@ -473,6 +691,25 @@ func createRulesPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.Widg
 		}
 		row.AddPrefix(icon)
 
+		// Enable switch - disabled rules are kept but never matched
+		if rule.Disabled {
+			row.AddCSSClass("dim-label")
+		}
+		enableSwitch := gtk.NewSwitch()
+		enableSwitch.SetVAlign(gtk.AlignCenter)
+		enableSwitch.SetActive(!rule.Disabled)
+		enableSwitch.SetTooltipText("Enable rule")
+		enableSwitch.Connect("notify::active", func() {
+			rule.Disabled = !enableSwitch.Active()
+			if rule.Disabled {
+				row.AddCSSClass("dim-label")
+			} else {
+				row.RemoveCSSClass("dim-label")
+			}
+			saveConfigWithFlag(cfg)
+		})
+		row.AddSuffix(enableSwitch)
+
 		// Reorder buttons box
 		reorderBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
 		reorderBox.SetVAlign(gtk.AlignCenter)
@@ -568,7 +805,165 @@ func createRulesPage(win *adw.Window, cfg *Config, browsers []*Browser) gtk.Widg
 
 	// Connect Add Rule button handler
 	addButton.ConnectClicked(func() {
-		showAddRuleDialog(win, cfg, browsers, rebuildRulesList)
+		showAddRuleDialog(win, cfg, browsers, nil, rebuildRulesList)
+	})
+
+	if editRule > 0 && editRule <= len(cfg.Rules) {
+		glib.IdleAdd(func() {
+			showEditRuleDialog(win, cfg, &cfg.Rules[editRule-1], browsers, rebuildRulesList)
+		})
+	}
+
+	return toolbarView
+}
+
+func createRewritesPage(win *adw.Window, cfg *Config) gtk.Widgetter {
+	// Use AdwToolbarView for proper page architecture
+	toolbarView := adw.NewToolbarView()
+
+	// Header for this page
+	header := adw.NewHeaderBar()
+	header.SetShowEndTitleButtons(true)
+	titleLabel := gtk.NewLabel("Rewrites")
+	titleLabel.AddCSSClass("title")
+	header.SetTitleWidget(titleLabel)
+
+	// Add Rewrite button in header
+	addButton := gtk.NewButton()
+	addButton.SetIconName("list-add-symbolic")
+	addButton.SetTooltipText("Add New Rewrite")
+	addButton.SetHasFrame(false)
+	header.PackEnd(addButton)
+
+	toolbarView.AddTopBar(header)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+
+	content := gtk.NewBox(gtk.OrientationVertical, 12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+
+	// Info banner (shown when rewrites exist)
+	infoLabel := gtk.NewLabel("Rewrites run in order before rules are matched. Each rewrite sees the result of the previous one.")
+	infoLabel.SetWrap(true)
+	infoLabel.SetXAlign(0)
+	infoLabel.AddCSSClass("dim-label")
+	infoLabel.SetMarginStart(12)
+	infoLabel.SetMarginEnd(12)
+	infoLabel.SetMarginBottom(6)
+	content.Append(infoLabel)
+
+	rewritesListBox := gtk.NewListBox()
+	rewritesListBox.SetSelectionMode(gtk.SelectionNone)
+	rewritesListBox.AddCSSClass("boxed-list")
+
+	// Empty state (shown when no rewrites exist)
+	emptyState := adw.NewStatusPage()
+	emptyState.SetIconName("edit-find-replace-symbolic")
+	emptyState.SetTitle("No Rewrites")
+	emptyState.SetDescription("Add rewrites to remove tracking parameters or redirect URLs before they are opened")
+	emptyState.SetVExpand(true)
+
+	var rebuildRewritesList func()
+
+	createRewriteRow := func(index int) *adw.ActionRow {
+		rw := &cfg.Rewrites[index]
+
+		row := adw.NewActionRow()
+		if rw.Name != "" {
+			row.SetTitle(rw.Name)
+		} else {
+			row.SetTitle(fmt.Sprintf("Rewrite %d", index+1))
+		}
+		row.SetSubtitle(formatRewriteSubtitle(rw))
+		row.SetSubtitleLines(2)
+		row.SetActivatable(true)
+
+		// Reorder buttons box
+		reorderBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
+		reorderBox.SetVAlign(gtk.AlignCenter)
+
+		upBtn := gtk.NewButton()
+		upBtn.SetIconName("go-up-symbolic")
+		upBtn.AddCSSClass("flat")
+		upBtn.SetSensitive(index > 0)
+		upBtn.SetTooltipText("Move rewrite up")
+		upBtn.ConnectClicked(func() {
+			if index > 0 {
+				cfg.Rewrites[index], cfg.Rewrites[index-1] = cfg.Rewrites[index-1], cfg.Rewrites[index]
+				saveConfigWithFlag(cfg)
+				rebuildRewritesList()
+			}
+		})
+		reorderBox.Append(upBtn)
+
+		downBtn := gtk.NewButton()
+		downBtn.SetIconName("go-down-symbolic")
+		downBtn.AddCSSClass("flat")
+		downBtn.SetSensitive(index < len(cfg.Rewrites)-1)
+		downBtn.SetTooltipText("Move rewrite down")
+		downBtn.ConnectClicked(func() {
+			if index < len(cfg.Rewrites)-1 {
+				cfg.Rewrites[index], cfg.Rewrites[index+1] = cfg.Rewrites[index+1], cfg.Rewrites[index]
+				saveConfigWithFlag(cfg)
+				rebuildRewritesList()
+			}
+		})
+		reorderBox.Append(downBtn)
+
+		row.AddSuffix(reorderBox)
+
+		deleteBtn := gtk.NewButton()
+		deleteBtn.SetIconName("edit-delete-symbolic")
+		deleteBtn.AddCSSClass("flat")
+		deleteBtn.AddCSSClass("destructive-action")
+		deleteBtn.SetTooltipText("Delete rewrite")
+		deleteBtn.ConnectClicked(func() {
+			cfg.Rewrites = append(cfg.Rewrites[:index], cfg.Rewrites[index+1:]...)
+			saveConfigWithFlag(cfg)
+			rebuildRewritesList()
+		})
+		row.AddSuffix(deleteBtn)
+
+		row.ConnectActivated(func() {
+			showRewriteDialog(win, cfg, rw, rebuildRewritesList)
+		})
+
+		return row
+	}
+
+	rebuildRewritesList = func() {
+		for {
+			child := rewritesListBox.FirstChild()
+			if child == nil {
+				break
+			}
+			rewritesListBox.Remove(child)
+		}
+
+		hasRewrites := len(cfg.Rewrites) > 0
+		infoLabel.SetVisible(hasRewrites)
+		rewritesListBox.SetVisible(hasRewrites)
+		emptyState.SetVisible(!hasRewrites)
+
+		for i := range cfg.Rewrites {
+			rewritesListBox.Append(createRewriteRow(i))
+		}
+	}
+
+	rebuildRewritesList()
+
+	content.Append(rewritesListBox)
+	content.Append(emptyState)
+	scrolled.SetChild(content)
+	toolbarView.SetContent(scrolled)
+
+	addButton.ConnectClicked(func() {
+		showRewriteDialog(win, cfg, nil, rebuildRewritesList)
 	})
 
 	return toolbarView
@@ -746,6 +1141,21 @@ func watchConfigFile(cfg *Config, onChange func()) {
 					cfg.ForceDarkMode = newCfg.ForceDarkMode
 					cfg.HiddenBrowsers = newCfg.HiddenBrowsers
 					cfg.Rules = newCfg.Rules
+					cfg.Rewrites = newCfg.Rewrites
+					cfg.DisabledUnwrappers = newCfg.DisabledUnwrappers
+					cfg.ExpandShortLinks = newCfg.ExpandShortLinks
+					cfg.ShortLinkDomains = newCfg.ShortLinkDomains
+					cfg.Schemes = newCfg.Schemes
+					cfg.Targets = newCfg.Targets
+					cfg.FallbackBrowsers = newCfg.FallbackBrowsers
+					cfg.NotifyOnRoute = newCfg.NotifyOnRoute
+					cfg.History = newCfg.History
+					cfg.HistoryHostOnly = newCfg.HistoryHostOnly
+					cfg.HistoryDays = newCfg.HistoryDays
+					cfg.HistoryMaxEntries = newCfg.HistoryMaxEntries
+					cfg.RememberPosition = newCfg.RememberPosition
+					cfg.StickyMinutes = newCfg.StickyMinutes
+					cfg.resetMatcher()
 
 					if onChange != nil {
 						onChange()